@@ -23,6 +23,7 @@ import (
 	"gochat-backend/internal/middleware"
 	"gochat-backend/internal/repository"
 	"gochat-backend/internal/router"
+	"gochat-backend/internal/socket"
 	"gochat-backend/internal/usecase"
 	"gochat-backend/pkg/email"
 	"gochat-backend/pkg/jwt"
@@ -37,12 +38,13 @@ import (
 	"net/http"
 
 	cloudstorage "gochat-backend/internal/infra/cloudinaryinfra"
-	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/infra/eventbus"
 	"gochat-backend/internal/infra/mysqlinfra"
 	"gochat-backend/internal/infra/redisinfra"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
@@ -99,11 +101,6 @@ func main() {
 	jwtService := jwt.NewJwtService(app.config, redisService)
 	emailService := email.NewSMTPEmailService(app.config)
 	verificationService := verification.NewVerificationService(app.config)
-	kafkaService := kafkainfra.NewKafkaService(app.config.Brokers, app.config.ChatTopic, app.config.ConsumerGroup)
-
-	if err := kafkaService.Initialize(); err != nil {
-		loggerStartServer.Fatalf("Failed to initialize Kafka service: %v", err)
-	}
 
 	// Initialize Repositories
 	accountRepo := repository.NewAccountRepo(db, redisService)
@@ -112,14 +109,34 @@ func main() {
 	friendRequestRepo := repository.NewFriendRequestRepo(db)
 	chatRoomRepo := repository.NewChatRoomRepo(db, redisService)
 	messageRepo := repository.NewMessageRepo(db)
+	messageReactionRepo := repository.NewMessageReactionRepo(db)
 	statusRepo := repository.NewRedisStatusRepository(redisService)
+	outboxEventRepo := repository.NewOutboxEventRepo(db)
+
+	// Dọn định kỳ khóa idempotency tin nhắn đã hết hạn để bảng không phình ra
+	go purgeExpiredIdempotencyKeys(messageRepo)
+
+	// Initialize Event Bus
+	instanceID := uuid.New().String()
+	roomMembers := socket.NewRoomMemberCache(chatRoomRepo, app.config)
+	eventBus, connectionRegistry, err := InitEventBus(app.config, redisService, roomMembers, instanceID)
+	if err != nil {
+		loggerStartServer.Fatalf("Failed to initialize event bus: %v", err)
+	}
+
+	// Relay publish sự kiện đã ghi vào outbox cùng transaction với dữ liệu
+	outboxRelay := eventbus.NewOutboxRelay(outboxEventRepo, eventBus, app.config)
+	outboxRelay.Start()
 
 	deps := &usecase.SharedDependencies{
 		Config:              cfg,
 		JwtService:          jwtService,
 		EmailService:        emailService,
 		VerificationService: verificationService,
-		KafkaService:        kafkaService,
+		EventBus:            eventBus,
+		OutboxRelay:         outboxRelay,
+		InstanceID:          instanceID,
+		ConnectionRegistry:  connectionRegistry,
 
 		AccountRepo:              accountRepo,
 		VerificationRegisterRepo: verificationRepo,
@@ -127,6 +144,7 @@ func main() {
 		FriendRequestRepo:        friendRequestRepo,
 		ChatRoomRepo:             chatRoomRepo,
 		MessageRepo:              messageRepo,
+		MessageReactionRepo:      messageReactionRepo,
 		StatusRepo:               statusRepo,
 
 		CloudinaryStorage: cldService,
@@ -141,7 +159,10 @@ func main() {
 		*app.config,
 	)
 
-	router := router.InitRouter(app.config, middleware, useCaseContainer, deps)
+	// SocketManager tạo ở đây để GracefulShutDown drain được các kết nối realtime
+	socketManager := socket.NewSocketManager(deps, useCaseContainer.UserStatus, useCaseContainer.Chat, roomMembers)
+
+	router := router.InitRouter(app.config, middleware, useCaseContainer, socketManager)
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", app.config.Port),
@@ -155,7 +176,7 @@ func main() {
 	done := make(chan bool)
 
 	go func() {
-		if err := GracefulShutDown(app.config, done, server); err != nil {
+		if err := GracefulShutDown(app.config, done, server, socketManager, outboxRelay, eventBus); err != nil {
 			loggerStartServer.Infof("Stop server shutdown error: %v", err.Error())
 			return
 		}
@@ -196,15 +217,92 @@ func InitRedis(cfg *config.Environment) (redisinfra.RedisService, error) {
 	return redisService, nil
 }
 
-func GracefulShutDown(config *config.Environment, quit chan bool, server *http.Server) error {
+// InitEventBus khởi tạo event bus theo config. Khi nhiều instance dùng chung bus, sự kiện
+// được định tuyến qua connection registry tới các instance có người nhận.
+func InitEventBus(
+	cfg *config.Environment,
+	redisService redisinfra.RedisService,
+	roomMembers *socket.RoomMemberCache,
+	instanceID string,
+) (eventbus.EventBus, repository.ConnectionRegistry, error) {
+	bus, err := eventbus.NewEventBus(cfg, redisService)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Bus trong bộ nhớ chỉ phục vụ một instance, không có gì để định tuyến
+	if !cfg.ConnectionRegistryEnabled || eventbus.Driver(cfg) == eventbus.DriverMemory {
+		return bus, nil, nil
+	}
+
+	log.Printf("Routing event deliveries through connection registry (instance %s)", instanceID)
+	connectionRegistry := repository.NewRedisConnectionRegistry(redisService)
+	routedBus := eventbus.NewRoutedEventBus(
+		bus,
+		redisService,
+		connectionRegistry,
+		socket.NewEventRecipientResolver(roomMembers),
+		instanceID,
+		cfg.EventBusInstanceChannelPrefix,
+	)
+	return routedBus, connectionRegistry, nil
+}
+
+const (
+	idempotencyKeyPurgeInterval  = time.Hour
+	idempotencyKeyPurgeBatchSize = 1000
+)
+
+// purgeExpiredIdempotencyKeys xóa theo lô các khóa idempotency đã hết hạn. Khóa hết hạn
+// chưa bị xóa vẫn được bỏ qua khi gửi tin nhắn, việc dọn chỉ giữ cho bảng nhỏ.
+func purgeExpiredIdempotencyKeys(messageRepo repository.MessageRepository) {
+	ticker := time.NewTicker(idempotencyKeyPurgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for {
+			deleted, err := messageRepo.DeleteExpiredIdempotencyKeys(context.Background(), time.Now().UTC(), idempotencyKeyPurgeBatchSize)
+			if err != nil {
+				log.Printf("Purging expired message idempotency keys: %v", err)
+				break
+			}
+			if deleted < idempotencyKeyPurgeBatchSize {
+				break
+			}
+		}
+	}
+}
+
+func GracefulShutDown(
+	config *config.Environment,
+	quit chan bool,
+	server *http.Server,
+	socketManager *socket.SocketManager,
+	outboxRelay *eventbus.OutboxRelay,
+	eventBus eventbus.EventBus,
+) error {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	<-signals
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.SystemTimeOutSeconds)*time.Second)
 	defer cancel()
+
+	// server.Shutdown không đụng tới kết nối WebSocket đã hijack: drain chúng trước
+	// để client nhận RECONNECT và chuyển sang instance khác thay vì bị cắt ngang
+	if err := socketManager.Drain(ctx); err != nil {
+		log.Printf("Draining realtime connections: %v", err)
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
 		return err
 	}
+
+	// Không còn request ghi outbox mới: chờ relay gửi xong lô đang dở rồi mới đóng bus
+	outboxRelay.Stop()
+
+	if err := eventBus.Close(); err != nil {
+		log.Printf("Closing event bus: %v", err)
+	}
 	close(quit)
 	return nil
 }
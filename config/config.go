@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"strings"
 
 	gEnv "github.com/Netflix/go-env"
 )
@@ -17,9 +18,13 @@ type Environment struct {
 	RunMode string `env:"RUN_MODE,required=true"`
 	Port    int    `env:"PORT,default=8080"`
 
-	// Cors Config
+	// Cors Config (nhiều origin cách nhau bởi dấu phẩy)
 	CorsAllowOrigins string `env:"CORS_ALLOW_ORIGIN,default=http://localhost:3000"`
 
+	// IP/CIDR của reverse proxy được tin X-Forwarded-For (cách nhau bởi dấu phẩy).
+	// Để trống thì không tin proxy nào, IP client là IP kết nối tới server.
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+
 	// Mysql DB Config
 	MysqlHost            string `env:"MYSQL_HOST,required=true"`
 	MysqlPort            int    `env:"MYSQL_PORT,required=true"`
@@ -67,11 +72,78 @@ type Environment struct {
 	RedisPassword string `env:"REDIS_PASSWORD"`
 	RedisDB       int    `env:"REDIS_DB,default=0"`
 
-	// Kafka Config
-	Brokers       []string `env:"KAFKA_BROKERS,required=true"`
-	ChatTopic     string   `env:"KAFKA_CHAT_TOPIC,required=true"`
-	ConsumerGroup string   `env:"KAFKA_CONSUMER_GROUP,required=true"`
+	// Kafka Config (bắt buộc khi event bus dùng Kafka)
+	Brokers       []string `env:"KAFKA_BROKERS"`
+	ChatTopic     string   `env:"KAFKA_CHAT_TOPIC"`
+	ConsumerGroup string   `env:"KAFKA_CONSUMER_GROUP"`
 	Enabled       bool     `env:"KAFKA_ENABLED,default=true"`
+
+	// Event Bus Config: kafka | memory | redis. Để trống thì dùng Kafka khi KAFKA_ENABLED=true,
+	// ngược lại dùng bus trong bộ nhớ (chỉ cho một instance)
+	EventBusDriver           string `env:"EVENT_BUS_DRIVER"`
+	EventBusRedisChannel     string `env:"EVENT_BUS_REDIS_CHANNEL,default=gochat:chat_events"`
+	EventBusMemoryBufferSize int    `env:"EVENT_BUS_MEMORY_BUFFER_SIZE,default=1024"`
+
+	// Connection registry (Redis): ghi nhận instance đang giữ kết nối của user để sự kiện chỉ được
+	// gửi tới channel riêng của các instance đó. Không dùng với bus trong bộ nhớ (chỉ một instance).
+	// Instance không gia hạn heartbeat trong TTL bị coi là đã chết và bị các instance khác dọn.
+	ConnectionRegistryEnabled     bool   `env:"CONNECTION_REGISTRY_ENABLED,default=true"`
+	ConnectionRegistryTTLSeconds  int    `env:"CONNECTION_REGISTRY_TTL_SECONDS,default=30"`
+	EventBusInstanceChannelPrefix string `env:"EVENT_BUS_INSTANCE_CHANNEL_PREFIX,default=gochat:instance:"`
+
+	// Khóa idempotency của tin nhắn là duy nhất theo người gửi và phòng trong khoảng này:
+	// client gửi lại cùng khóa (ví dụ retry khi mạng chập chờn) nhận lại tin nhắn gốc
+	MessageIdempotencyWindowHours int `env:"MESSAGE_IDEMPOTENCY_WINDOW_HOURS,default=24"`
+
+	// Outbox relay: publish sự kiện trong bảng outbox_events lên event bus theo thứ tự ghi.
+	// Lỗi publish được thử lại với backoff tăng dần tới OUTBOX_RELAY_MAX_BACKOFF_SECONDS;
+	// sự kiện lỗi quá OUTBOX_RELAY_MAX_ATTEMPTS lần bị đánh dấu FAILED. Sự kiện đã gửi được
+	// giữ OUTBOX_SENT_RETENTION_HOURS rồi xóa.
+	OutboxRelayPollIntervalMs    int `env:"OUTBOX_RELAY_POLL_INTERVAL_MS,default=500"`
+	OutboxRelayBatchSize         int `env:"OUTBOX_RELAY_BATCH_SIZE,default=100"`
+	OutboxRelayMaxAttempts       int `env:"OUTBOX_RELAY_MAX_ATTEMPTS,default=20"`
+	OutboxRelayMaxBackoffSeconds int `env:"OUTBOX_RELAY_MAX_BACKOFF_SECONDS,default=30"`
+	OutboxSentRetentionHours     int `env:"OUTBOX_SENT_RETENTION_HOURS,default=24"`
+
+	// Socket Rate Limit Config (token bucket theo user và loại message)
+	SocketRateLimitEnabled         bool    `env:"SOCKET_RATE_LIMIT_ENABLED,default=true"`
+	SocketChatRatePerSecond        float64 `env:"SOCKET_CHAT_RATE_PER_SECOND,default=5"`
+	SocketChatBurst                int     `env:"SOCKET_CHAT_BURST,default=10"`
+	SocketTypingRatePerSecond      float64 `env:"SOCKET_TYPING_RATE_PER_SECOND,default=2"`
+	SocketTypingBurst              int     `env:"SOCKET_TYPING_BURST,default=5"`
+	SocketDefaultRatePerSecond     float64 `env:"SOCKET_DEFAULT_RATE_PER_SECOND,default=10"`
+	SocketDefaultBurst             int     `env:"SOCKET_DEFAULT_BURST,default=20"`
+	SocketRateLimitWindowSeconds   int     `env:"SOCKET_RATE_LIMIT_WINDOW_SECONDS,default=60"`
+	SocketRateLimitMuteAfter       int     `env:"SOCKET_RATE_LIMIT_MUTE_AFTER,default=5"`
+	SocketRateLimitMuteSeconds     int     `env:"SOCKET_RATE_LIMIT_MUTE_SECONDS,default=30"`
+	SocketRateLimitDisconnectAfter int     `env:"SOCKET_RATE_LIMIT_DISCONNECT_AFTER,default=10"`
+
+	// Số shard của Hub: kết nối và active view được chia theo hash, mỗi shard có lock riêng.
+	// Fan-out khóa mọi shard chứa thành viên phòng nên nhiều shard hơn làm fan-out chậm đi,
+	// đo bằng BenchmarkHubShards trước khi tăng
+	SocketHubShards int `env:"SOCKET_HUB_SHARDS,default=4"`
+
+	// Cache thành viên phòng dùng khi fan-out: số phòng tối đa và thời gian sống của mỗi phòng
+	SocketRoomMemberCacheSize       int `env:"SOCKET_ROOM_MEMBER_CACHE_SIZE,default=10000"`
+	SocketRoomMemberCacheTTLSeconds int `env:"SOCKET_ROOM_MEMBER_CACHE_TTL_SECONDS,default=300"`
+
+	// Thời gian sống của trạng thái typing, client cần gửi lại TYPING trước khi hết hạn
+	SocketTypingTTLSeconds int `env:"SOCKET_TYPING_TTL_SECONDS,default=6"`
+
+	// Chờ bao lâu sau khi kết nối cuối cùng đóng mới báo offline, tránh nhấp nháy khi reconnect
+	SocketPresenceDebounceSeconds int `env:"SOCKET_PRESENCE_DEBOUNCE_SECONDS,default=5"`
+
+	// Mọi kết nối của user không gửi frame nào trong khoảng này thì tự chuyển away
+	SocketIdleAwaySeconds int `env:"SOCKET_IDLE_AWAY_SECONDS,default=300"`
+
+	// Khi drain lúc shutdown, mỗi client nhận gợi ý chờ ngẫu nhiên trong khoảng này trước khi
+	// kết nối lại để các instance còn lại không bị dồn reconnect cùng lúc
+	SocketDrainReconnectJitterSeconds int `env:"SOCKET_DRAIN_RECONNECT_JITTER_SECONDS,default=10"`
+
+	// Socket Backpressure Config (xử lý khi kênh gửi của client bị đầy)
+	SocketChatOverflowPolicy      string `env:"SOCKET_CHAT_OVERFLOW_POLICY,default=spill"`         // spill | disconnect
+	SocketSpillQueueSize          int    `env:"SOCKET_SPILL_QUEUE_SIZE,default=1024"`              // Số frame chat tối đa trong hàng đợi tràn của mỗi kết nối
+	SocketEphemeralOverflowPolicy string `env:"SOCKET_EPHEMERAL_OVERFLOW_POLICY,default=coalesce"` // coalesce | drop
 }
 
 func Load() (*Environment, error) {
@@ -85,3 +157,25 @@ func Load() (*Environment, error) {
 
 	return &env, nil
 }
+
+// AllowedOrigins tách CorsAllowOrigins thành danh sách origin, bỏ khoảng trắng và phần tử rỗng
+func (e *Environment) AllowedOrigins() []string {
+	return splitList(e.CorsAllowOrigins)
+}
+
+// TrustedProxyList tách TrustedProxies thành danh sách IP/CIDR, nil khi không tin proxy nào
+func (e *Environment) TrustedProxyList() []string {
+	return splitList(e.TrustedProxies)
+}
+
+// splitList tách chuỗi cách nhau bởi dấu phẩy, bỏ khoảng trắng và phần tử rỗng
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -20,6 +20,27 @@ type Message struct {
 	MimeType   string      `json:"mime_type,omitempty"`
 	Content    string      `json:"content"`
 	CreatedAt  time.Time   `json:"created_at"`
+	EditedAt   *time.Time  `json:"edited_at,omitempty"`
+	DeletedAt  *time.Time  `json:"deleted_at,omitempty"` // Khác nil nếu tin nhắn đã bị thu hồi (tombstone)
+	// ReplyToMessageId là tin nhắn gốc được trích dẫn (cùng phòng), rỗng nếu không phải reply
+	ReplyToMessageId string `json:"reply_to_message_id,omitempty"`
+	ReplyCount       int    `json:"reply_count"`
+	// Seq tăng dần theo từng phòng, client dùng để phát hiện tin nhắn bị lỡ
+	Seq int64 `json:"seq"`
+}
+
+type MessageReaction struct {
+	MessageId string    `json:"message_id"`
+	UserId    string    `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary là số lượng reaction theo từng emoji của một tin nhắn
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
 }
 
 type ChatRoom struct {
@@ -35,3 +56,12 @@ type ChatRoomMember struct {
 	UserId     string    `json:"user_id"`
 	JoinedAt   time.Time `json:"joined_at"`
 }
+
+// ChatRoomReadState là vị trí đã đọc của một thành viên trong phòng
+type ChatRoomReadState struct {
+	ChatRoomId        string     `json:"chat_room_id"`
+	UserId            string     `json:"user_id"`
+	LastReadMessageId string     `json:"last_read_message_id,omitempty"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"` // created_at của tin nhắn đã đọc gần nhất
+	UnreadCount       int        `json:"unread_count"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+type OutboxEventStatus string
+
+const (
+	OutboxEventPending OutboxEventStatus = "PENDING"
+	OutboxEventSent    OutboxEventStatus = "SENT"
+	OutboxEventFailed  OutboxEventStatus = "FAILED" // Hết số lần thử, relay bỏ qua
+)
+
+// OutboxEvent là sự kiện chờ relay publish lên event bus, được ghi trong cùng transaction
+// với thay đổi sinh ra nó nên DB và bus không thể lệch nhau
+type OutboxEvent struct {
+	ID         int64             `json:"id"` // Tăng dần, relay publish theo thứ tự này
+	EventType  string            `json:"event_type"`
+	ChatRoomId string            `json:"chat_room_id"`
+	Payload    []byte            `json:"payload"` // MQEvent đã mã hóa JSON
+	Status     OutboxEventStatus `json:"status"`
+	Attempts   int               `json:"attempts"`
+	LastError  string            `json:"last_error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	SentAt     *time.Time        `json:"sent_at,omitempty"`
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+type RoomEventType string
+
+const (
+	RoomEventMessageEdited   RoomEventType = "message_edited"
+	RoomEventMessageDeleted  RoomEventType = "message_deleted" // Chỉ thu hồi với mọi người, "xóa phía tôi" không thuộc về phòng
+	RoomEventReactionAdded   RoomEventType = "reaction_added"
+	RoomEventReactionRemoved RoomEventType = "reaction_removed"
+	RoomEventMessageRead     RoomEventType = "message_read"
+)
+
+// RoomEvent là một thay đổi của phòng trên tin nhắn đã có, được cấp seq từ cùng bộ đếm
+// chat_rooms.last_seq với tin nhắn mới để client phát hiện và replay mọi sự kiện bị lỡ.
+// Nhật ký chỉ lưu sự kiện đã xảy ra, nội dung được dựng lại từ trạng thái hiện tại khi replay.
+type RoomEvent struct {
+	ChatRoomId string        `json:"chat_room_id"`
+	Seq        int64         `json:"seq"`
+	EventType  RoomEventType `json:"event_type"`
+	MessageId  string        `json:"message_id"`
+	ActorId    string        `json:"actor_id"`
+	Emoji      string        `json:"emoji,omitempty"` // Chỉ có với reaction
+	CreatedAt  time.Time     `json:"created_at"`
+}
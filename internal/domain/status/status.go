@@ -5,12 +5,33 @@ import "time"
 type UserStatusType string
 
 const (
-	Online  UserStatusType = "online"
-	Offline UserStatusType = "offline"
+	Online       UserStatusType = "online"
+	Offline      UserStatusType = "offline"
+	Away         UserStatusType = "away"      // Tự đặt hoặc tự động khi mọi kết nối đều idle
+	DoNotDisturb UserStatusType = "dnd"       // Không làm phiền
+	Invisible    UserStatusType = "invisible" // Vẫn nhận tin nhắn nhưng hiện offline với người khác
 )
 
 type UserStatus struct {
 	UserID   string         `json:"user_id"`
-	Status   UserStatusType `json:"status"`
+	Status   UserStatusType `json:"status"`    // Trạng thái kết nối: online, away (idle) hoặc offline
 	LastSeen time.Time      `json:"last_seen"` // Thời điểm cuối cùng user online (nếu offline) hoặc thời điểm set online
 }
+
+// UserPresence là trạng thái user tự chọn, lưu riêng với trạng thái kết nối
+// để không bị ghi đè mỗi lần user kết nối hoặc ngắt kết nối
+type UserPresence struct {
+	UserID              string         `json:"user_id"`
+	Status              UserStatusType `json:"status"` // online (tự động), away, dnd hoặc invisible
+	CustomText          string         `json:"custom_text,omitempty"`
+	CustomTextExpiresAt *time.Time     `json:"custom_text_expires_at,omitempty"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+}
+
+// ActiveCustomText trả về custom text nếu chưa hết hạn
+func (p *UserPresence) ActiveCustomText(now time.Time) string {
+	if p.CustomTextExpiresAt != nil && !now.Before(*p.CustomTextExpiresAt) {
+		return ""
+	}
+	return p.CustomText
+}
@@ -17,6 +17,7 @@ import (
 	"gochat-backend/internal/middleware"
 	"gochat-backend/internal/repository"
 	"gochat-backend/internal/router"
+	"gochat-backend/internal/socket"
 	"gochat-backend/internal/usecase"
 	jwtPkg "gochat-backend/pkg/jwt"
 	"io"
@@ -71,7 +72,10 @@ func setupTestServer(t *testing.T, db *mysqlinfra.Database, redisService redisin
 	useCaseContainer := usecase.NewUseCaseContainer(deps)
 	mware := middleware.NewMiddleware(jwtService, nil, *cfg) // Logger có thể nil cho test đơn giản
 
-	r := router.InitRouter(cfg, mware, useCaseContainer, deps)
+	roomMembers := socket.NewRoomMemberCache(deps.ChatRoomRepo, cfg)
+	socketManager := socket.NewSocketManager(deps, useCaseContainer.UserStatus, useCaseContainer.Chat, roomMembers)
+
+	r := router.InitRouter(cfg, mware, useCaseContainer, socketManager)
 	return httptest.NewServer(r)
 }
 
@@ -1,6 +1,7 @@
 package chat_room
 
 import (
+	"errors"
 	"fmt"
 	"gochat-backend/internal/handler"
 	"gochat-backend/internal/usecase/chat"
@@ -283,6 +284,58 @@ func GetChatRoomMessages(c *gin.Context, chatUseCase chat.ChatUseCase) {
 	handler.SendSuccessResponse(c, http.StatusOK, "Messages retrieved successfully", messages)
 }
 
+// GetMessageThread liệt kê các reply của một tin nhắn
+// @Summary Get message thread
+// @Description Lists the replies to a message in chronological order with pagination
+// @Tags Chat Room
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Chat Room ID"
+// @Param messageId path string true "Parent Message ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Items per page (default: 20)"
+// @Success 200 {object} handler.APIResponse{data=[]chat.MessageOutput} "Thread retrieved successfully"
+// @Failure 400 {object} handler.APIResponse "Chat room ID and message ID are required"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 403 {object} handler.APIResponse "User not a member of chat room"
+// @Failure 404 {object} handler.APIResponse "Chat room or message not found"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /chat-rooms/{id}/messages/{messageId}/thread [get]
+func GetMessageThread(c *gin.Context, chatUseCase chat.ChatUseCase) {
+	// Get user ID from context
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chatRoomID := c.Param("id")
+	messageID := c.Param("messageId")
+	if chatRoomID == "" || messageID == "" {
+		handler.SendErrorResponse(c, http.StatusBadRequest, "Chat room ID and message ID are required")
+		return
+	}
+
+	// Parse pagination params
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+
+	replies, err := chatUseCase.GetMessageThread(c.Request.Context(), userID, chatRoomID, messageID, page, limit)
+	if err != nil {
+		handler.SendErrorResponse(c, messageErrorStatus(err), fmt.Sprintf("Failed to get thread: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Thread retrieved successfully", replies)
+}
+
 // LeaveChatRoom allows a user to leave a chat room
 // @Summary Leave chat room
 // @Description Allows the authenticated user to leave a chat room
@@ -365,3 +418,160 @@ func FindOrCreatePrivateChatRoom(c *gin.Context, chatUseCase chat.ChatUseCase) {
 
 	handler.SendSuccessResponse(c, http.StatusOK, "Chat room found or created successfully", chatRoom)
 }
+
+// SendMessage gửi tin nhắn mới vào phòng qua REST cho client không giữ được WebSocket
+// @Summary Send a message
+// @Description Sends a new message to a chat room. The message type is derived from mime_type and the message is delivered to online members in real time, exactly like a WebSocket SEND_MESSAGE.
+// @Description Retries with the same idempotency key (body field or Idempotency-Key header) return the original message instead of creating a duplicate
+// @Tags Chat Room
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Chat Room ID"
+// @Param Idempotency-Key header string false "Client-generated key, used when the body has no idempotency_key"
+// @Param request body chat.SendMessageInput true "Message content"
+// @Success 201 {object} handler.APIResponse{data=chat.MessageOutput} "Message sent successfully"
+// @Failure 400 {object} handler.APIResponse "Invalid request format, empty content, invalid reply target or idempotency key"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 403 {object} handler.APIResponse "User not a member of chat room"
+// @Failure 404 {object} handler.APIResponse "Chat room not found"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /chat-rooms/{id}/messages [post]
+func SendMessage(c *gin.Context, chatUseCase chat.ChatUseCase) {
+	// Get user ID from context
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chatRoomID := c.Param("id")
+	if chatRoomID == "" {
+		handler.SendErrorResponse(c, http.StatusBadRequest, "Chat room ID is required")
+		return
+	}
+
+	var input chat.SendMessageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		handler.SendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+		return
+	}
+	if input.IdempotencyKey == "" {
+		input.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	}
+
+	message, err := chatUseCase.SendMessage(c.Request.Context(), userID, chatRoomID, input)
+	if err != nil {
+		handler.SendErrorResponse(c, messageErrorStatus(err), fmt.Sprintf("Failed to send message: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusCreated, "Message sent successfully", message)
+}
+
+// EditMessage cho phép người gửi sửa nội dung một tin nhắn đã gửi
+// @Summary Edit a message
+// @Description Edits the content of a message. Only the original sender can edit; the previous content is kept in the edit history
+// @Tags Chat Room
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Chat Room ID"
+// @Param messageId path string true "Message ID"
+// @Param request body chat.MessageEditInput true "New message content"
+// @Success 200 {object} handler.APIResponse{data=chat.MessageOutput} "Message edited successfully"
+// @Failure 400 {object} handler.APIResponse "Invalid request format or empty content"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 403 {object} handler.APIResponse "User is not the sender of the message"
+// @Failure 404 {object} handler.APIResponse "Chat room or message not found"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /chat-rooms/{id}/messages/{messageId} [patch]
+func EditMessage(c *gin.Context, chatUseCase chat.ChatUseCase) {
+	// Get user ID from context
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chatRoomID := c.Param("id")
+	messageID := c.Param("messageId")
+	if chatRoomID == "" || messageID == "" {
+		handler.SendErrorResponse(c, http.StatusBadRequest, "Chat room ID and message ID are required")
+		return
+	}
+
+	var input chat.MessageEditInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		handler.SendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+		return
+	}
+
+	message, err := chatUseCase.EditMessage(c.Request.Context(), userID, chatRoomID, messageID, input.Content)
+	if err != nil {
+		handler.SendErrorResponse(c, messageErrorStatus(err), fmt.Sprintf("Failed to edit message: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Message edited successfully", message)
+}
+
+// DeleteMessage xóa một tin nhắn phía người gọi hoặc thu hồi với mọi người
+// @Summary Delete or unsend a message
+// @Description Deletes a message. mode=for_me hides it only for the caller; mode=for_everyone (sender only) wipes its content and leaves a tombstone
+// @Tags Chat Room
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Chat Room ID"
+// @Param messageId path string true "Message ID"
+// @Param mode query string false "Delete mode: for_me (default) or for_everyone"
+// @Success 200 {object} handler.APIResponse{data=chat.MessageDeletedOutput} "Message deleted successfully"
+// @Failure 400 {object} handler.APIResponse "Invalid delete mode"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 403 {object} handler.APIResponse "User is not allowed to delete the message"
+// @Failure 404 {object} handler.APIResponse "Chat room or message not found"
+// @Failure 409 {object} handler.APIResponse "Message already deleted"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /chat-rooms/{id}/messages/{messageId} [delete]
+func DeleteMessage(c *gin.Context, chatUseCase chat.ChatUseCase) {
+	// Get user ID from context
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	chatRoomID := c.Param("id")
+	messageID := c.Param("messageId")
+	if chatRoomID == "" || messageID == "" {
+		handler.SendErrorResponse(c, http.StatusBadRequest, "Chat room ID and message ID are required")
+		return
+	}
+
+	mode := chat.MessageDeleteMode(c.DefaultQuery("mode", string(chat.DeleteForMe)))
+
+	result, err := chatUseCase.DeleteMessage(c.Request.Context(), userID, chatRoomID, messageID, mode)
+	if err != nil {
+		handler.SendErrorResponse(c, messageErrorStatus(err), fmt.Sprintf("Failed to delete message: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Message deleted successfully", result)
+}
+
+// messageErrorStatus chuyển lỗi nghiệp vụ của ChatUseCase sang HTTP status code
+func messageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, chat.ErrEmptyContent), errors.Is(err, chat.ErrInvalidDeleteMode), errors.Is(err, chat.ErrInvalidReplyTo),
+		errors.Is(err, chat.ErrInvalidIdempotencyKey):
+		return http.StatusBadRequest
+	case errors.Is(err, chat.ErrNotChatRoomMember), errors.Is(err, chat.ErrNotMessageSender):
+		return http.StatusForbidden
+	case errors.Is(err, chat.ErrChatRoomNotFound), errors.Is(err, chat.ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, chat.ErrMessageDeleted):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
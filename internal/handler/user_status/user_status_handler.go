@@ -0,0 +1,155 @@
+package user_status
+
+import (
+	"errors"
+	"fmt"
+	"gochat-backend/internal/handler"
+	"gochat-backend/internal/usecase/status"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyStatus returns the status the authenticated user has chosen, including invisible
+// @Summary Get my status
+// @Description Returns the authenticated user's own status (online, away, dnd or invisible) and custom status text
+// @Tags User Status
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} handler.APIResponse{data=status.UserStatusOutput} "Status retrieved successfully"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /users/me/status [get]
+func GetMyStatus(c *gin.Context, statusUseCase status.StatusUseCase) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	output, err := statusUseCase.GetOwnStatus(c.Request.Context(), userID)
+	if err != nil {
+		handler.SendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get status: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Status retrieved successfully", output)
+}
+
+// SetMyStatus sets away/dnd/invisible and an optional custom status text
+// @Summary Set my status
+// @Description Sets the authenticated user's status and custom text. Status "online" clears the chosen status. Friends are notified in real time.
+// @Tags User Status
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body status.SetStatusInput true "New status"
+// @Success 200 {object} handler.APIResponse{data=status.UserStatusOutput} "Status updated successfully"
+// @Failure 400 {object} handler.APIResponse "Invalid status or custom text"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /users/me/status [put]
+func SetMyStatus(c *gin.Context, statusUseCase status.StatusUseCase) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input status.SetStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		handler.SendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+		return
+	}
+
+	output, err := statusUseCase.SetUserPresence(c.Request.Context(), userID, input)
+	if err != nil {
+		if errors.Is(err, status.ErrInvalidStatus) ||
+			errors.Is(err, status.ErrCustomTextTooLong) ||
+			errors.Is(err, status.ErrInvalidStatusExpiry) {
+			handler.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		handler.SendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to update status: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Status updated successfully", output)
+}
+
+// GetUserStatus returns the displayed status of a user
+// @Summary Get a user's status
+// @Description Returns online/away/dnd/offline status and custom text of a user. Last-seen is only included for friends and room co-members.
+// @Tags User Status
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} handler.APIResponse{data=status.UserStatusOutput} "Status retrieved successfully"
+// @Failure 400 {object} handler.APIResponse "User ID is required"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /users/{id}/status [get]
+func GetUserStatus(c *gin.Context, statusUseCase status.StatusUseCase) {
+	viewerID := c.GetString("userId")
+	if viewerID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	userID := c.Param("id")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusBadRequest, "User ID is required")
+		return
+	}
+
+	output, err := statusUseCase.GetUserStatusForViewer(c.Request.Context(), viewerID, userID)
+	if err != nil {
+		if errors.Is(err, status.ErrUserIDRequired) {
+			handler.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		handler.SendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get status: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Status retrieved successfully", output)
+}
+
+// GetUserStatuses returns the displayed statuses of many users in one call
+// @Summary Batch get user statuses
+// @Description Returns statuses for up to 500 user IDs, in request order without duplicates. Last-seen is only included for friends and room co-members.
+// @Tags User Status
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body status.BatchStatusInput true "User IDs"
+// @Success 200 {object} handler.APIResponse{data=[]status.UserStatusOutput} "Statuses retrieved successfully"
+// @Failure 400 {object} handler.APIResponse "Invalid request or too many user IDs"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /users/status [post]
+func GetUserStatuses(c *gin.Context, statusUseCase status.StatusUseCase) {
+	viewerID := c.GetString("userId")
+	if viewerID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input status.BatchStatusInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		handler.SendErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("Invalid request format: %v", err))
+		return
+	}
+
+	outputs, err := statusUseCase.GetUserStatusesForViewer(c.Request.Context(), viewerID, input.UserIDs)
+	if err != nil {
+		if errors.Is(err, status.ErrTooManyUserIDs) {
+			handler.SendErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		handler.SendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get statuses: %v", err))
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Statuses retrieved successfully", outputs)
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"gochat-backend/internal/handler"
+	"gochat-backend/internal/socket"
+	"gochat-backend/internal/usecase/auth"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// connectionIDHeader là header chứa ConnID nhận được trong sự kiện CONNECTED của stream SSE
+const connectionIDHeader = "X-Connection-ID"
+
+// StreamEvents opens a Server-Sent Events stream for realtime delivery
+// @Summary Open realtime event stream (SSE)
+// @Description Fallback for networks that block WebSocket upgrades. Streams the same server-to-client socket messages as /ws as JSON "data:" events. The first event is CONNECTED with the conn_id to send in the X-Connection-ID header of the action endpoints. Authenticate with a single-use ticket from POST /ws/ticket, passed as ?ticket=.
+// @Tags Realtime
+// @Produce text/event-stream
+// @Param ticket query string true "Single-use ticket from POST /ws/ticket"
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {object} handler.APIResponse "Invalid or expired ticket"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /events [get]
+func StreamEvents(c *gin.Context, socketManager *socket.SocketManager, authUseCase auth.AuthUseCase) {
+	// EventSource không gửi được header Authorization nên xác thực bằng ticket giống /ws
+	userID, err := authUseCase.RedeemWebSocketTicket(c.Request.Context(), c.Query("ticket"), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidWebSocketTicket) {
+			handler.SendErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		handler.SendErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("Opening SSE stream for user: %s", userID)
+	socketManager.ServeSSE(c.Writer, c.Request, userID)
+}
+
+// SendMessageAction sends a chat message from an SSE connection
+// @Summary Send a chat message (SSE companion)
+// @Description Same payload as the SEND_MESSAGE socket message. MESSAGE_ACK or MESSAGE_NACK is delivered over the event stream.
+// @Tags Realtime
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param X-Connection-ID header string true "conn_id from the CONNECTED event"
+// @Param request body socket.ChatMessageSendPayload true "Message"
+// @Success 202 {object} handler.APIResponse "Action accepted"
+// @Failure 400 {object} handler.APIResponse "Invalid payload"
+// @Failure 404 {object} handler.APIResponse "Connection not found"
+// @Router /events/messages [post]
+func SendMessageAction(c *gin.Context, socketManager *socket.SocketManager) {
+	dispatchBodyAction(c, socketManager, socket.SocketMessageTypeChat)
+}
+
+// TypingAction reports typing state from an SSE connection
+// @Summary Report typing (SSE companion)
+// @Description Same payload as the TYPING socket message. The connection must have joined the room.
+// @Tags Realtime
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param X-Connection-ID header string true "conn_id from the CONNECTED event"
+// @Param request body socket.TypingPayload true "Typing state"
+// @Success 202 {object} handler.APIResponse "Action accepted"
+// @Failure 400 {object} handler.APIResponse "Invalid payload"
+// @Failure 404 {object} handler.APIResponse "Connection not found"
+// @Router /events/typing [post]
+func TypingAction(c *gin.Context, socketManager *socket.SocketManager) {
+	dispatchBodyAction(c, socketManager, socket.SocketMessageTypeTyping)
+}
+
+// ReadReceiptAction marks a message as read from an SSE connection
+// @Summary Mark message read (SSE companion)
+// @Description Same payload as the READ_RECEIPT socket message.
+// @Tags Realtime
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param X-Connection-ID header string true "conn_id from the CONNECTED event"
+// @Param request body socket.ReadReceiptPayload true "Read receipt"
+// @Success 202 {object} handler.APIResponse "Action accepted"
+// @Failure 400 {object} handler.APIResponse "Invalid payload"
+// @Failure 404 {object} handler.APIResponse "Connection not found"
+// @Router /events/read [post]
+func ReadReceiptAction(c *gin.Context, socketManager *socket.SocketManager) {
+	dispatchBodyAction(c, socketManager, socket.SocketMessageTypeReadReceipt)
+}
+
+// ResumeAction replays missed messages over an SSE connection
+// @Summary Resume rooms (SSE companion)
+// @Description Same payload as the RESUME socket message. Replayed messages, edits, unsends, reactions, read receipts and RESUMED are delivered over the event stream.
+// @Tags Realtime
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param X-Connection-ID header string true "conn_id from the CONNECTED event"
+// @Param request body socket.ResumePayload true "Last seen seq per room"
+// @Success 202 {object} handler.APIResponse "Action accepted"
+// @Failure 400 {object} handler.APIResponse "Invalid payload"
+// @Failure 404 {object} handler.APIResponse "Connection not found"
+// @Router /events/resume [post]
+func ResumeAction(c *gin.Context, socketManager *socket.SocketManager) {
+	dispatchBodyAction(c, socketManager, socket.SocketMessageTypeResume)
+}
+
+// JoinRoomAction makes an SSE connection actively view a room
+// @Summary Join room active view (SSE companion)
+// @Description Equivalent to the JOIN_ROOM socket message. JOIN_SUCCESS or an error is delivered over the event stream.
+// @Tags Realtime
+// @Produce json
+// @Security BearerAuth
+// @Param X-Connection-ID header string true "conn_id from the CONNECTED event"
+// @Param id path string true "Chat room ID"
+// @Success 202 {object} handler.APIResponse "Action accepted"
+// @Failure 404 {object} handler.APIResponse "Connection not found"
+// @Router /events/rooms/{id}/join [post]
+func JoinRoomAction(c *gin.Context, socketManager *socket.SocketManager) {
+	payload, _ := json.Marshal(socket.JoinRoomPayload{ChatRoomID: c.Param("id")})
+	dispatchAction(c, socketManager, socket.SocketMessageTypeJoin, payload)
+}
+
+// LeaveRoomAction stops an SSE connection from actively viewing a room
+// @Summary Leave room active view (SSE companion)
+// @Description Equivalent to the LEAVE_ROOM socket message.
+// @Tags Realtime
+// @Produce json
+// @Security BearerAuth
+// @Param X-Connection-ID header string true "conn_id from the CONNECTED event"
+// @Param id path string true "Chat room ID"
+// @Success 202 {object} handler.APIResponse "Action accepted"
+// @Failure 404 {object} handler.APIResponse "Connection not found"
+// @Router /events/rooms/{id}/leave [post]
+func LeaveRoomAction(c *gin.Context, socketManager *socket.SocketManager) {
+	payload, _ := json.Marshal(socket.LeaveRoomPayload{ChatRoomID: c.Param("id")})
+	dispatchAction(c, socketManager, socket.SocketMessageTypeLeave, payload)
+}
+
+// dispatchBodyAction dùng nguyên body JSON làm Data của SocketMessage
+func dispatchBodyAction(c *gin.Context, socketManager *socket.SocketManager, messageType socket.SocketMessageType) {
+	body, err := c.GetRawData()
+	if err != nil || !json.Valid(body) {
+		handler.SendErrorResponse(c, http.StatusBadRequest, "Request body must be valid JSON")
+		return
+	}
+	dispatchAction(c, socketManager, messageType, body)
+}
+
+func dispatchAction(c *gin.Context, socketManager *socket.SocketManager, messageType socket.SocketMessageType, data json.RawMessage) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	connID := c.GetHeader(connectionIDHeader)
+	if connID == "" {
+		handler.SendErrorResponse(c, http.StatusBadRequest, connectionIDHeader+" header is required")
+		return
+	}
+
+	message := socket.SocketMessage{
+		Type:      messageType,
+		SenderID:  userID,
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Data:      data,
+	}
+
+	if err := socketManager.Dispatch(userID, connID, message); err != nil {
+		if errors.Is(err, socket.ErrConnectionNotFound) {
+			handler.SendErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		handler.SendErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusAccepted, "Action accepted", nil)
+}
@@ -1,16 +1,53 @@
 package handler
 
 import (
+	"errors"
+	"gochat-backend/internal/handler"
 	"gochat-backend/internal/socket"
+	"gochat-backend/internal/usecase/auth"
 	"log"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Tạo kết nối WebSocket từ client
-func HandleWebSocketConnection(c *gin.Context, socketManager *socket.SocketManager) {
-	// Get userID from Context
+// IssueWebSocketTicket issues a single-use ticket for opening a WebSocket connection
+// @Summary Issue WebSocket connection ticket
+// @Description Returns a single-use ticket valid for 30 seconds and bound to the caller's IP. Open the socket with /ws?ticket=<ticket> (or the SSE stream with /events?ticket=<ticket>) instead of passing the access token in the URL.
+// @Tags WebSocket
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} handler.APIResponse{data=auth.WebSocketTicketOutput} "Ticket issued successfully"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Failure 500 {object} handler.APIResponse "Internal server error"
+// @Router /ws/ticket [post]
+func IssueWebSocketTicket(c *gin.Context, authUseCase auth.AuthUseCase) {
 	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	output, err := authUseCase.IssueWebSocketTicket(c.Request.Context(), userID, c.ClientIP())
+	if err != nil {
+		handler.SendErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	handler.SendSuccessResponse(c, http.StatusOK, "Ticket issued successfully", output)
+}
+
+// Tạo kết nối WebSocket từ client, xác thực bằng ticket dùng một lần (?ticket=)
+func HandleWebSocketConnection(c *gin.Context, socketManager *socket.SocketManager, authUseCase auth.AuthUseCase) {
+	userID, err := authUseCase.RedeemWebSocketTicket(c.Request.Context(), c.Query("ticket"), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidWebSocketTicket) {
+			handler.SendErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		handler.SendErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	log.Printf("Establishing WebSocket connection for user: %s", userID)
 
@@ -18,3 +55,23 @@ func HandleWebSocketConnection(c *gin.Context, socketManager *socket.SocketManag
 	// Vì gin.Context.Writer và gin.Context.Request là http.ResponseWriter và *http.Request
 	socketManager.ServeWS(c.Writer, c.Request, userID)
 }
+
+// GetConnectionStats returns send-queue statistics of the current user's WebSocket connections
+// @Summary Get WebSocket connection queue stats
+// @Description Returns queue depth, spill depth and drop counters for each WebSocket connection of the authenticated user on this instance
+// @Tags WebSocket
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} handler.APIResponse{data=[]socket.ClientQueueStats} "Connection stats retrieved successfully"
+// @Failure 401 {object} handler.APIResponse "Unauthorized"
+// @Router /ws/stats [get]
+func GetConnectionStats(c *gin.Context, socketManager *socket.SocketManager) {
+	userID := c.GetString("userId")
+	if userID == "" {
+		handler.SendErrorResponse(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	stats := socketManager.Hub.ConnectionQueueStats(userID)
+	handler.SendSuccessResponse(c, http.StatusOK, "Connection stats retrieved successfully", stats)
+}
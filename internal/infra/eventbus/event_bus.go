@@ -0,0 +1,76 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"gochat-backend/config"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/infra/redisinfra"
+	"log"
+	"strings"
+)
+
+// EventBus phát MQEvent tới mọi instance và nhận MQEvent từ các instance khác.
+// Kafka, Redis Pub/Sub và bus trong bộ nhớ phát mọi sự kiện tới mọi instance (broadcast);
+// RoutedEventBus bọc các bus đó để chỉ gửi tới instance có người nhận.
+type EventBus interface {
+	// PublishChatEvent phát sự kiện cho mọi subscriber, kể cả instance hiện tại
+	PublishChatEvent(ctx context.Context, event *kafkainfra.MQEvent) error
+	// StartChatConsumer gọi eventHandler cho từng sự kiện nhận được, block tới khi ctx bị hủy
+	// (trả về ctx.Err()) hoặc kết nối tới bus lỗi
+	StartChatConsumer(ctx context.Context, eventHandler func(*kafkainfra.MQEvent) error) error
+	Close() error
+}
+
+var (
+	_ EventBus = (*kafkainfra.KafkaService)(nil)
+	_ EventBus = (*MemoryEventBus)(nil)
+	_ EventBus = (*RedisEventBus)(nil)
+	_ EventBus = (*RoutedEventBus)(nil)
+)
+
+const (
+	DriverKafka  = "kafka"
+	DriverMemory = "memory"
+	DriverRedis  = "redis"
+)
+
+// Driver trả về loại event bus theo config. EVENT_BUS_DRIVER được ưu tiên,
+// không đặt thì dùng Kafka khi KAFKA_ENABLED=true và bus trong bộ nhớ khi tắt.
+func Driver(cfg *config.Environment) string {
+	if driver := strings.ToLower(strings.TrimSpace(cfg.EventBusDriver)); driver != "" {
+		return driver
+	}
+	if cfg.Enabled {
+		return DriverKafka
+	}
+	return DriverMemory
+}
+
+// NewEventBus khởi tạo event bus theo config
+func NewEventBus(cfg *config.Environment, redisService redisinfra.RedisService) (EventBus, error) {
+	driver := Driver(cfg)
+	log.Printf("Initializing event bus with driver: %s", driver)
+
+	switch driver {
+	case DriverKafka:
+		if len(cfg.Brokers) == 0 || cfg.ChatTopic == "" || cfg.ConsumerGroup == "" {
+			return nil, fmt.Errorf("kafka event bus requires KAFKA_BROKERS, KAFKA_CHAT_TOPIC and KAFKA_CONSUMER_GROUP")
+		}
+		kafkaService := kafkainfra.NewKafkaService(cfg.Brokers, cfg.ChatTopic, cfg.ConsumerGroup)
+		if err := kafkaService.Initialize(); err != nil {
+			return nil, fmt.Errorf("failed to initialize Kafka service: %w", err)
+		}
+		return kafkaService, nil
+	case DriverMemory:
+		// Chỉ phát trong process: dùng cho chạy một instance hoặc test
+		return NewMemoryEventBus(cfg.EventBusMemoryBufferSize), nil
+	case DriverRedis:
+		if redisService == nil {
+			return nil, fmt.Errorf("redis event bus requires a Redis service")
+		}
+		return NewRedisEventBus(redisService, cfg.EventBusRedisChannel), nil
+	default:
+		return nil, fmt.Errorf("unknown event bus driver '%s' (expected %s, %s or %s)", driver, DriverKafka, DriverMemory, DriverRedis)
+	}
+}
@@ -0,0 +1,115 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"gochat-backend/internal/infra/kafkainfra"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrEventBusClosed = errors.New("event bus is closed")
+
+const defaultMemoryBufferSize = 1024
+
+// memorySubscriber là hàng đợi của một consumer. gone đóng khi consumer thoát
+// để Publish không chờ mãi một hàng đợi không còn ai đọc.
+type memorySubscriber struct {
+	events chan *kafkainfra.MQEvent
+	gone   chan struct{}
+}
+
+// MemoryEventBus phát sự kiện qua channel trong cùng process, không cần broker.
+// Mỗi subscriber có hàng đợi riêng; Publish chờ khi hàng đợi đầy thay vì bỏ sự kiện,
+// vì vậy eventHandler không được publish lại vào chính bus này.
+type MemoryEventBus struct {
+	mutex       sync.RWMutex
+	subscribers map[*memorySubscriber]struct{}
+	bufferSize  int
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func NewMemoryEventBus(bufferSize int) *MemoryEventBus {
+	if bufferSize <= 0 {
+		bufferSize = defaultMemoryBufferSize
+	}
+	return &MemoryEventBus{
+		subscribers: make(map[*memorySubscriber]struct{}),
+		bufferSize:  bufferSize,
+		done:        make(chan struct{}),
+	}
+}
+
+func (b *MemoryEventBus) PublishChatEvent(ctx context.Context, event *kafkainfra.MQEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	select {
+	case <-b.done:
+		return ErrEventBusClosed
+	default:
+	}
+
+	b.mutex.RLock()
+	subscribers := make([]*memorySubscriber, 0, len(b.subscribers))
+	for subscriber := range b.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	b.mutex.RUnlock()
+
+	for _, subscriber := range subscribers {
+		// Mỗi subscriber nhận bản sao riêng như khi đọc từ broker
+		eventCopy := *event
+		select {
+		case subscriber.events <- &eventCopy:
+		case <-subscriber.gone:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return ErrEventBusClosed
+		}
+	}
+	return nil
+}
+
+func (b *MemoryEventBus) StartChatConsumer(ctx context.Context, eventHandler func(*kafkainfra.MQEvent) error) error {
+	subscriber := &memorySubscriber{
+		events: make(chan *kafkainfra.MQEvent, b.bufferSize),
+		gone:   make(chan struct{}),
+	}
+
+	b.mutex.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mutex.Unlock()
+
+	defer func() {
+		close(subscriber.gone)
+		b.mutex.Lock()
+		delete(b.subscribers, subscriber)
+		b.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case event := <-subscriber.events:
+			if err := eventHandler(event); err != nil {
+				log.Printf("Memory event bus: Failed to handle event %s: %v", event.EventType, err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.done:
+			return ErrEventBusClosed
+		}
+	}
+}
+
+func (b *MemoryEventBus) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+	return nil
+}
@@ -0,0 +1,256 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gochat-backend/config"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+	"log"
+	"time"
+)
+
+const (
+	defaultOutboxPollInterval  = 500 * time.Millisecond
+	defaultOutboxBatchSize     = 100
+	defaultOutboxMaxAttempts   = 20
+	defaultOutboxMaxBackoff    = 30 * time.Second
+	defaultOutboxSentRetention = 24 * time.Hour
+
+	outboxPublishTimeout   = 10 * time.Second
+	outboxCleanupInterval  = time.Hour
+	outboxCleanupBatchSize = 1000
+)
+
+// OutboxStore lưu các sự kiện outbox chờ publish
+type OutboxStore interface {
+	// AcquireRelayLock lấy lock chung của các relay mà không chờ; acquired = false nghĩa là
+	// relay khác đang gửi. release phải được gọi khi xong lô.
+	AcquireRelayLock(ctx context.Context) (release func(), acquired bool, err error)
+	FindPendingEvents(ctx context.Context, limit int) ([]*domain.OutboxEvent, error)
+	MarkEventSent(ctx context.Context, eventID int64, sentAt time.Time) error
+	RecordFailedAttempt(ctx context.Context, event *domain.OutboxEvent) error
+	DeleteSentEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// OutboxRelay publish các sự kiện đã ghi vào outbox lên event bus theo thứ tự ghi. Mỗi instance
+// chạy một relay nhưng chỉ relay giữ lock của store được gửi, nên sự kiện không bị gửi song song
+// sai thứ tự. Việc publish nằm ngoài mọi transaction: bus chậm hay lỗi không giữ lock nào trên
+// outbox_events và không chặn việc ghi tin nhắn mới. Khi bus lỗi, relay dừng lô, tăng số lần thử
+// của sự kiện đầu tiên lỗi (quá maxAttempts thì FAILED) và thử lại với backoff tăng dần.
+// Sự kiện có thể được publish lại nếu instance chết sau khi publish nhưng trước khi đánh dấu
+// đã gửi (at-least-once), consumer phải chịu được trùng.
+type OutboxRelay struct {
+	store         OutboxStore
+	bus           EventBus
+	pollInterval  time.Duration
+	batchSize     int
+	maxAttempts   int
+	maxBackoff    time.Duration
+	sentRetention time.Duration
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewOutboxRelay(store OutboxStore, bus EventBus, cfg *config.Environment) *OutboxRelay {
+	pollInterval := time.Duration(cfg.OutboxRelayPollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = defaultOutboxPollInterval
+	}
+	batchSize := cfg.OutboxRelayBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultOutboxBatchSize
+	}
+	maxAttempts := cfg.OutboxRelayMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultOutboxMaxAttempts
+	}
+	maxBackoff := time.Duration(cfg.OutboxRelayMaxBackoffSeconds) * time.Second
+	if maxBackoff <= 0 {
+		maxBackoff = defaultOutboxMaxBackoff
+	}
+	sentRetention := time.Duration(cfg.OutboxSentRetentionHours) * time.Hour
+	if sentRetention <= 0 {
+		sentRetention = defaultOutboxSentRetention
+	}
+
+	return &OutboxRelay{
+		store:         store,
+		bus:           bus,
+		pollInterval:  pollInterval,
+		batchSize:     batchSize,
+		maxAttempts:   maxAttempts,
+		maxBackoff:    max(maxBackoff, pollInterval),
+		sentRetention: sentRetention,
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start chạy relay trong goroutine riêng cho tới khi Stop được gọi
+func (r *OutboxRelay) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(ctx)
+}
+
+// Stop dừng relay và chờ lô đang gửi hoàn tất. Sự kiện còn lại được relay của instance khác
+// hoặc lần chạy sau gửi tiếp.
+func (r *OutboxRelay) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// Notify đánh thức relay ngay khi có sự kiện mới được ghi thay vì chờ tới lần poll sau.
+// Gọi trên relay nil không làm gì.
+func (r *OutboxRelay) Notify() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *OutboxRelay) run(ctx context.Context) {
+	defer close(r.done)
+
+	log.Printf("Outbox relay: Running (poll every %s, batch size %d)", r.pollInterval, r.batchSize)
+
+	var backoff time.Duration
+	lastCleanup := time.Now()
+	for {
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			r.deleteSentEvents()
+			lastCleanup = time.Now()
+		}
+
+		wait := r.pollInterval
+		sent, err := r.relayBatch()
+		switch {
+		case err != nil:
+			backoff = nextOutboxBackoff(backoff, r.pollInterval, r.maxBackoff)
+			wait = backoff
+			log.Printf("Outbox relay: Failed to relay events (%d sent), retrying in %s: %v", sent, backoff, err)
+		case sent == r.batchSize:
+			// Còn sự kiện đang chờ, gửi lô tiếp theo ngay
+			backoff = 0
+			wait = 0
+		default:
+			backoff = 0
+		}
+
+		// Đang backoff thì bỏ qua Notify để không dồn dập thử lại khi bus đang lỗi
+		wake := r.wake
+		if backoff > 0 {
+			wake = nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Printf("Outbox relay: Stopped")
+			return
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// relayBatch publish một lô sự kiện đang chờ, dừng ở sự kiện lỗi đầu tiên để giữ thứ tự.
+// Không dùng ctx của relay để Stop không cắt ngang lô giữa lúc đã publish mà chưa kịp đánh
+// dấu đã gửi.
+func (r *OutboxRelay) relayBatch() (int, error) {
+	ctx := context.Background()
+
+	release, acquired, err := r.store.AcquireRelayLock(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire outbox relay lock: %w", err)
+	}
+	if !acquired {
+		return 0, nil
+	}
+	defer release()
+
+	events, err := r.store.FindPendingEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find pending outbox events: %w", err)
+	}
+
+	sent := 0
+	for _, event := range events {
+		if err := r.publish(event); err != nil {
+			r.recordFailedAttempt(ctx, event, err)
+			return sent, err
+		}
+
+		if err := r.store.MarkEventSent(ctx, event.ID, time.Now().UTC()); err != nil {
+			// Sự kiện sẽ được gửi lại ở lô sau, dừng để không gửi tiếp khi DB đang lỗi
+			return sent, fmt.Errorf("failed to mark outbox event %d as sent: %w", event.ID, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func (r *OutboxRelay) publish(event *domain.OutboxEvent) error {
+	var mqEvent kafkainfra.MQEvent
+	if err := json.Unmarshal(event.Payload, &mqEvent); err != nil {
+		return fmt.Errorf("failed to unmarshal outbox event %d: %w", event.ID, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), outboxPublishTimeout)
+	defer cancel()
+
+	if err := r.bus.PublishChatEvent(ctx, &mqEvent); err != nil {
+		return fmt.Errorf("failed to publish outbox event %d (%s, attempt %d): %w", event.ID, event.EventType, event.Attempts+1, err)
+	}
+	return nil
+}
+
+// recordFailedAttempt tăng số lần thử của sự kiện, hết số lần thử thì chuyển FAILED để relay bỏ qua
+func (r *OutboxRelay) recordFailedAttempt(ctx context.Context, event *domain.OutboxEvent, publishErr error) {
+	event.Attempts++
+	event.LastError = publishErr.Error()
+	if event.Attempts >= r.maxAttempts {
+		event.Status = domain.OutboxEventFailed
+		log.Printf("Outbox relay: Giving up on event %d (%s) after %d attempts", event.ID, event.EventType, event.Attempts)
+	}
+
+	if err := r.store.RecordFailedAttempt(ctx, event); err != nil {
+		log.Printf("Outbox relay: Failed to record attempt of event %d: %v", event.ID, err)
+	}
+}
+
+// nextOutboxBackoff nhân đôi thời gian chờ sau mỗi lần lỗi liên tiếp, bắt đầu từ pollInterval
+// và không vượt quá maxBackoff
+func nextOutboxBackoff(current, pollInterval, maxBackoff time.Duration) time.Duration {
+	return min(max(current*2, pollInterval), maxBackoff)
+}
+
+// deleteSentEvents xóa theo lô các sự kiện đã gửi quá thời gian lưu giữ
+func (r *OutboxRelay) deleteSentEvents() {
+	before := time.Now().UTC().Add(-r.sentRetention)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), outboxPublishTimeout)
+		deleted, err := r.store.DeleteSentEvents(ctx, before, outboxCleanupBatchSize)
+		cancel()
+
+		if err != nil {
+			log.Printf("Outbox relay: Failed to delete sent events: %v", err)
+			return
+		}
+		if deleted < outboxCleanupBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,255 @@
+//go:build unit
+// +build unit
+
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gochat-backend/config"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOutboxStore giữ outbox_events trong bộ nhớ, trả về bản sao như khi đọc từ DB
+type fakeOutboxStore struct {
+	mutex  sync.Mutex
+	events []*domain.OutboxEvent
+	locked bool
+}
+
+func newFakeOutboxStore(t *testing.T, count int) *fakeOutboxStore {
+	store := &fakeOutboxStore{}
+	for id := int64(1); id <= int64(count); id++ {
+		payload, err := json.Marshal(&kafkainfra.MQEvent{
+			EventType:  kafkainfra.MessageSent,
+			ChatRoomID: "room-1",
+			SenderID:   fmt.Sprintf("event-%d", id),
+		})
+		require.NoError(t, err)
+
+		store.events = append(store.events, &domain.OutboxEvent{
+			ID:        id,
+			EventType: string(kafkainfra.MessageSent),
+			Payload:   payload,
+			Status:    domain.OutboxEventPending,
+		})
+	}
+	return store
+}
+
+func (s *fakeOutboxStore) AcquireRelayLock(ctx context.Context) (func(), bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.locked {
+		return nil, false, nil
+	}
+	s.locked = true
+	return func() {
+		s.mutex.Lock()
+		s.locked = false
+		s.mutex.Unlock()
+	}, true, nil
+}
+
+func (s *fakeOutboxStore) FindPendingEvents(ctx context.Context, limit int) ([]*domain.OutboxEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var pending []*domain.OutboxEvent
+	for _, event := range s.events {
+		if event.Status == domain.OutboxEventPending && len(pending) < limit {
+			copied := *event
+			pending = append(pending, &copied)
+		}
+	}
+	return pending, nil
+}
+
+func (s *fakeOutboxStore) MarkEventSent(ctx context.Context, eventID int64, sentAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	event := s.find(eventID)
+	event.Status = domain.OutboxEventSent
+	event.SentAt = &sentAt
+	return nil
+}
+
+func (s *fakeOutboxStore) RecordFailedAttempt(ctx context.Context, failed *domain.OutboxEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	event := s.find(failed.ID)
+	event.Attempts = failed.Attempts
+	event.LastError = failed.LastError
+	event.Status = failed.Status
+	return nil
+}
+
+func (s *fakeOutboxStore) DeleteSentEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeOutboxStore) find(eventID int64) *domain.OutboxEvent {
+	for _, event := range s.events {
+		if event.ID == eventID {
+			return event
+		}
+	}
+	return nil
+}
+
+func (s *fakeOutboxStore) event(eventID int64) domain.OutboxEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return *s.find(eventID)
+}
+
+// fakeBus ghi lại thứ tự sự kiện đã publish, lỗi với các sự kiện nằm trong failing
+type fakeBus struct {
+	EventBus
+	published []string
+	failing   map[string]bool
+}
+
+func (b *fakeBus) PublishChatEvent(ctx context.Context, event *kafkainfra.MQEvent) error {
+	if b.failing[event.SenderID] {
+		return errors.New("broker unavailable")
+	}
+	b.published = append(b.published, event.SenderID)
+	return nil
+}
+
+func newTestOutboxRelay(store OutboxStore, bus EventBus, maxAttempts int) *OutboxRelay {
+	return NewOutboxRelay(store, bus, &config.Environment{
+		OutboxRelayBatchSize:   10,
+		OutboxRelayMaxAttempts: maxAttempts,
+	})
+}
+
+func TestOutboxRelayPublishesInOrderAndMarksSent(t *testing.T) {
+	store := newFakeOutboxStore(t, 3)
+	bus := &fakeBus{}
+	relay := newTestOutboxRelay(store, bus, 3)
+
+	sent, err := relay.relayBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 3, sent)
+	assert.Equal(t, []string{"event-1", "event-2", "event-3"}, bus.published)
+	for id := int64(1); id <= 3; id++ {
+		assert.Equal(t, domain.OutboxEventSent, store.event(id).Status)
+	}
+
+	// Sự kiện đã gửi không bị gửi lại
+	sent, err = relay.relayBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Len(t, bus.published, 3)
+}
+
+func TestOutboxRelayStopsAtFirstError(t *testing.T) {
+	store := newFakeOutboxStore(t, 3)
+	bus := &fakeBus{failing: map[string]bool{"event-2": true}}
+	relay := newTestOutboxRelay(store, bus, 3)
+
+	sent, err := relay.relayBatch()
+	require.Error(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"event-1"}, bus.published, "event-3 must not overtake the failed event-2")
+
+	failed := store.event(2)
+	assert.Equal(t, domain.OutboxEventPending, failed.Status)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Contains(t, failed.LastError, "broker unavailable")
+	assert.Equal(t, domain.OutboxEventPending, store.event(3).Status)
+	assert.Equal(t, 0, store.event(3).Attempts)
+}
+
+func TestOutboxRelayRetriesAfterBusRecovers(t *testing.T) {
+	store := newFakeOutboxStore(t, 2)
+	bus := &fakeBus{failing: map[string]bool{"event-1": true}}
+	relay := newTestOutboxRelay(store, bus, 3)
+
+	_, err := relay.relayBatch()
+	require.Error(t, err)
+	assert.Empty(t, bus.published)
+
+	bus.failing = nil
+	sent, err := relay.relayBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, []string{"event-1", "event-2"}, bus.published)
+	assert.Equal(t, 1, store.event(1).Attempts)
+	assert.Equal(t, domain.OutboxEventSent, store.event(1).Status)
+}
+
+func TestOutboxRelayMarksFailedAfterMaxAttempts(t *testing.T) {
+	store := newFakeOutboxStore(t, 2)
+	bus := &fakeBus{failing: map[string]bool{"event-1": true}}
+	relay := newTestOutboxRelay(store, bus, 3)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		_, err := relay.relayBatch()
+		require.Error(t, err)
+		assert.Empty(t, bus.published)
+	}
+	assert.Equal(t, domain.OutboxEventFailed, store.event(1).Status)
+	assert.Equal(t, 3, store.event(1).Attempts)
+
+	// Sự kiện FAILED bị bỏ qua, các sự kiện sau nó được gửi tiếp
+	sent, err := relay.relayBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"event-2"}, bus.published)
+}
+
+func TestOutboxRelaySkipsWhileAnotherRelayHoldsLock(t *testing.T) {
+	store := newFakeOutboxStore(t, 1)
+	bus := &fakeBus{}
+	relay := newTestOutboxRelay(store, bus, 3)
+
+	release, acquired, err := store.AcquireRelayLock(context.Background())
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	sent, err := relay.relayBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	assert.Empty(t, bus.published)
+
+	release()
+	sent, err = relay.relayBatch()
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+}
+
+func TestNextOutboxBackoff(t *testing.T) {
+	poll := 500 * time.Millisecond
+	maxBackoff := 3 * time.Second
+
+	backoff := time.Duration(0)
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		backoff = nextOutboxBackoff(backoff, poll, maxBackoff)
+		got = append(got, backoff)
+	}
+
+	assert.Equal(t, []time.Duration{
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+		3 * time.Second,
+		3 * time.Second,
+	}, got)
+}
@@ -0,0 +1,96 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/infra/redisinfra"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisEventBus phát sự kiện qua Redis Pub/Sub. Pub/Sub không lưu lại sự kiện: instance
+// đang mất kết nối tới Redis sẽ lỡ sự kiện. Khi subscribe lại được, consumer gọi handler với
+// sự kiện DeliveryGap để instance báo client RESUME bù phần đã lỡ.
+type RedisEventBus struct {
+	redisService redisinfra.RedisService
+	channel      string
+}
+
+func NewRedisEventBus(redisService redisinfra.RedisService, channel string) *RedisEventBus {
+	return &RedisEventBus{
+		redisService: redisService,
+		channel:      channel,
+	}
+}
+
+func (b *RedisEventBus) PublishChatEvent(ctx context.Context, event *kafkainfra.MQEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := b.redisService.Publish(ctx, b.channel, eventBytes); err != nil {
+		return fmt.Errorf("failed to publish event to Redis channel %s: %w", b.channel, err)
+	}
+	return nil
+}
+
+func (b *RedisEventBus) StartChatConsumer(ctx context.Context, eventHandler func(*kafkainfra.MQEvent) error) error {
+	pubsub := b.redisService.Subscribe(ctx, b.channel)
+	defer pubsub.Close()
+
+	// Chờ Redis xác nhận subscribe để không lỡ sự kiện publish ngay sau khi hàm này chạy
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to Redis channel %s: %w", b.channel, err)
+	}
+	log.Printf("Redis event bus: Subscribed to channel %s", b.channel)
+
+	// Kèm cả xác nhận subscribe: sau lần đầu ở trên, xác nhận chỉ tới khi go-redis tự kết nối
+	// và subscribe lại, tức là có một khoảng không nhận được sự kiện
+	messages := pubsub.ChannelWithSubscriptions()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case received, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("redis channel %s closed", b.channel)
+			}
+
+			message, isMessage := received.(*redis.Message)
+			if !isMessage {
+				if subscription, ok := received.(*redis.Subscription); ok && subscription.Kind == "subscribe" {
+					log.Printf("Redis event bus: Resubscribed to channel %s, events in between may be lost", b.channel)
+					gap := &kafkainfra.MQEvent{EventType: kafkainfra.DeliveryGap, Timestamp: time.Now().UTC()}
+					if err := eventHandler(gap); err != nil {
+						log.Printf("Redis event bus: Failed to handle delivery gap: %v", err)
+					}
+				}
+				continue
+			}
+
+			var event kafkainfra.MQEvent
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				log.Printf("Redis event bus: Failed to unmarshal event: %v", err)
+				continue
+			}
+
+			if err := eventHandler(&event); err != nil {
+				log.Printf("Redis event bus: Failed to handle event %s: %v", event.EventType, err)
+			}
+		}
+	}
+}
+
+// Close không đóng kết nối Redis vì RedisService được dùng chung
+func (b *RedisEventBus) Close() error {
+	return nil
+}
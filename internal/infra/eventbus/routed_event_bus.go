@@ -0,0 +1,113 @@
+package eventbus
+
+import (
+	"context"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/infra/redisinfra"
+	"log"
+	"time"
+)
+
+// RecipientResolver trả về các user cần nhận sự kiện. ok=false nghĩa là sự kiện không gắn
+// với danh sách user cụ thể và phải được phát tới mọi instance.
+type RecipientResolver func(ctx context.Context, event *kafkainfra.MQEvent) (userIDs []string, ok bool, err error)
+
+// InstanceLocator tìm các instance đang giữ kết nối của user (instanceID -> userIDs)
+type InstanceLocator interface {
+	FindUserInstances(ctx context.Context, userIDs []string) (map[string][]string, error)
+}
+
+// RoutedEventBus chỉ gửi sự kiện tới các instance có người nhận đang kết nối thay vì phát
+// cho mọi instance. Mỗi instance nghe một Redis channel riêng; bản sao gửi tới instance mang
+// TargetUserIDs là người nhận trên instance đó nên instance nhận không phải tra lại danh sách.
+// Sự kiện không xác định được người nhận, hoặc khi tra registry lỗi, vẫn đi qua bus gốc
+// và mọi instance tự lọc như trước.
+//
+// Channel riêng là Redis Pub/Sub nên sự kiện được định tuyến không được đảm bảo giao như
+// khi đi qua outbox và Kafka: đảm bảo dừng ở lệnh PUBLISH, instance đang mất subscription
+// sẽ lỡ sự kiện (kể cả NEW_MESSAGE). Khi subscribe lại, channel riêng sinh DeliveryGap để
+// instance yêu cầu các client đang kết nối RESUME lấy lại phần bị lỡ.
+type RoutedEventBus struct {
+	EventBus // Bus gốc cho sự kiện phát tới mọi instance
+
+	redisService  redisinfra.RedisService
+	locator       InstanceLocator
+	resolve       RecipientResolver
+	channelPrefix string
+	inbox         *RedisEventBus // Channel riêng của instance hiện tại
+}
+
+func NewRoutedEventBus(
+	bus EventBus,
+	redisService redisinfra.RedisService,
+	locator InstanceLocator,
+	resolve RecipientResolver,
+	instanceID string,
+	channelPrefix string,
+) *RoutedEventBus {
+	return &RoutedEventBus{
+		EventBus:      bus,
+		redisService:  redisService,
+		locator:       locator,
+		resolve:       resolve,
+		channelPrefix: channelPrefix,
+		inbox:         NewRedisEventBus(redisService, channelPrefix+instanceID),
+	}
+}
+
+func (b *RoutedEventBus) PublishChatEvent(ctx context.Context, event *kafkainfra.MQEvent) error {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	recipients, ok, err := b.resolve(ctx, event)
+	if err != nil {
+		log.Printf("Routed event bus: Failed to resolve recipients of %s, broadcasting instead: %v", event.EventType, err)
+		return b.EventBus.PublishChatEvent(ctx, event)
+	}
+	if !ok {
+		return b.EventBus.PublishChatEvent(ctx, event)
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	usersByInstance, err := b.locator.FindUserInstances(ctx, recipients)
+	if err != nil {
+		log.Printf("Routed event bus: Failed to locate recipients of %s, broadcasting instead: %v", event.EventType, err)
+		return b.EventBus.PublishChatEvent(ctx, event)
+	}
+
+	// Người nhận không online ở instance nào: tin đã lưu DB, client lấy lại khi kết nối
+	var firstErr error
+	for instanceID, userIDs := range usersByInstance {
+		routed := *event
+		routed.TargetUserIDs = userIDs
+
+		outbox := RedisEventBus{redisService: b.redisService, channel: b.channelPrefix + instanceID}
+		if err := outbox.PublishChatEvent(ctx, &routed); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// StartChatConsumer nghe đồng thời bus gốc và channel riêng của instance.
+// Khi một trong hai dừng thì dừng cả hai và trả về lỗi của nguồn dừng trước.
+func (b *RoutedEventBus) StartChatConsumer(ctx context.Context, eventHandler func(*kafkainfra.MQEvent) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- b.EventBus.StartChatConsumer(ctx, eventHandler)
+	}()
+	go func() {
+		errs <- b.inbox.StartChatConsumer(ctx, eventHandler)
+	}()
+
+	err := <-errs
+	cancel()
+	<-errs
+	return err
+}
@@ -3,11 +3,22 @@ package kafkainfra
 type MQEventType string
 
 const (
-	MessageSent    MQEventType = "message_sent"
-	TypingStarted  MQEventType = "typing_started"
-	TypingStopped  MQEventType = "typing_stopped"
-	UserOnline     MQEventType = "user_online"
-	UserOffline    MQEventType = "user_offline"
-	UserJoinedRoom MQEventType = "user_joined_room"
-	UserLeftRoom   MQEventType = "user_left_room"
+	MessageSent       MQEventType = "message_sent"
+	TypingStarted     MQEventType = "typing_started"
+	TypingStopped     MQEventType = "typing_stopped"
+	UserOnline        MQEventType = "user_online"
+	UserOffline       MQEventType = "user_offline"
+	UserJoinedRoom    MQEventType = "user_joined_room"
+	UserLeftRoom      MQEventType = "user_left_room"
+	MessageEdited     MQEventType = "message_edited"
+	MessageDeleted    MQEventType = "message_deleted"
+	ReactionAdded     MQEventType = "reaction_added"
+	ReactionRemoved   MQEventType = "reaction_removed"
+	MessageRead       MQEventType = "message_read"
+	UserStatusChanged MQEventType = "user_status_changed"
+	MembershipChanged MQEventType = "membership_changed"
+
+	// DeliveryGap không được publish: bus tự sinh ra cho handler của instance khi subscribe
+	// lại sau khi mất kết nối, sự kiện gửi tới trong khoảng đó có thể đã bị lỡ
+	DeliveryGap MQEventType = "delivery_gap"
 )
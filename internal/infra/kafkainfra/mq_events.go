@@ -16,6 +16,14 @@ type MQEvent struct {
 	SenderID   string          `json:"sender_id"`
 	Timestamp  time.Time       `json:"timestamp"`
 	Metadata   json.RawMessage `json:"metadata"`
+
+	// Seq là seq trong phòng của sự kiện (tin nhắn mới, sửa, thu hồi, reaction, đã đọc),
+	// 0 với sự kiện không được ghi vào phòng như typing hay presence
+	Seq int64 `json:"seq,omitempty"`
+
+	// TargetUserIDs chỉ có khi sự kiện được định tuyến tới một instance cụ thể:
+	// các user nhận sự kiện đang có kết nối trên instance đó
+	TargetUserIDs []string `json:"target_user_ids,omitempty"`
 }
 
 type MQEventProducer struct {
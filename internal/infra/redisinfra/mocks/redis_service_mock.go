@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -21,6 +22,19 @@ func (m *MockRedisService) Get(ctx context.Context, key string, dest interface{}
 	return args.Error(0)
 }
 
+func (m *MockRedisService) GetDel(ctx context.Context, key string, dest interface{}) error {
+	args := m.Called(ctx, key, dest)
+	return args.Error(0)
+}
+
+func (m *MockRedisService) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	args := m.Called(ctx, keys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([][]byte), args.Error(1)
+}
+
 func (m *MockRedisService) Delete(ctx context.Context, key string) error {
 	args := m.Called(ctx, key)
 	return args.Error(0)
@@ -30,3 +44,52 @@ func (m *MockRedisService) FlushAll(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
 }
+
+func (m *MockRedisService) AllowTokenBucket(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, error) {
+	args := m.Called(ctx, key, ratePerSecond, burst)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRedisService) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	args := m.Called(ctx, key, expiration)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRedisService) Publish(ctx context.Context, channel string, message []byte) error {
+	args := m.Called(ctx, channel, message)
+	return args.Error(0)
+}
+
+func (m *MockRedisService) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	args := m.Called(ctx, channels)
+	if args.Get(0) == nil {
+		return nil
+	}
+	return args.Get(0).(*redis.PubSub)
+}
+
+func (m *MockRedisService) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	args := m.Called(ctx, key, members)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRedisService) SRem(ctx context.Context, key string, members ...string) error {
+	args := m.Called(ctx, key, members)
+	return args.Error(0)
+}
+
+func (m *MockRedisService) SMembers(ctx context.Context, key string) ([]string, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRedisService) SMembersMany(ctx context.Context, keys []string) ([][]string, error) {
+	args := m.Called(ctx, keys)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([][]string), args.Error(1)
+}
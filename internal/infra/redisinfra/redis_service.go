@@ -13,10 +13,62 @@ import (
 type RedisService interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string, dest interface{}) error
+	// GetDel đọc rồi xóa key một cách nguyên tử, dùng cho giá trị chỉ được dùng một lần.
+	// Trả về redis.Nil nếu key không tồn tại.
+	GetDel(ctx context.Context, key string, dest interface{}) error
+	// MGet đọc nhiều key trong một round-trip. Kết quả cùng thứ tự với keys,
+	// phần tử nil nghĩa là key không tồn tại. Giá trị là JSON như Set đã ghi.
+	MGet(ctx context.Context, keys []string) ([][]byte, error)
 	Delete(ctx context.Context, key string) error
 	FlushAll(ctx context.Context) error
+
+	// AllowTokenBucket lấy một token từ bucket tại key (nạp lại ratePerSecond token/giây,
+	// tối đa burst token). Trả về false nếu bucket đã hết token.
+	AllowTokenBucket(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, error)
+	// Increment tăng counter tại key và đặt TTL khi counter vừa được tạo
+	Increment(ctx context.Context, key string, expiration time.Duration) (int64, error)
+
+	// Publish gửi message (đã mã hóa) tới mọi subscriber của channel
+	Publish(ctx context.Context, channel string, message []byte) error
+	// Subscribe đăng ký nhận message của các channel, caller phải Close PubSub khi xong
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+
+	// SAdd thêm member vào set, trả về số member mới được thêm
+	SAdd(ctx context.Context, key string, members ...string) (int64, error)
+	SRem(ctx context.Context, key string, members ...string) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+	// SMembersMany đọc nhiều set trong một pipeline, kết quả cùng thứ tự với keys
+	SMembersMany(ctx context.Context, keys []string) ([][]string, error)
 }
 
+// tokenBucketScript nạp lại và lấy token một cách nguyên tử; thời gian lấy từ Redis
+// để mọi instance dùng chung một đồng hồ
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+return allowed
+`)
+
 type redisService struct {
 	client *redis.Client
 }
@@ -57,6 +109,48 @@ func (r *redisService) Get(ctx context.Context, key string, dest interface{}) er
 	return json.Unmarshal(data, dest)
 }
 
+func (r *redisService) GetDel(ctx context.Context, key string, dest interface{}) error {
+	data, err := r.client.GetDel(ctx, key).Bytes()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, dest)
+}
+
+// mgetChunkSize giới hạn số key trong một lệnh MGET để không chặn Redis quá lâu;
+// các lệnh MGET được gửi chung trong một pipeline
+const mgetChunkSize = 200
+
+func (r *redisService) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.SliceCmd, 0, (len(keys)+mgetChunkSize-1)/mgetChunkSize)
+	for start := 0; start < len(keys); start += mgetChunkSize {
+		end := min(start+mgetChunkSize, len(keys))
+		cmds = append(cmds, pipe.MGet(ctx, keys[start:end]...))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, 0, len(keys))
+	for _, cmd := range cmds {
+		for _, value := range cmd.Val() {
+			switch v := value.(type) {
+			case string:
+				values = append(values, []byte(v))
+			default:
+				values = append(values, nil)
+			}
+		}
+	}
+	return values, nil
+}
+
 func (r *redisService) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
@@ -64,3 +158,75 @@ func (r *redisService) Delete(ctx context.Context, key string) error {
 func (r *redisService) FlushAll(ctx context.Context) error {
 	return r.client.FlushAll(ctx).Err()
 }
+
+func (r *redisService) AllowTokenBucket(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, error) {
+	// Script tính TTL bằng burst / rate, rate hoặc burst không dương sẽ làm key không bao giờ hết hạn
+	if !(ratePerSecond > 0) || burst <= 0 {
+		return false, fmt.Errorf("invalid token bucket for %s: rate %v per second, burst %d", key, ratePerSecond, burst)
+	}
+
+	allowed, err := tokenBucketScript.Run(ctx, r.client, []string{key}, ratePerSecond, burst).Int()
+	if err != nil {
+		return false, err
+	}
+	return allowed == 1, nil
+}
+
+func (r *redisService) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (r *redisService) Publish(ctx context.Context, channel string, message []byte) error {
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+func (r *redisService) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return r.client.Subscribe(ctx, channels...)
+}
+
+func (r *redisService) SAdd(ctx context.Context, key string, members ...string) (int64, error) {
+	return r.client.SAdd(ctx, key, toInterfaces(members)...).Result()
+}
+
+func (r *redisService) SRem(ctx context.Context, key string, members ...string) error {
+	return r.client.SRem(ctx, key, toInterfaces(members)...).Err()
+}
+
+func (r *redisService) SMembers(ctx context.Context, key string) ([]string, error) {
+	return r.client.SMembers(ctx, key).Result()
+}
+
+func (r *redisService) SMembersMany(ctx context.Context, keys []string) ([][]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, 0, len(keys))
+	for _, key := range keys {
+		cmds = append(cmds, pipe.SMembers(ctx, key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	members := make([][]string, 0, len(keys))
+	for _, cmd := range cmds {
+		members = append(members, cmd.Val())
+	}
+	return members, nil
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
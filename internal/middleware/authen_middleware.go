@@ -13,10 +13,9 @@ func (m *middleware) Authentication(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
 	var tokenString string
 
+	// Chỉ nhận access token qua header; route cần xác thực từ URL (/ws, /events) dùng ticket dùng một lần
 	if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
 		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-	} else {
-		tokenString = c.Query("token")
 	}
 
 	if tokenString == "" {
@@ -8,6 +8,7 @@ import (
 	domain "gochat-backend/internal/domain/chat"
 	"gochat-backend/internal/infra/mysqlinfra"
 	"gochat-backend/internal/infra/redisinfra"
+	"strings"
 	"time"
 )
 
@@ -24,7 +25,10 @@ type ChatRoomRepository interface {
 	FindChatRoomByID(ctx context.Context, chatRoomID string) (*domain.ChatRoom, error)
 	FindChatRoomsByUserID(ctx context.Context, userID string, limit, offset int) ([]*domain.ChatRoom, error)
 	FindPrivateChatRoom(ctx context.Context, userID1, userID2 string) (*domain.ChatRoom, error)
+	FindPrivateChatPartnerIDs(ctx context.Context, userID string) ([]string, error)
+	FindUserIDsSharingRoom(ctx context.Context, userID string, candidateIDs []string) ([]string, error)
 	UpdateLastMessage(ctx context.Context, chatRoomID string, message *domain.Message) error
+	FindLastSeq(ctx context.Context, chatRoomID string) (int64, error)
 	DeleteChatRoom(ctx context.Context, chatRoomID string) error
 
 	AddChatRoomMember(ctx context.Context, member *domain.ChatRoomMember) error
@@ -32,6 +36,9 @@ type ChatRoomRepository interface {
 	FindChatRoomMembers(ctx context.Context, chatRoomID string) ([]*domain.ChatRoomMember, error)
 	RemoveChatRoomMember(ctx context.Context, chatRoomID, userID string) error
 	RemoveAllChatRoomMembers(ctx context.Context, chatRoomID string) error
+
+	UpdateLastReadMessage(ctx context.Context, chatRoomID, userID, messageID string, messageCreatedAt time.Time, event *domain.RoomEvent) (bool, error)
+	FindReadStates(ctx context.Context, userID string, chatRoomIDs []string) (map[string]*domain.ChatRoomReadState, error)
 }
 
 type chatRoomRepo struct {
@@ -218,6 +225,72 @@ func (r *chatRoomRepo) FindPrivateChatRoom(ctx context.Context, userID1, userID2
 	return r.FindChatRoomByID(ctx, chatRoomID)
 }
 
+// FindPrivateChatPartnerIDs returns the other members of every private room the user belongs to
+func (r *chatRoomRepo) FindPrivateChatPartnerIDs(ctx context.Context, userID string) ([]string, error) {
+	query := `
+        SELECT DISTINCT crm2.user_id
+        FROM chat_rooms cr
+        JOIN chat_room_members crm1 ON cr.id = crm1.chat_room_id
+        JOIN chat_room_members crm2 ON cr.id = crm2.chat_room_id
+        WHERE cr.type = 'PRIVATE'
+        AND crm1.user_id = ?
+        AND crm2.user_id <> ?
+    `
+
+	rows, err := r.database.DB.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partnerIDs []string
+	for rows.Next() {
+		var partnerID string
+		if err := rows.Scan(&partnerID); err != nil {
+			return nil, err
+		}
+		partnerIDs = append(partnerIDs, partnerID)
+	}
+	return partnerIDs, rows.Err()
+}
+
+// FindUserIDsSharingRoom returns the candidates that are members of at least one room with the user
+func (r *chatRoomRepo) FindUserIDsSharingRoom(ctx context.Context, userID string, candidateIDs []string) ([]string, error) {
+	if len(candidateIDs) == 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+        SELECT DISTINCT crm2.user_id
+        FROM chat_room_members crm1
+        JOIN chat_room_members crm2 ON crm1.chat_room_id = crm2.chat_room_id
+        WHERE crm1.user_id = ?
+        AND crm2.user_id IN (%s)
+    `, strings.TrimSuffix(strings.Repeat("?,", len(candidateIDs)), ","))
+
+	args := make([]interface{}, 0, len(candidateIDs)+1)
+	args = append(args, userID)
+	for _, id := range candidateIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberIDs []string
+	for rows.Next() {
+		var memberID string
+		if err := rows.Scan(&memberID); err != nil {
+			return nil, err
+		}
+		memberIDs = append(memberIDs, memberID)
+	}
+	return memberIDs, rows.Err()
+}
+
 // UpdateLastMessage updates the last message reference for a chat room
 func (r *chatRoomRepo) UpdateLastMessage(ctx context.Context, chatRoomID string, message *domain.Message) error {
 	// Since we're retrieving the last message based on the most recent timestamp,
@@ -234,6 +307,21 @@ func (r *chatRoomRepo) UpdateLastMessage(ctx context.Context, chatRoomID string,
 	return nil
 }
 
+// FindLastSeq lấy seq của tin nhắn mới nhất trong phòng, luôn đọc từ DB (không cache)
+func (r *chatRoomRepo) FindLastSeq(ctx context.Context, chatRoomID string) (int64, error) {
+	query := `SELECT last_seq FROM chat_rooms WHERE id = ?`
+
+	var lastSeq int64
+	if err := r.database.DB.QueryRowContext(ctx, query, chatRoomID).Scan(&lastSeq); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return lastSeq, nil
+}
+
 // DeleteChatRoom deletes a chat room by its ID
 func (r *chatRoomRepo) DeleteChatRoom(ctx context.Context, chatRoomID string) error {
 	// ... (code xóa DB giữ nguyên)
@@ -370,30 +458,108 @@ func (r *chatRoomRepo) RemoveAllChatRoomMembers(ctx context.Context, chatRoomID
 	return nil
 }
 
+// UpdateLastReadMessage chuyển vị trí đã đọc của user tới messageID. Vị trí chỉ tiến lên:
+// nếu user đã đọc tới một tin nhắn mới hơn thì không cập nhật và trả về false. Chỉ khi vị trí
+// tiến lên, event khác nil mới được cấp seq và ghi vào nhật ký của phòng trong cùng transaction.
+func (r *chatRoomRepo) UpdateLastReadMessage(ctx context.Context, chatRoomID, userID, messageID string, messageCreatedAt time.Time, event *domain.RoomEvent) (bool, error) {
+	query := `
+        UPDATE chat_room_members
+        SET last_read_message_id = ?, last_read_at = ?
+        WHERE chat_room_id = ? AND user_id = ?
+        AND (last_read_at IS NULL OR last_read_at < ?)
+    `
+
+	advanced := false
+	err := r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, messageID, messageCreatedAt, chatRoomID, userID, messageCreatedAt)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+
+		advanced = true
+		return insertRoomEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return advanced, nil
+}
+
+// FindReadStates lấy vị trí đã đọc và số tin chưa đọc của user cho nhiều phòng trong một query.
+// Tin chưa đọc là tin của người khác, chưa bị thu hồi hay ẩn, gửi sau vị trí đã đọc
+// (hoặc sau thời điểm tham gia nếu user chưa đọc gì).
+func (r *chatRoomRepo) FindReadStates(ctx context.Context, userID string, chatRoomIDs []string) (map[string]*domain.ChatRoomReadState, error) {
+	result := make(map[string]*domain.ChatRoomReadState, len(chatRoomIDs))
+	if len(chatRoomIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(chatRoomIDs)), ",")
+	query := `
+        SELECT crm.chat_room_id, crm.last_read_message_id, crm.last_read_at,
+            (
+                SELECT COUNT(*) FROM messages m
+                WHERE m.chat_room_id = crm.chat_room_id
+                AND m.sender_id <> crm.user_id
+                AND m.deleted_at IS NULL
+                AND m.created_at > COALESCE(crm.last_read_at, crm.joined_at)
+                AND NOT EXISTS (
+                    SELECT 1 FROM message_hidden_for_users h
+                    WHERE h.message_id = m.id AND h.user_id = crm.user_id
+                )
+            ) AS unread_count
+        FROM chat_room_members crm
+        WHERE crm.user_id = ? AND crm.chat_room_id IN (` + placeholders + `)
+    `
+
+	args := make([]any, 0, len(chatRoomIDs)+1)
+	args = append(args, userID)
+	for _, id := range chatRoomIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		state := domain.ChatRoomReadState{UserId: userID}
+		var lastReadMessageID sql.NullString
+		var lastReadAt sql.NullTime
+
+		if err := rows.Scan(&state.ChatRoomId, &lastReadMessageID, &lastReadAt, &state.UnreadCount); err != nil {
+			return nil, err
+		}
+
+		state.LastReadMessageId = lastReadMessageID.String
+		if lastReadAt.Valid {
+			state.LastReadAt = &lastReadAt.Time
+		}
+		result[state.ChatRoomId] = &state
+	}
+
+	return result, rows.Err()
+}
+
 // getLastMessage retrieves the last message for a chat room
 func (r *chatRoomRepo) getLastMessage(ctx context.Context, chatRoomID string) (*domain.Message, error) {
 	query := `
-        SELECT id, sender_id, chat_room_id, type, mime_type, content, created_at
+        SELECT ` + messageSelectColumns + `
         FROM messages
         WHERE chat_room_id = ?
         ORDER BY created_at DESC
         LIMIT 1
     `
 
-	var message domain.Message
-	var messageType string
-
-	err := r.database.DB.QueryRowContext(ctx, query, chatRoomID).
-		Scan(
-			&message.ID,
-			&message.SenderId,
-			&message.ChatRoomId,
-			&messageType,
-			&message.MimeType,
-			&message.Content,
-			&message.CreatedAt,
-		)
-
+	message, err := scanMessage(r.database.DB.QueryRowContext(ctx, query, chatRoomID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -401,8 +567,7 @@ func (r *chatRoomRepo) getLastMessage(ctx context.Context, chatRoomID string) (*
 		return nil, err
 	}
 
-	message.Type = domain.MessageType(messageType)
-	return &message, nil
+	return message, nil
 }
 
 func (r *chatRoomRepo) generateChatRoomsListCacheKey(userID string, limit, offset int) string {
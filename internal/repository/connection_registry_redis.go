@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"gochat-backend/internal/infra/redisinfra"
+	"log"
+	"time"
+)
+
+const (
+	connRegistryUserKeyPrefix          = "conn_registry:user:"           // Set instanceID đang giữ kết nối của user
+	connRegistryInstanceUsersKeyPrefix = "conn_registry:instance_users:" // Set userID có kết nối trên instance
+	connRegistryHeartbeatKeyPrefix     = "conn_registry:heartbeat:"      // Còn tồn tại khi instance còn sống
+	connRegistryInstancesKey           = "conn_registry:instances"       // Set mọi instance đã đăng ký
+)
+
+// ConnectionRegistry ghi nhận instance nào đang giữ kết nối realtime của user để sự kiện
+// chỉ được gửi tới các instance cần nó. Instance gia hạn heartbeat định kỳ; instance
+// bị crash không gia hạn nữa và các instance còn lại dọn dữ liệu của nó.
+type ConnectionRegistry interface {
+	// AddUser ghi nhận user có kết nối trên instance
+	AddUser(ctx context.Context, instanceID, userID string) error
+	// RemoveUser xóa user khỏi instance khi kết nối cuối cùng của user trên instance đóng
+	RemoveUser(ctx context.Context, instanceID, userID string) error
+
+	// Heartbeat gia hạn instance thêm ttl. Trả về true nếu instance chưa có trong registry
+	// (lần đầu chạy hoặc đã bị dọn nhầm), khi đó instance cần đăng ký lại user của mình.
+	Heartbeat(ctx context.Context, instanceID string, ttl time.Duration) (bool, error)
+	// RemoveInstance xóa toàn bộ dữ liệu của instance (khi shutdown)
+	RemoveInstance(ctx context.Context, instanceID string) error
+	// CleanupDeadInstances dọn dữ liệu của các instance đã hết heartbeat, trả về các instance bị dọn
+	CleanupDeadInstances(ctx context.Context) ([]string, error)
+
+	// FindUserInstances trả về map instanceID -> userID có kết nối trên instance đó.
+	// Instance đã hết heartbeat bị bỏ qua kể cả khi chưa được dọn.
+	FindUserInstances(ctx context.Context, userIDs []string) (map[string][]string, error)
+}
+
+type redisConnectionRegistry struct {
+	redisService redisinfra.RedisService
+}
+
+func NewRedisConnectionRegistry(redisService redisinfra.RedisService) ConnectionRegistry {
+	return &redisConnectionRegistry{
+		redisService: redisService,
+	}
+}
+
+func (r *redisConnectionRegistry) AddUser(ctx context.Context, instanceID, userID string) error {
+	if _, err := r.redisService.SAdd(ctx, connRegistryUserKeyPrefix+userID, instanceID); err != nil {
+		return fmt.Errorf("failed to register user %s on instance %s: %w", userID, instanceID, err)
+	}
+	if _, err := r.redisService.SAdd(ctx, connRegistryInstanceUsersKeyPrefix+instanceID, userID); err != nil {
+		return fmt.Errorf("failed to register user %s on instance %s: %w", userID, instanceID, err)
+	}
+	return nil
+}
+
+func (r *redisConnectionRegistry) RemoveUser(ctx context.Context, instanceID, userID string) error {
+	if err := r.redisService.SRem(ctx, connRegistryUserKeyPrefix+userID, instanceID); err != nil {
+		return fmt.Errorf("failed to unregister user %s from instance %s: %w", userID, instanceID, err)
+	}
+	if err := r.redisService.SRem(ctx, connRegistryInstanceUsersKeyPrefix+instanceID, userID); err != nil {
+		return fmt.Errorf("failed to unregister user %s from instance %s: %w", userID, instanceID, err)
+	}
+	return nil
+}
+
+func (r *redisConnectionRegistry) Heartbeat(ctx context.Context, instanceID string, ttl time.Duration) (bool, error) {
+	if err := r.redisService.Set(ctx, connRegistryHeartbeatKeyPrefix+instanceID, time.Now().Unix(), ttl); err != nil {
+		return false, fmt.Errorf("failed to renew heartbeat of instance %s: %w", instanceID, err)
+	}
+	added, err := r.redisService.SAdd(ctx, connRegistryInstancesKey, instanceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to register instance %s: %w", instanceID, err)
+	}
+	return added > 0, nil
+}
+
+func (r *redisConnectionRegistry) RemoveInstance(ctx context.Context, instanceID string) error {
+	userIDs, err := r.redisService.SMembers(ctx, connRegistryInstanceUsersKeyPrefix+instanceID)
+	if err != nil {
+		return fmt.Errorf("failed to list users of instance %s: %w", instanceID, err)
+	}
+
+	for _, userID := range userIDs {
+		if err := r.redisService.SRem(ctx, connRegistryUserKeyPrefix+userID, instanceID); err != nil {
+			return fmt.Errorf("failed to unregister user %s from instance %s: %w", userID, instanceID, err)
+		}
+	}
+
+	// Xóa danh sách user trước, instance chỉ rời khỏi registry khi đã dọn xong
+	// để lần dọn sau vẫn thấy nó nếu lần này lỗi giữa chừng
+	if err := r.redisService.Delete(ctx, connRegistryInstanceUsersKeyPrefix+instanceID); err != nil {
+		return fmt.Errorf("failed to delete users of instance %s: %w", instanceID, err)
+	}
+	if err := r.redisService.Delete(ctx, connRegistryHeartbeatKeyPrefix+instanceID); err != nil {
+		return fmt.Errorf("failed to delete heartbeat of instance %s: %w", instanceID, err)
+	}
+	return r.redisService.SRem(ctx, connRegistryInstancesKey, instanceID)
+}
+
+func (r *redisConnectionRegistry) CleanupDeadInstances(ctx context.Context) ([]string, error) {
+	instanceIDs, err := r.redisService.SMembers(ctx, connRegistryInstancesKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list registered instances: %w", err)
+	}
+
+	alive, err := r.aliveInstances(ctx, instanceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, instanceID := range instanceIDs {
+		if alive[instanceID] {
+			continue
+		}
+		if err := r.RemoveInstance(ctx, instanceID); err != nil {
+			log.Printf("ConnectionRegistry: Failed to clean up dead instance %s: %v", instanceID, err)
+			continue
+		}
+		removed = append(removed, instanceID)
+	}
+	return removed, nil
+}
+
+func (r *redisConnectionRegistry) FindUserInstances(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, connRegistryUserKeyPrefix+userID)
+	}
+
+	instancesOfUsers, err := r.redisService.SMembersMany(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find instances of users: %w", err)
+	}
+
+	seen := make(map[string]struct{})
+	var instanceIDs []string
+	for _, instances := range instancesOfUsers {
+		for _, instanceID := range instances {
+			if _, exists := seen[instanceID]; !exists {
+				seen[instanceID] = struct{}{}
+				instanceIDs = append(instanceIDs, instanceID)
+			}
+		}
+	}
+
+	alive, err := r.aliveInstances(ctx, instanceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, userID := range userIDs {
+		for _, instanceID := range instancesOfUsers[i] {
+			if alive[instanceID] {
+				result[instanceID] = append(result[instanceID], userID)
+			}
+		}
+	}
+	return result, nil
+}
+
+// aliveInstances kiểm tra heartbeat của các instance bằng một MGET
+func (r *redisConnectionRegistry) aliveInstances(ctx context.Context, instanceIDs []string) (map[string]bool, error) {
+	alive := make(map[string]bool, len(instanceIDs))
+	if len(instanceIDs) == 0 {
+		return alive, nil
+	}
+
+	keys := make([]string, 0, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		keys = append(keys, connRegistryHeartbeatKeyPrefix+instanceID)
+	}
+
+	values, err := r.redisService.MGet(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read instance heartbeats: %w", err)
+	}
+	for i, instanceID := range instanceIDs {
+		alive[instanceID] = values[i] != nil
+	}
+	return alive, nil
+}
@@ -3,9 +3,11 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	domainAuth "gochat-backend/internal/domain/auth"
 	domainFriendShip "gochat-backend/internal/domain/friend"
 	"gochat-backend/internal/infra/mysqlinfra"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -15,6 +17,8 @@ type FriendShipRepository interface {
 	HasFriendShip(ctx context.Context, userId, friendId string) (bool, error)
 	FindFriendsByUserId(ctx context.Context, userId string, limit, offset int) ([]*domainAuth.Account, error)
 	CountFriendsByUserId(ctx context.Context, userId string) (int, error)
+	FindFriendIdsByUserId(ctx context.Context, userId string) ([]string, error)
+	FindFriendIdsAmong(ctx context.Context, userId string, candidateIds []string) ([]string, error)
 	RemoveFriendShip(ctx context.Context, userId, friendId string) error
 }
 
@@ -58,6 +62,69 @@ func (r *friendShipRepo) HasFriendShip(ctx context.Context, userId, friendId str
 	return count > 0, nil
 }
 
+// FindFriendIdsByUserId trả về ID của tất cả bạn bè, dùng khi fan-out presence
+func (r *friendShipRepo) FindFriendIdsByUserId(ctx context.Context, userId string) ([]string, error) {
+	query := `
+		SELECT CASE WHEN user_id_a = ? THEN user_id_b ELSE user_id_a END
+		FROM friendships
+		WHERE user_id_a = ? OR user_id_b = ?`
+
+	rows, err := r.database.DB.QueryContext(ctx, query, userId, userId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var friendIds []string
+	for rows.Next() {
+		var friendId string
+		if err := rows.Scan(&friendId); err != nil {
+			return nil, err
+		}
+		friendIds = append(friendIds, friendId)
+	}
+	return friendIds, rows.Err()
+}
+
+// FindFriendIdsAmong trả về những ID trong candidateIds là bạn của userId
+func (r *friendShipRepo) FindFriendIdsAmong(ctx context.Context, userId string, candidateIds []string) ([]string, error) {
+	if len(candidateIds) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(candidateIds)), ",")
+	query := fmt.Sprintf(`
+		SELECT user_id_b FROM friendships WHERE user_id_a = ? AND user_id_b IN (%s)
+		UNION
+		SELECT user_id_a FROM friendships WHERE user_id_b = ? AND user_id_a IN (%s)`, placeholders, placeholders)
+
+	args := make([]interface{}, 0, 2*len(candidateIds)+2)
+	args = append(args, userId)
+	for _, id := range candidateIds {
+		args = append(args, id)
+	}
+	args = append(args, userId)
+	for _, id := range candidateIds {
+		args = append(args, id)
+	}
+
+	rows, err := r.database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var friendIds []string
+	for rows.Next() {
+		var friendId string
+		if err := rows.Scan(&friendId); err != nil {
+			return nil, err
+		}
+		friendIds = append(friendIds, friendId)
+	}
+	return friendIds, rows.Err()
+}
+
 func (r *friendShipRepo) FindFriendsByUserId(ctx context.Context, userId string, limit, offset int) ([]*domainAuth.Account, error) {
 	query := `
 		SELECT u.id, u.name, u.email, u.avatar_url, u.created_at, u.updated_at 
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/mysqlinfra"
+	"strings"
+	"time"
+)
+
+type MessageReactionRepository interface {
+	AddReaction(ctx context.Context, reaction *domain.MessageReaction, event *domain.RoomEvent) error
+	RemoveReaction(ctx context.Context, messageID, userID, emoji string, event *domain.RoomEvent) error
+	FindReactionSummaries(ctx context.Context, messageIDs []string, viewerID string) (map[string][]*domain.ReactionSummary, error)
+}
+
+type messageReactionRepo struct {
+	database *mysqlinfra.Database
+}
+
+func NewMessageReactionRepo(db *mysqlinfra.Database) MessageReactionRepository {
+	return &messageReactionRepo{database: db}
+}
+
+// AddReaction thêm reaction, không làm gì nếu user đã react emoji này. event khác nil thì
+// được cấp seq và ghi vào nhật ký của phòng trong cùng transaction.
+func (r *messageReactionRepo) AddReaction(ctx context.Context, reaction *domain.MessageReaction, event *domain.RoomEvent) error {
+	query := `
+        INSERT IGNORE INTO message_reactions (message_id, user_id, emoji, created_at)
+        VALUES (?, ?, ?, ?)
+    `
+
+	if reaction.CreatedAt.IsZero() {
+		reaction.CreatedAt = time.Now().UTC()
+	}
+
+	return r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			reaction.MessageId,
+			reaction.UserId,
+			reaction.Emoji,
+			reaction.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return insertRoomEvent(ctx, tx, event)
+	})
+}
+
+// RemoveReaction xóa reaction của user với một emoji. event khác nil thì được cấp seq và ghi
+// vào nhật ký của phòng trong cùng transaction.
+func (r *messageReactionRepo) RemoveReaction(ctx context.Context, messageID, userID, emoji string, event *domain.RoomEvent) error {
+	query := `DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`
+
+	return r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, messageID, userID, emoji); err != nil {
+			return err
+		}
+
+		return insertRoomEvent(ctx, tx, event)
+	})
+}
+
+// FindReactionSummaries đếm reaction theo emoji cho nhiều tin nhắn trong một query,
+// kèm cờ viewer đã react emoji đó hay chưa. Kết quả map theo message ID.
+func (r *messageReactionRepo) FindReactionSummaries(ctx context.Context, messageIDs []string, viewerID string) (map[string][]*domain.ReactionSummary, error) {
+	summaries := make(map[string][]*domain.ReactionSummary, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messageIDs)), ",")
+	query := `
+        SELECT message_id, emoji, COUNT(*), SUM(user_id = ?)
+        FROM message_reactions
+        WHERE message_id IN (` + placeholders + `)
+        GROUP BY message_id, emoji
+        ORDER BY message_id, MIN(created_at)
+    `
+
+	args := make([]any, 0, len(messageIDs)+1)
+	args = append(args, viewerID)
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var summary domain.ReactionSummary
+		var reactedByMe int
+
+		if err := rows.Scan(&messageID, &summary.Emoji, &summary.Count, &reactedByMe); err != nil {
+			return nil, err
+		}
+
+		summary.ReactedByMe = reactedByMe > 0
+		summaries[messageID] = append(summaries[messageID], &summary)
+	}
+
+	return summaries, rows.Err()
+}
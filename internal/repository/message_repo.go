@@ -2,14 +2,38 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	domain "gochat-backend/internal/domain/chat"
 	"gochat-backend/internal/infra/mysqlinfra"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
 )
 
+// messageSelectColumns là danh sách cột dùng chung cho mọi truy vấn đọc message,
+// phải khớp thứ tự với scanMessage.
+const messageSelectColumns = `id, sender_id, chat_room_id, type, mime_type, content, created_at, edited_at, deleted_at, reply_to_message_id, reply_count, seq`
+
+// errIdempotencyKeyTaken báo khóa idempotency đã được một message khác dùng, chỉ dùng trong repo
+var errIdempotencyKeyTaken = errors.New("idempotency key already used")
+
 type MessageRepository interface {
-	CreateMessage(ctx context.Context, message *domain.Message) error
-	FindMessagesByChatRoomID(ctx context.Context, chatRoomID string, limit, offset int) ([]*domain.Message, error)
+	CreateMessage(ctx context.Context, message *domain.Message, buildEvent OutboxEventBuilder) error
+	CreateMessageWithIdempotencyKey(ctx context.Context, message *domain.Message, idempotencyKey string, expiresAt time.Time, buildEvent OutboxEventBuilder) (*domain.Message, bool, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error)
+	FindMessageByID(ctx context.Context, messageID string) (*domain.Message, error)
+	FindMessagesByIDs(ctx context.Context, messageIDs []string) (map[string]*domain.Message, error)
+	FindMessagesByChatRoomID(ctx context.Context, chatRoomID, viewerID string, limit, offset int) ([]*domain.Message, error)
+	FindRepliesByMessageID(ctx context.Context, parentMessageID, viewerID string, limit, offset int) ([]*domain.Message, error)
+	FindMessagesAfterSeq(ctx context.Context, chatRoomID, viewerID string, afterSeq int64, limit int) ([]*domain.Message, error)
+	FindRoomEventsAfterSeq(ctx context.Context, chatRoomID string, afterSeq int64, limit int) ([]*domain.RoomEvent, error)
+	UpdateMessageContent(ctx context.Context, messageID, editorID, content string, editedAt time.Time, event *domain.RoomEvent) error
+	SoftDeleteMessage(ctx context.Context, messageID string, deletedAt time.Time, event *domain.RoomEvent) error
+	HideMessageForUser(ctx context.Context, messageID, userID string, hiddenAt time.Time) error
 	DeleteMessagesByChatRoomID(ctx context.Context, chatRoomID string) error
 }
 
@@ -21,24 +45,180 @@ func NewMessageRepo(db *mysqlinfra.Database) MessageRepository {
 	return &messageRepo{database: db}
 }
 
-// CreateMessage creates a new message
-func (r *messageRepo) CreateMessage(ctx context.Context, message *domain.Message) error {
+// rowScanner được implement bởi cả *sql.Row và *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage đọc một message theo thứ tự cột của messageSelectColumns
+func scanMessage(scanner rowScanner) (*domain.Message, error) {
+	var message domain.Message
+	var messageType string
+	var editedAt, deletedAt sql.NullTime
+	var replyToMessageID sql.NullString
+
+	if err := scanner.Scan(
+		&message.ID,
+		&message.SenderId,
+		&message.ChatRoomId,
+		&messageType,
+		&message.MimeType,
+		&message.Content,
+		&message.CreatedAt,
+		&editedAt,
+		&deletedAt,
+		&replyToMessageID,
+		&message.ReplyCount,
+		&message.Seq,
+	); err != nil {
+		return nil, err
+	}
+
+	message.Type = domain.MessageType(messageType)
+	if editedAt.Valid {
+		message.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		message.DeletedAt = &deletedAt.Time
+	}
+	message.ReplyToMessageId = replyToMessageID.String
+	return &message, nil
+}
+
+// CreateMessage creates a new message. Seq của message được cấp từ chat_rooms.last_seq
+// và nếu message là reply, reply_count của tin nhắn gốc được tăng, tất cả trong cùng transaction.
+// buildEvent khác nil thì sự kiện outbox của message cũng được ghi trong transaction đó.
+func (r *messageRepo) CreateMessage(ctx context.Context, message *domain.Message, buildEvent OutboxEventBuilder) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
 	}
 
-	query := `
-        INSERT INTO messages (id, sender_id, chat_room_id, type, mime_type, content, created_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
-    `
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now().UTC()
+	}
+
+	return r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		return insertMessageWithOutbox(ctx, tx, message, buildEvent)
+	})
+}
+
+// CreateMessageWithIdempotencyKey tạo message giống CreateMessage nhưng ghi kèm khóa idempotency
+// của người gửi trong phòng, còn hiệu lực tới expiresAt. Nếu khóa đang được dùng, không tạo gì
+// mà trả về message gốc với created = false.
+func (r *messageRepo) CreateMessageWithIdempotencyKey(
+	ctx context.Context,
+	message *domain.Message,
+	idempotencyKey string,
+	expiresAt time.Time,
+	buildEvent OutboxEventBuilder,
+) (*domain.Message, bool, error) {
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	default:
+	}
 
 	if message.CreatedAt.IsZero() {
 		message.CreatedAt = time.Now().UTC()
 	}
 
-	_, err := r.database.DB.ExecContext(
+	err := r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		// Khóa đã hết hạn nhưng chưa được dọn coi như chưa từng dùng
+		expiredQuery := `
+            DELETE FROM message_idempotency_keys
+            WHERE sender_id = ? AND chat_room_id = ? AND idempotency_key = ? AND expires_at <= ?
+        `
+		if _, err := tx.ExecContext(ctx, expiredQuery, message.SenderId, message.ChatRoomId, idempotencyKey, message.CreatedAt); err != nil {
+			return err
+		}
+
+		// Ghi khóa trước message: request trùng chạy đồng thời bị chặn ở khóa chính
+		// tới khi transaction này kết thúc rồi mới nhận lỗi trùng
+		keyQuery := `
+            INSERT INTO message_idempotency_keys (sender_id, chat_room_id, idempotency_key, message_id, created_at, expires_at)
+            VALUES (?, ?, ?, ?, ?, ?)
+        `
+		_, err := tx.ExecContext(ctx, keyQuery, message.SenderId, message.ChatRoomId, idempotencyKey, message.ID, message.CreatedAt, expiresAt)
+		if err != nil {
+			if isDuplicateEntry(err) {
+				return errIdempotencyKeyTaken
+			}
+			return err
+		}
+
+		return insertMessageWithOutbox(ctx, tx, message, buildEvent)
+	})
+	if err == nil {
+		return message, true, nil
+	}
+	if !errors.Is(err, errIdempotencyKeyTaken) {
+		return nil, false, err
+	}
+
+	original, err := r.findMessageByIdempotencyKey(ctx, message.SenderId, message.ChatRoomId, idempotencyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if original == nil {
+		return nil, false, fmt.Errorf("idempotency key %q refers to a missing message", idempotencyKey)
+	}
+	return original, false, nil
+}
+
+// DeleteExpiredIdempotencyKeys xóa tối đa limit khóa idempotency đã hết hạn trước before,
+// trả về số khóa đã xóa
+func (r *messageRepo) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `DELETE FROM message_idempotency_keys WHERE expires_at <= ? LIMIT ?`
+	result, err := r.database.DB.ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// findMessageByIdempotencyKey tìm message đã tạo bằng khóa idempotency, trả về nil nếu không có
+func (r *messageRepo) findMessageByIdempotencyKey(ctx context.Context, senderID, chatRoomID, idempotencyKey string) (*domain.Message, error) {
+	query := `
+        SELECT ` + messageSelectColumns + `
+        FROM messages
+        WHERE id = (
+            SELECT message_id FROM message_idempotency_keys
+            WHERE sender_id = ? AND chat_room_id = ? AND idempotency_key = ?
+        )
+    `
+
+	message, err := scanMessage(r.database.DB.QueryRowContext(ctx, query, senderID, chatRoomID, idempotencyKey))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// insertMessage cấp seq và ghi message trong transaction tx, tăng reply_count của tin nhắn gốc nếu là reply
+func insertMessage(ctx context.Context, tx *sql.Tx, message *domain.Message) error {
+	query := `
+        INSERT INTO messages (id, sender_id, chat_room_id, type, mime_type, content, created_at, reply_to_message_id, seq)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+	var replyToMessageID sql.NullString
+	if message.ReplyToMessageId != "" {
+		replyToMessageID = sql.NullString{String: message.ReplyToMessageId, Valid: true}
+	}
+
+	seq, err := nextRoomSeq(ctx, tx, message.ChatRoomId)
+	if err != nil {
+		return err
+	}
+	message.Seq = seq
+
+	_, err = tx.ExecContext(
 		ctx,
 		query,
 		message.ID,
@@ -48,22 +228,166 @@ func (r *messageRepo) CreateMessage(ctx context.Context, message *domain.Message
 		message.MimeType,
 		message.Content,
 		message.CreatedAt,
+		replyToMessageID,
+		message.Seq,
 	)
+	if err != nil || !replyToMessageID.Valid {
+		return err
+	}
 
+	countQuery := `UPDATE messages SET reply_count = reply_count + 1 WHERE id = ?`
+	_, err = tx.ExecContext(ctx, countQuery, replyToMessageID.String)
 	return err
 }
 
-// FindMessagesByChatRoomID retrieves messages for a chat room with pagination
-func (r *messageRepo) FindMessagesByChatRoomID(ctx context.Context, chatRoomID string, limit, offset int) ([]*domain.Message, error) {
+// insertMessageWithOutbox ghi message và sự kiện outbox do buildEvent dựng (nếu có) trong transaction tx
+func insertMessageWithOutbox(ctx context.Context, tx *sql.Tx, message *domain.Message, buildEvent OutboxEventBuilder) error {
+	if err := insertMessage(ctx, tx, message); err != nil || buildEvent == nil {
+		return err
+	}
+
+	event, err := buildEvent(message)
+	if err != nil {
+		return err
+	}
+	return insertOutboxEvent(ctx, tx, event)
+}
+
+// isDuplicateEntry cho biết lỗi MySQL có phải vi phạm khóa chính/unique (ER_DUP_ENTRY) không
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// FindMessageByID retrieves a single message, returns nil if it does not exist
+func (r *messageRepo) FindMessageByID(ctx context.Context, messageID string) (*domain.Message, error) {
+	query := `SELECT ` + messageSelectColumns + ` FROM messages WHERE id = ?`
+
+	message, err := scanMessage(r.database.DB.QueryRowContext(ctx, query, messageID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// FindMessagesByChatRoomID retrieves messages for a chat room with pagination,
+// skipping messages the viewer has deleted for themselves
+func (r *messageRepo) FindMessagesByChatRoomID(ctx context.Context, chatRoomID, viewerID string, limit, offset int) ([]*domain.Message, error) {
 	query := `
-        SELECT id, sender_id, chat_room_id, type, mime_type, content, created_at
+        SELECT ` + messageSelectColumns + `
         FROM messages
         WHERE chat_room_id = ?
+        AND NOT EXISTS (
+            SELECT 1 FROM message_hidden_for_users h
+            WHERE h.message_id = messages.id AND h.user_id = ?
+        )
         ORDER BY created_at DESC
         LIMIT ? OFFSET ?
     `
 
-	rows, err := r.database.DB.QueryContext(ctx, query, chatRoomID, limit, offset)
+	rows, err := r.database.DB.QueryContext(ctx, query, chatRoomID, viewerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*domain.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// FindMessagesByIDs lấy nhiều message một lần, trả về map theo ID (bỏ qua ID không tồn tại)
+func (r *messageRepo) FindMessagesByIDs(ctx context.Context, messageIDs []string) (map[string]*domain.Message, error) {
+	result := make(map[string]*domain.Message, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messageIDs)), ",")
+	query := `SELECT ` + messageSelectColumns + ` FROM messages WHERE id IN (` + placeholders + `)`
+
+	args := make([]any, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[message.ID] = message
+	}
+
+	return result, rows.Err()
+}
+
+// FindRepliesByMessageID lấy các reply của một tin nhắn theo thứ tự thời gian,
+// bỏ qua những reply mà viewer đã xóa phía mình
+func (r *messageRepo) FindRepliesByMessageID(ctx context.Context, parentMessageID, viewerID string, limit, offset int) ([]*domain.Message, error) {
+	query := `
+        SELECT ` + messageSelectColumns + `
+        FROM messages
+        WHERE reply_to_message_id = ?
+        AND NOT EXISTS (
+            SELECT 1 FROM message_hidden_for_users h
+            WHERE h.message_id = messages.id AND h.user_id = ?
+        )
+        ORDER BY created_at ASC
+        LIMIT ? OFFSET ?
+    `
+
+	rows, err := r.database.DB.QueryContext(ctx, query, parentMessageID, viewerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*domain.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// FindMessagesAfterSeq lấy các message có seq lớn hơn afterSeq theo thứ tự tăng dần,
+// dùng để replay các tin nhắn client bị lỡ khi kết nối lại
+func (r *messageRepo) FindMessagesAfterSeq(ctx context.Context, chatRoomID, viewerID string, afterSeq int64, limit int) ([]*domain.Message, error) {
+	query := `
+        SELECT ` + messageSelectColumns + `
+        FROM messages
+        WHERE chat_room_id = ? AND seq > ?
+        AND NOT EXISTS (
+            SELECT 1 FROM message_hidden_for_users h
+            WHERE h.message_id = messages.id AND h.user_id = ?
+        )
+        ORDER BY seq ASC
+        LIMIT ?
+    `
+
+	rows, err := r.database.DB.QueryContext(ctx, query, chatRoomID, afterSeq, viewerID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -71,31 +395,144 @@ func (r *messageRepo) FindMessagesByChatRoomID(ctx context.Context, chatRoomID s
 
 	var messages []*domain.Message
 	for rows.Next() {
-		var message domain.Message
-		var messageType string
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// FindRoomEventsAfterSeq lấy các sự kiện trong nhật ký của phòng có seq lớn hơn afterSeq theo
+// thứ tự tăng dần. Cùng với FindMessagesAfterSeq, đây là mọi thay đổi client bị lỡ.
+func (r *messageRepo) FindRoomEventsAfterSeq(ctx context.Context, chatRoomID string, afterSeq int64, limit int) ([]*domain.RoomEvent, error) {
+	query := `
+        SELECT chat_room_id, seq, event_type, message_id, actor_id, emoji, created_at
+        FROM chat_room_events
+        WHERE chat_room_id = ? AND seq > ?
+        ORDER BY seq ASC
+        LIMIT ?
+    `
+
+	rows, err := r.database.DB.QueryContext(ctx, query, chatRoomID, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var events []*domain.RoomEvent
+	for rows.Next() {
+		var event domain.RoomEvent
+		var eventType string
+		var emoji sql.NullString
 		if err := rows.Scan(
-			&message.ID,
-			&message.SenderId,
-			&message.ChatRoomId,
-			&messageType,
-			&message.MimeType,
-			&message.Content,
-			&message.CreatedAt,
+			&event.ChatRoomId,
+			&event.Seq,
+			&eventType,
+			&event.MessageId,
+			&event.ActorId,
+			&emoji,
+			&event.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
+		event.EventType = domain.RoomEventType(eventType)
+		event.Emoji = emoji.String
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
 
-		message.Type = domain.MessageType(messageType)
-		messages = append(messages, &message)
+// UpdateMessageContent thay nội dung message và lưu nội dung cũ vào message_edit_history
+// trong cùng một transaction. event khác nil thì được cấp seq và ghi vào nhật ký của phòng
+// trong transaction đó.
+func (r *messageRepo) UpdateMessageContent(ctx context.Context, messageID, editorID, content string, editedAt time.Time, event *domain.RoomEvent) error {
+	if editedAt.IsZero() {
+		editedAt = time.Now().UTC()
 	}
 
-	return messages, nil
+	return r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		var previousContent string
+		selectQuery := `SELECT content FROM messages WHERE id = ? FOR UPDATE`
+		if err := tx.QueryRowContext(ctx, selectQuery, messageID).Scan(&previousContent); err != nil {
+			return err
+		}
+
+		historyQuery := `
+            INSERT INTO message_edit_history (id, message_id, editor_id, previous_content, edited_at)
+            VALUES (?, ?, ?, ?, ?)
+        `
+		if _, err := tx.ExecContext(ctx, historyQuery, uuid.New().String(), messageID, editorID, previousContent, editedAt); err != nil {
+			return err
+		}
+
+		updateQuery := `UPDATE messages SET content = ?, edited_at = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, updateQuery, content, editedAt, messageID); err != nil {
+			return err
+		}
+
+		return insertRoomEvent(ctx, tx, event)
+	})
 }
 
-// DeleteMessagesByChatRoomID deletes all messages in a chat room
-func (r *messageRepo) DeleteMessagesByChatRoomID(ctx context.Context, chatRoomID string) error {
-	query := `DELETE FROM messages WHERE chat_room_id = ?`
-	_, err := r.database.DB.ExecContext(ctx, query, chatRoomID)
+// SoftDeleteMessage thu hồi tin nhắn cho mọi người: xóa nội dung, giữ lại tombstone
+// và xóa luôn lịch sử chỉnh sửa, reaction để nội dung cũ không còn được lưu. event khác nil
+// thì được cấp seq và ghi vào nhật ký của phòng trong cùng transaction.
+func (r *messageRepo) SoftDeleteMessage(ctx context.Context, messageID string, deletedAt time.Time, event *domain.RoomEvent) error {
+	if deletedAt.IsZero() {
+		deletedAt = time.Now().UTC()
+	}
+
+	return r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		historyQuery := `DELETE FROM message_edit_history WHERE message_id = ?`
+		if _, err := tx.ExecContext(ctx, historyQuery, messageID); err != nil {
+			return err
+		}
+
+		reactionQuery := `DELETE FROM message_reactions WHERE message_id = ?`
+		if _, err := tx.ExecContext(ctx, reactionQuery, messageID); err != nil {
+			return err
+		}
+
+		updateQuery := `UPDATE messages SET content = '', deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
+		if _, err := tx.ExecContext(ctx, updateQuery, deletedAt, messageID); err != nil {
+			return err
+		}
+
+		return insertRoomEvent(ctx, tx, event)
+	})
+}
+
+// HideMessageForUser ẩn tin nhắn chỉ với một user ("xóa phía tôi")
+func (r *messageRepo) HideMessageForUser(ctx context.Context, messageID, userID string, hiddenAt time.Time) error {
+	if hiddenAt.IsZero() {
+		hiddenAt = time.Now().UTC()
+	}
+
+	query := `INSERT IGNORE INTO message_hidden_for_users (message_id, user_id, hidden_at) VALUES (?, ?, ?)`
+	_, err := r.database.DB.ExecContext(ctx, query, messageID, userID, hiddenAt)
 	return err
 }
+
+// DeleteMessagesByChatRoomID deletes all messages in a chat room, kèm khóa idempotency và
+// nhật ký sự kiện trỏ tới chúng
+func (r *messageRepo) DeleteMessagesByChatRoomID(ctx context.Context, chatRoomID string) error {
+	return r.database.ExecuteTransaction(func(tx *sql.Tx) error {
+		keyQuery := `DELETE FROM message_idempotency_keys WHERE chat_room_id = ?`
+		if _, err := tx.ExecContext(ctx, keyQuery, chatRoomID); err != nil {
+			return err
+		}
+
+		eventQuery := `DELETE FROM chat_room_events WHERE chat_room_id = ?`
+		if _, err := tx.ExecContext(ctx, eventQuery, chatRoomID); err != nil {
+			return err
+		}
+
+		query := `DELETE FROM messages WHERE chat_room_id = ?`
+		_, err := tx.ExecContext(ctx, query, chatRoomID)
+		return err
+	})
+}
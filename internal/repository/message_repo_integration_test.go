@@ -0,0 +1,220 @@
+//go:build integration
+// +build integration
+
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gochat-backend/config"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/mysqlinfra"
+	"gochat-backend/internal/repository"
+
+	_ "github.com/go-sql-driver/mysql" // MySQL driver
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupMessageRepoTest kết nối DB test (.env.test), tạo một user và một phòng mới cho mỗi test
+func setupMessageRepoTest(t *testing.T) (*mysqlinfra.Database, string, string) {
+	err := godotenv.Load("../../.env.test")
+	require.NoError(t, err, "Failed to load .env.test file")
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+
+	db, err := mysqlinfra.ConnectMysql(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	userID := uuid.New().String()
+	_, err = db.Exec(
+		`INSERT INTO users (id, email, name, password) VALUES (?, ?, ?, ?)`,
+		userID, userID+"@example.com", "Message Repo Test", "hashed",
+	)
+	require.NoError(t, err)
+
+	chatRoomID := uuid.New().String()
+	_, err = db.Exec(
+		`INSERT INTO chat_rooms (id, name, type, created_at) VALUES (?, ?, 'GROUP', ?)`,
+		chatRoomID, "Message Repo Test", time.Now().UTC(),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM outbox_events WHERE chat_room_id = ?`, chatRoomID)
+		db.Exec(`DELETE FROM message_idempotency_keys WHERE chat_room_id = ?`, chatRoomID)
+		db.Exec(`DELETE FROM messages WHERE chat_room_id = ?`, chatRoomID)
+		db.Exec(`DELETE FROM chat_rooms WHERE id = ?`, chatRoomID)
+		db.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	})
+
+	return mysqlinfra.NewMySqlDatabase(db), userID, chatRoomID
+}
+
+func newTestMessage(senderID, chatRoomID, content string) *domain.Message {
+	return &domain.Message{
+		ID:         uuid.New().String(),
+		SenderId:   senderID,
+		ChatRoomId: chatRoomID,
+		Type:       domain.TextMessageType,
+		Content:    content,
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// outboxBuilder ghi lại seq mà builder nhìn thấy trong transaction
+func outboxBuilder(seen *int64) repository.OutboxEventBuilder {
+	return func(message *domain.Message) (*domain.OutboxEvent, error) {
+		*seen = message.Seq
+		return &domain.OutboxEvent{
+			EventType:  "message_sent",
+			ChatRoomId: message.ChatRoomId,
+			Payload:    []byte(`{"event_type":"message_sent"}`),
+		}, nil
+	}
+}
+
+func countRows(t *testing.T, database *mysqlinfra.Database, query string, args ...any) int {
+	var count int
+	require.NoError(t, database.DB.QueryRow(query, args...).Scan(&count))
+	return count
+}
+
+func TestCreateMessageWritesOutboxEventInSameTransaction(t *testing.T) {
+	database, userID, chatRoomID := setupMessageRepoTest(t)
+	messageRepo := repository.NewMessageRepo(database)
+	ctx := context.Background()
+
+	var seenSeq int64
+	message := newTestMessage(userID, chatRoomID, "hello")
+	require.NoError(t, messageRepo.CreateMessage(ctx, message, outboxBuilder(&seenSeq)))
+
+	assert.Equal(t, int64(1), message.Seq)
+	assert.Equal(t, message.Seq, seenSeq, "builder must run after seq is assigned")
+	assert.Equal(t, 1, countRows(t, database, `SELECT COUNT(*) FROM messages WHERE chat_room_id = ?`, chatRoomID))
+	assert.Equal(t, 1, countRows(t, database, `SELECT COUNT(*) FROM outbox_events WHERE chat_room_id = ? AND status = 'PENDING'`, chatRoomID))
+}
+
+func TestCreateMessageRollsBackWhenOutboxBuilderFails(t *testing.T) {
+	database, userID, chatRoomID := setupMessageRepoTest(t)
+	messageRepo := repository.NewMessageRepo(database)
+	ctx := context.Background()
+
+	builderErr := errors.New("builder failed")
+	message := newTestMessage(userID, chatRoomID, "hello")
+	err := messageRepo.CreateMessage(ctx, message, func(*domain.Message) (*domain.OutboxEvent, error) {
+		return nil, builderErr
+	})
+	require.ErrorIs(t, err, builderErr)
+
+	assert.Equal(t, 0, countRows(t, database, `SELECT COUNT(*) FROM messages WHERE chat_room_id = ?`, chatRoomID))
+	assert.Equal(t, 0, countRows(t, database, `SELECT COUNT(*) FROM outbox_events WHERE chat_room_id = ?`, chatRoomID))
+	assert.Equal(t, 0, countRows(t, database, `SELECT last_seq FROM chat_rooms WHERE id = ?`, chatRoomID))
+}
+
+func TestOutboxRelayLockIsExclusive(t *testing.T) {
+	database, _, _ := setupMessageRepoTest(t)
+	outboxRepo := repository.NewOutboxEventRepo(database)
+	ctx := context.Background()
+
+	release, acquired, err := outboxRepo.AcquireRelayLock(ctx)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	_, acquiredAgain, err := outboxRepo.AcquireRelayLock(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquiredAgain)
+
+	release()
+	releaseAgain, acquiredAgain, err := outboxRepo.AcquireRelayLock(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquiredAgain)
+	releaseAgain()
+}
+
+func TestRoomEventsShareSeqWithMessages(t *testing.T) {
+	database, userID, chatRoomID := setupMessageRepoTest(t)
+	messageRepo := repository.NewMessageRepo(database)
+	ctx := context.Background()
+
+	message := newTestMessage(userID, chatRoomID, "hello")
+	require.NoError(t, messageRepo.CreateMessage(ctx, message, nil))
+
+	edit := &domain.RoomEvent{
+		ChatRoomId: chatRoomID,
+		EventType:  domain.RoomEventMessageEdited,
+		MessageId:  message.ID,
+		ActorId:    userID,
+	}
+	require.NoError(t, messageRepo.UpdateMessageContent(ctx, message.ID, userID, "hello there", time.Now().UTC(), edit))
+	assert.Equal(t, message.Seq+1, edit.Seq)
+
+	next := newTestMessage(userID, chatRoomID, "again")
+	require.NoError(t, messageRepo.CreateMessage(ctx, next, nil))
+	assert.Equal(t, edit.Seq+1, next.Seq)
+
+	events, err := messageRepo.FindRoomEventsAfterSeq(ctx, chatRoomID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, edit.Seq, events[0].Seq)
+	assert.Equal(t, domain.RoomEventMessageEdited, events[0].EventType)
+	assert.Equal(t, message.ID, events[0].MessageId)
+}
+
+func TestCreateMessageWithIdempotencyKeyReturnsOriginalOnDuplicate(t *testing.T) {
+	database, userID, chatRoomID := setupMessageRepoTest(t)
+	messageRepo := repository.NewMessageRepo(database)
+	ctx := context.Background()
+
+	var seenSeq int64
+	first := newTestMessage(userID, chatRoomID, "hello")
+	saved, created, err := messageRepo.CreateMessageWithIdempotencyKey(ctx, first, "key-1", first.CreatedAt.Add(time.Hour), outboxBuilder(&seenSeq))
+	require.NoError(t, err)
+	require.True(t, created)
+	assert.Equal(t, first.ID, saved.ID)
+
+	// Retry với ID mới như khi client gửi lại vì mất ACK
+	retry := newTestMessage(userID, chatRoomID, "hello")
+	original, created, err := messageRepo.CreateMessageWithIdempotencyKey(ctx, retry, "key-1", retry.CreatedAt.Add(time.Hour), outboxBuilder(&seenSeq))
+	require.NoError(t, err)
+	assert.False(t, created)
+	require.NotNil(t, original)
+	assert.Equal(t, first.ID, original.ID)
+	assert.Equal(t, first.Seq, original.Seq)
+
+	assert.Equal(t, 1, countRows(t, database, `SELECT COUNT(*) FROM messages WHERE chat_room_id = ?`, chatRoomID))
+	assert.Equal(t, 1, countRows(t, database, `SELECT COUNT(*) FROM outbox_events WHERE chat_room_id = ?`, chatRoomID))
+	assert.Equal(t, 1, countRows(t, database, `SELECT last_seq FROM chat_rooms WHERE id = ?`, chatRoomID))
+}
+
+func TestCreateMessageWithIdempotencyKeyReusesExpiredKey(t *testing.T) {
+	database, userID, chatRoomID := setupMessageRepoTest(t)
+	messageRepo := repository.NewMessageRepo(database)
+	ctx := context.Background()
+
+	var seenSeq int64
+	first := newTestMessage(userID, chatRoomID, "hello")
+	first.CreatedAt = first.CreatedAt.Add(-2 * time.Hour)
+	_, created, err := messageRepo.CreateMessageWithIdempotencyKey(ctx, first, "key-1", first.CreatedAt.Add(time.Hour), outboxBuilder(&seenSeq))
+	require.NoError(t, err)
+	require.True(t, created)
+
+	// Khóa đã hết hạn nhưng chưa được dọn: lần gửi sau tạo tin nhắn mới
+	second := newTestMessage(userID, chatRoomID, "hello again")
+	saved, created, err := messageRepo.CreateMessageWithIdempotencyKey(ctx, second, "key-1", second.CreatedAt.Add(time.Hour), outboxBuilder(&seenSeq))
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, second.ID, saved.ID)
+	assert.Equal(t, int64(2), saved.Seq)
+
+	assert.Equal(t, 2, countRows(t, database, `SELECT COUNT(*) FROM messages WHERE chat_room_id = ?`, chatRoomID))
+	assert.Equal(t, 2, countRows(t, database, `SELECT COUNT(*) FROM outbox_events WHERE chat_room_id = ?`, chatRoomID))
+	assert.Equal(t, 1, countRows(t, database, `SELECT COUNT(*) FROM message_idempotency_keys WHERE chat_room_id = ? AND message_id = ?`, chatRoomID, second.ID))
+}
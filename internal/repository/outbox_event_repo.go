@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/mysqlinfra"
+	"log"
+	"time"
+)
+
+// maxOutboxErrorLength giới hạn độ dài lỗi lưu vào last_error
+const maxOutboxErrorLength = 1024
+
+// outboxRelayLockName là tên MySQL named lock của relay, gắn với database để các môi trường
+// dùng chung MySQL server không chặn nhau
+const outboxRelayLockName = `CONCAT(DATABASE(), '.outbox_relay')`
+
+// OutboxEventBuilder dựng sự kiện outbox cho message vừa được cấp seq. Hàm chạy bên trong
+// transaction ghi message; trả về lỗi sẽ rollback cả message.
+type OutboxEventBuilder func(message *domain.Message) (*domain.OutboxEvent, error)
+
+type OutboxEventRepository interface {
+	AcquireRelayLock(ctx context.Context) (release func(), acquired bool, err error)
+	FindPendingEvents(ctx context.Context, limit int) ([]*domain.OutboxEvent, error)
+	MarkEventSent(ctx context.Context, eventID int64, sentAt time.Time) error
+	RecordFailedAttempt(ctx context.Context, event *domain.OutboxEvent) error
+	DeleteSentEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+type outboxEventRepo struct {
+	database *mysqlinfra.Database
+}
+
+func NewOutboxEventRepo(db *mysqlinfra.Database) OutboxEventRepository {
+	return &outboxEventRepo{database: db}
+}
+
+// AcquireRelayLock lấy MySQL named lock của relay mà không chờ, để tại mỗi thời điểm chỉ một
+// relay gửi sự kiện và thứ tự publish đúng thứ tự ghi. Lock gắn với một connection riêng chứ
+// không với transaction nào nên không khóa row hay gap của outbox_events, và được MySQL tự
+// nhả nếu instance chết. acquired = false nghĩa là relay khác đang giữ lock.
+func (r *outboxEventRepo) AcquireRelayLock(ctx context.Context) (func(), bool, error) {
+	conn, err := r.database.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(`+outboxRelayLockName+`, 0)`).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	release := func() {
+		if _, err := conn.ExecContext(context.Background(), `DO RELEASE_LOCK(`+outboxRelayLockName+`)`); err != nil {
+			log.Printf("Outbox repository: Failed to release relay lock: %v", err)
+		}
+		conn.Close()
+	}
+	return release, true, nil
+}
+
+// FindPendingEvents trả về tối đa limit sự kiện PENDING theo thứ tự ghi. Đây là consistent read
+// không khóa row nên không chặn transaction đang ghi tin nhắn mới.
+func (r *outboxEventRepo) FindPendingEvents(ctx context.Context, limit int) ([]*domain.OutboxEvent, error) {
+	query := `
+        SELECT id, event_type, chat_room_id, payload, status, attempts, created_at
+        FROM outbox_events
+        WHERE status = ?
+        ORDER BY id
+        LIMIT ?
+    `
+
+	rows, err := r.database.DB.QueryContext(ctx, query, domain.OutboxEventPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*domain.OutboxEvent
+	for rows.Next() {
+		var event domain.OutboxEvent
+		var status string
+		if err := rows.Scan(
+			&event.ID,
+			&event.EventType,
+			&event.ChatRoomId,
+			&event.Payload,
+			&status,
+			&event.Attempts,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		event.Status = domain.OutboxEventStatus(status)
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
+
+// MarkEventSent đánh dấu sự kiện đã được publish
+func (r *outboxEventRepo) MarkEventSent(ctx context.Context, eventID int64, sentAt time.Time) error {
+	query := `UPDATE outbox_events SET status = ?, sent_at = ? WHERE id = ?`
+	_, err := r.database.DB.ExecContext(ctx, query, domain.OutboxEventSent, sentAt, eventID)
+	return err
+}
+
+// RecordFailedAttempt lưu số lần thử, lỗi cuối và trạng thái (PENDING hoặc FAILED) của sự kiện
+func (r *outboxEventRepo) RecordFailedAttempt(ctx context.Context, event *domain.OutboxEvent) error {
+	lastError := event.LastError
+	if len(lastError) > maxOutboxErrorLength {
+		lastError = lastError[:maxOutboxErrorLength]
+	}
+
+	query := `UPDATE outbox_events SET attempts = ?, last_error = ?, status = ? WHERE id = ?`
+	_, err := r.database.DB.ExecContext(ctx, query, event.Attempts, lastError, event.Status, event.ID)
+	return err
+}
+
+// DeleteSentEvents xóa tối đa limit sự kiện đã gửi trước before, trả về số sự kiện đã xóa
+func (r *outboxEventRepo) DeleteSentEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `DELETE FROM outbox_events WHERE status = ? AND sent_at <= ? LIMIT ?`
+	result, err := r.database.DB.ExecContext(ctx, query, domain.OutboxEventSent, before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// insertOutboxEvent ghi sự kiện outbox trong transaction tx của thay đổi sinh ra nó
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, event *domain.OutboxEvent) error {
+	query := `
+        INSERT INTO outbox_events (event_type, chat_room_id, payload, status, created_at)
+        VALUES (?, ?, ?, ?, ?)
+    `
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	event.Status = domain.OutboxEventPending
+
+	result, err := tx.ExecContext(ctx, query, event.EventType, event.ChatRoomId, event.Payload, event.Status, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	event.ID, err = result.LastInsertId()
+	return err
+}
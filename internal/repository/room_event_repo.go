@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	domain "gochat-backend/internal/domain/chat"
+	"time"
+)
+
+// nextRoomSeq cấp seq tiếp theo của phòng trong transaction tx. Tin nhắn mới và sự kiện phòng
+// dùng chung bộ đếm này; UPDATE giữ row lock của phòng tới hết transaction nên seq không bị trùng.
+func nextRoomSeq(ctx context.Context, tx *sql.Tx, chatRoomID string) (int64, error) {
+	seqQuery := `UPDATE chat_rooms SET last_seq = last_seq + 1 WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, seqQuery, chatRoomID); err != nil {
+		return 0, err
+	}
+
+	var seq int64
+	if err := tx.QueryRowContext(ctx, `SELECT last_seq FROM chat_rooms WHERE id = ?`, chatRoomID).Scan(&seq); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// insertRoomEvent cấp seq cho event và ghi vào nhật ký sự kiện của phòng trong transaction tx
+// của thay đổi sinh ra nó. event nil thì không làm gì.
+func insertRoomEvent(ctx context.Context, tx *sql.Tx, event *domain.RoomEvent) error {
+	if event == nil {
+		return nil
+	}
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	seq, err := nextRoomSeq(ctx, tx, event.ChatRoomId)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO chat_room_events (chat_room_id, seq, event_type, message_id, actor_id, emoji, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+
+	var emoji sql.NullString
+	if event.Emoji != "" {
+		emoji = sql.NullString{String: event.Emoji, Valid: true}
+	}
+
+	if _, err := tx.ExecContext(ctx, query, event.ChatRoomId, seq, event.EventType, event.MessageId, event.ActorId, emoji, event.CreatedAt); err != nil {
+		return err
+	}
+
+	event.Seq = seq
+	return nil
+}
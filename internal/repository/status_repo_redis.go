@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"gochat-backend/internal/infra/redisinfra"
+	"log"
 	"time"
 
 	"gochat-backend/internal/domain/status"
@@ -14,6 +15,7 @@ import (
 
 const (
 	userStatusKeyPrefix        = "user_status:"
+	userPresenceKeyPrefix      = "user_presence:"
 	userStatusOfflineTTL       = 1 * time.Hour  // TTL khi user offline
 	userStatusOnlineDefaultTTL = 24 * time.Hour // TTL mặc định dài cho user online nếu không có explicit offline
 )
@@ -23,6 +25,14 @@ type StatusRepository interface {
 	SetUserStatus(ctx context.Context, userID string, userStatus *status.UserStatus) error
 	GetUserStatus(ctx context.Context, userID string) (*status.UserStatus, error)
 	DeleteUserStatus(ctx context.Context, userID string) error // Có thể không cần nếu dùng TTL
+
+	SetUserPresence(ctx context.Context, userID string, presence *status.UserPresence) error
+	GetUserPresence(ctx context.Context, userID string) (*status.UserPresence, error) // nil, nil nếu user chưa tự đặt trạng thái
+	DeleteUserPresence(ctx context.Context, userID string) error
+
+	// FindUserStatuses đọc trạng thái kết nối và trạng thái tự chọn của nhiều user bằng một MGET.
+	// User không có dữ liệu thì không có mặt trong map tương ứng.
+	FindUserStatuses(ctx context.Context, userIDs []string) (map[string]*status.UserStatus, map[string]*status.UserPresence, error)
 }
 
 type redisStatusRepository struct {
@@ -41,10 +51,6 @@ func (r *redisStatusRepository) generateKey(userID string) string {
 
 func (r *redisStatusRepository) SetUserStatus(ctx context.Context, userID string, userStatus *status.UserStatus) error {
 	key := r.generateKey(userID)
-	data, err := json.Marshal(userStatus)
-	if err != nil {
-		return fmt.Errorf("failed to marshal user status: %w", err)
-	}
 
 	var ttl time.Duration
 	if userStatus.Status == status.Offline {
@@ -55,7 +61,8 @@ func (r *redisStatusRepository) SetUserStatus(ctx context.Context, userID string
 		ttl = userStatusOnlineDefaultTTL
 	}
 
-	return r.redisService.Set(ctx, key, data, ttl)
+	// RedisService.Set tự marshal JSON, truyền struct để Get đọc lại được
+	return r.redisService.Set(ctx, key, userStatus, ttl)
 }
 
 func (r *redisStatusRepository) GetUserStatus(ctx context.Context, userID string) (*status.UserStatus, error) {
@@ -75,3 +82,74 @@ func (r *redisStatusRepository) DeleteUserStatus(ctx context.Context, userID str
 	key := r.generateKey(userID)
 	return r.redisService.Delete(ctx, key)
 }
+
+func (r *redisStatusRepository) SetUserPresence(ctx context.Context, userID string, presence *status.UserPresence) error {
+	key := userPresenceKeyPrefix + userID
+
+	// Trạng thái tự chọn giữ tới khi user đổi lại; chỉ có custom text với trạng thái
+	// online thì key tự hết hạn cùng custom text
+	var ttl time.Duration
+	if presence.Status == status.Online && presence.CustomTextExpiresAt != nil {
+		ttl = time.Until(*presence.CustomTextExpiresAt)
+		if ttl <= 0 {
+			return r.redisService.Delete(ctx, key)
+		}
+	}
+
+	return r.redisService.Set(ctx, key, presence, ttl)
+}
+
+func (r *redisStatusRepository) GetUserPresence(ctx context.Context, userID string) (*status.UserPresence, error) {
+	var presence status.UserPresence
+	err := r.redisService.Get(ctx, userPresenceKeyPrefix+userID, &presence)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user presence from redis: %w", err)
+	}
+	return &presence, nil
+}
+
+func (r *redisStatusRepository) DeleteUserPresence(ctx context.Context, userID string) error {
+	return r.redisService.Delete(ctx, userPresenceKeyPrefix+userID)
+}
+
+func (r *redisStatusRepository) FindUserStatuses(ctx context.Context, userIDs []string) (map[string]*status.UserStatus, map[string]*status.UserPresence, error) {
+	statuses := make(map[string]*status.UserStatus, len(userIDs))
+	presences := make(map[string]*status.UserPresence)
+	if len(userIDs) == 0 {
+		return statuses, presences, nil
+	}
+
+	// Key trạng thái kết nối và key trạng thái tự chọn xen kẽ nhau trong cùng một MGET
+	keys := make([]string, 0, 2*len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, r.generateKey(userID), userPresenceKeyPrefix+userID)
+	}
+
+	values, err := r.redisService.MGet(ctx, keys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user statuses from redis: %w", err)
+	}
+
+	for i, userID := range userIDs {
+		if raw := values[2*i]; raw != nil {
+			var userStatus status.UserStatus
+			if err := json.Unmarshal(raw, &userStatus); err != nil {
+				log.Printf("StatusRepository: Skipping malformed status of user %s: %v", userID, err)
+			} else {
+				statuses[userID] = &userStatus
+			}
+		}
+		if raw := values[2*i+1]; raw != nil {
+			var presence status.UserPresence
+			if err := json.Unmarshal(raw, &presence); err != nil {
+				log.Printf("StatusRepository: Skipping malformed presence of user %s: %v", userID, err)
+			} else {
+				presences[userID] = &presence
+			}
+		}
+	}
+	return statuses, presences, nil
+}
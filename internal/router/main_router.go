@@ -3,8 +3,10 @@ package router
 import (
 	"gochat-backend/config"
 	"gochat-backend/internal/middleware"
+	"gochat-backend/internal/socket"
 	"gochat-backend/internal/usecase"
 	"gochat-backend/internal/validations"
+	"log"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -22,11 +24,19 @@ func InitRouter(
 	config *config.Environment,
 	middleWare middleware.Middleware,
 	useCaseContainer *usecase.UseCaseContainer,
-	deps *usecase.SharedDependencies,
+	socketManager *socket.SocketManager,
 ) *gin.Engine {
 	router := gin.New()
+
+	// Mặc định gin tin X-Forwarded-For từ mọi nơi, client có thể giả IP và vượt qua việc
+	// ràng buộc ticket WebSocket/SSE với IP. Chỉ tin các proxy được cấu hình.
+	if err := router.SetTrustedProxies(config.TrustedProxyList()); err != nil {
+		log.Printf("Router: Invalid TRUSTED_PROXIES %q, trusting no proxy: %v", config.TrustedProxies, err)
+		_ = router.SetTrustedProxies(nil)
+	}
+
 	router.Use(cors.New(cors.Config{
-		AllowOrigins: []string{"http://localhost:3000"},
+		AllowOrigins: config.AllowedOrigins(),
 		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
 		AllowHeaders: []string{
 			"Origin",
@@ -72,7 +82,7 @@ func InitRouter(
 		apiRouter.Group("/v1", middleWare.RestLogger),
 		middleWare,
 		useCaseContainer,
-		deps,
+		socketManager,
 	)
 
 	return router
@@ -43,6 +43,26 @@ func InitChatRoomRouter(
 		chatHandler.GetChatRoomMessages(c, chatUseCase)
 	})
 
+	// Send a message (same pipeline as WebSocket SEND_MESSAGE)
+	router.POST("/:id/messages", middleware.Authentication, func(c *gin.Context) {
+		chatHandler.SendMessage(c, chatUseCase)
+	})
+
+	// Edit a message (only the original sender)
+	router.PATCH("/:id/messages/:messageId", middleware.Authentication, func(c *gin.Context) {
+		chatHandler.EditMessage(c, chatUseCase)
+	})
+
+	// Delete a message for the caller or unsend it for everyone
+	router.DELETE("/:id/messages/:messageId", middleware.Authentication, func(c *gin.Context) {
+		chatHandler.DeleteMessage(c, chatUseCase)
+	})
+
+	// List replies to a message
+	router.GET("/:id/messages/:messageId/thread", middleware.Authentication, func(c *gin.Context) {
+		chatHandler.GetMessageThread(c, chatUseCase)
+	})
+
 	// Leave a chat room
 	router.POST("/:id/leave", middleware.Authentication, func(c *gin.Context) {
 		chatHandler.LeaveChatRoom(c, chatUseCase)
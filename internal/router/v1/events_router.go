@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"gochat-backend/internal/middleware"
+	"gochat-backend/internal/socket"
+	"gochat-backend/internal/usecase/auth"
+
+	wsHandler "gochat-backend/internal/handler/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitEventsRouter đăng ký stream SSE và các REST endpoint hành động đi kèm,
+// dành cho client không dùng được WebSocket
+func InitEventsRouter(
+	router gin.IRouter,
+	middleware middleware.Middleware,
+	socketManager *socket.SocketManager,
+	authUseCase auth.AuthUseCase,
+) {
+	// Mở stream bằng ticket dùng một lần (cấp qua POST /ws/ticket) thay vì access token trên URL
+	router.GET("", func(c *gin.Context) {
+		wsHandler.StreamEvents(c, socketManager, authUseCase)
+	})
+
+	router.POST("/messages", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.SendMessageAction(c, socketManager)
+	})
+
+	router.POST("/typing", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.TypingAction(c, socketManager)
+	})
+
+	router.POST("/read", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.ReadReceiptAction(c, socketManager)
+	})
+
+	router.POST("/resume", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.ResumeAction(c, socketManager)
+	})
+
+	router.POST("/rooms/:id/join", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.JoinRoomAction(c, socketManager)
+	})
+
+	router.POST("/rooms/:id/leave", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.LeaveRoomAction(c, socketManager)
+	})
+}
@@ -3,8 +3,10 @@ package v1
 import (
 	"gochat-backend/internal/middleware"
 	"gochat-backend/internal/usecase/profile"
+	"gochat-backend/internal/usecase/status"
 
 	profileHandler "gochat-backend/internal/handler/profile"
+	statusHandler "gochat-backend/internal/handler/user_status"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,7 +15,24 @@ func InitUserRouter(
 	router gin.IRouter,
 	middleware middleware.Middleware,
 	profileUseCase profile.ProfileUseCase,
+	statusUseCase status.StatusUseCase,
 ) {
+	router.GET("/me/status", middleware.Authentication, func(c *gin.Context) {
+		statusHandler.GetMyStatus(c, statusUseCase)
+	})
+
+	router.PUT("/me/status", middleware.Authentication, func(c *gin.Context) {
+		statusHandler.SetMyStatus(c, statusUseCase)
+	})
+
+	router.POST("/status", middleware.Authentication, func(c *gin.Context) {
+		statusHandler.GetUserStatuses(c, statusUseCase)
+	})
+
+	router.GET("/:id/status", middleware.Authentication, func(c *gin.Context) {
+		statusHandler.GetUserStatus(c, statusUseCase)
+	})
+
 	router.GET("/:id", middleware.Authentication, func(c *gin.Context) {
 		profileHandler.GetUserProfile(c, profileUseCase)
 	})
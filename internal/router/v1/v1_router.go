@@ -12,7 +12,7 @@ func InitV1Router(
 	r *gin.RouterGroup,
 	middleware middleware.Middleware,
 	useCaseContainer *usecase.UseCaseContainer,
-	deps *usecase.SharedDependencies,
+	socketManager *socket.SocketManager,
 ) {
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -25,7 +25,7 @@ func InitV1Router(
 	}
 
 	{
-		InitUserRouter(r.Group("/users"), middleware, useCaseContainer.Profile)
+		InitUserRouter(r.Group("/users"), middleware, useCaseContainer.Profile, useCaseContainer.UserStatus)
 	}
 
 	{
@@ -41,7 +41,7 @@ func InitV1Router(
 	}
 
 	{
-		socketManager := socket.NewSocketManager(deps, useCaseContainer.UserStatus)
-		InitWebSocketRouter(r.Group("/ws"), middleware, socketManager)
+		InitWebSocketRouter(r.Group("/ws"), middleware, socketManager, useCaseContainer.Auth)
+		InitEventsRouter(r.Group("/events"), middleware, socketManager, useCaseContainer.Auth)
 	}
 }
@@ -3,7 +3,7 @@ package v1
 import (
 	"gochat-backend/internal/middleware"
 	"gochat-backend/internal/socket"
-	"log"
+	"gochat-backend/internal/usecase/auth"
 
 	wsHandler "gochat-backend/internal/handler/websocket"
 
@@ -14,10 +14,20 @@ func InitWebSocketRouter(
 	router gin.IRouter,
 	middleware middleware.Middleware,
 	socketManager *socket.SocketManager,
+	authUseCase auth.AuthUseCase,
 ) {
-	// Route chính để kết nối WebSocket
-	router.GET("", middleware.Authentication, func(c *gin.Context) {
-		log.Printf("WebSocket connection request from user: %s", c.GetString("userId"))
-		wsHandler.HandleWebSocketConnection(c, socketManager)
+	// Route chính để kết nối WebSocket, xác thực bằng ticket thay vì access token
+	router.GET("", func(c *gin.Context) {
+		wsHandler.HandleWebSocketConnection(c, socketManager, authUseCase)
+	})
+
+	// Cấp ticket dùng một lần cho route kết nối
+	router.POST("/ticket", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.IssueWebSocketTicket(c, authUseCase)
+	})
+
+	// Số liệu hàng đợi gửi của các kết nối của user hiện tại
+	router.GET("/stats", middleware.Authentication, func(c *gin.Context) {
+		wsHandler.GetConnectionStats(c, socketManager)
 	})
 }
@@ -0,0 +1,245 @@
+package socket
+
+import (
+	"fmt"
+	"gochat-backend/config"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// messageClass phân loại frame gửi cho client theo mức độ được phép mất
+type messageClass int
+
+const (
+	messageClassChat      messageClass = iota // Tin nhắn và sự kiện liên quan: không bao giờ được bỏ
+	messageClassEphemeral                     // Typing, presence, danh sách user: có thể gộp hoặc bỏ
+)
+
+// classifyMessage trả về class của một loại message server gửi cho client.
+// Loại chưa biết mặc định là chat để không vô tình bỏ mất dữ liệu.
+func classifyMessage(messageType SocketMessageType) messageClass {
+	switch messageType {
+	case SocketMessageTypeTyping,
+		SocketMessageTypeUsers,
+		SocketMessageTypeUserJoined,
+		SocketMessageTypeUserLeft,
+		SocketMessageTypePresence,
+		SocketMessageTypePong:
+		return messageClassEphemeral
+	default:
+		return messageClassChat
+	}
+}
+
+// coalesceKeyFor trả về khóa gộp của frame ephemeral: frame mới cùng khóa thay thế frame
+// cũ đang chờ. Typing started/stopped của cùng một user trong phòng dùng chung một khóa.
+func coalesceKeyFor(chatRoomID string, message SocketMessage) string {
+	switch message.Type {
+	case SocketMessageTypeTyping:
+		return fmt.Sprintf("typing:%s:%s", chatRoomID, message.SenderID)
+	case SocketMessageTypeUsers:
+		return "users:" + chatRoomID
+	case SocketMessageTypeUserJoined, SocketMessageTypeUserLeft:
+		return fmt.Sprintf("presence:%s:%s", chatRoomID, message.SenderID)
+	case SocketMessageTypePresence:
+		return "status:" + message.SenderID
+	default:
+		return ""
+	}
+}
+
+const (
+	ChatOverflowSpill      = "spill"      // Đẩy frame chat vào hàng đợi tràn của kết nối
+	ChatOverflowDisconnect = "disconnect" // Ngắt kết nối để client đồng bộ lại bằng RESUME
+
+	EphemeralOverflowCoalesce = "coalesce" // Chỉ giữ frame mới nhất theo khóa gộp
+	EphemeralOverflowDrop     = "drop"     // Bỏ frame
+)
+
+// closeReasonResyncRequired là lý do đóng kết nối khi không thể giao frame chat,
+// client cần kết nối lại và gửi RESUME để lấy các tin nhắn bị lỡ
+const closeReasonResyncRequired = "resync required"
+
+// BackpressureConfig cấu hình cách xử lý khi kênh Send của client bị đầy
+type BackpressureConfig struct {
+	ChatPolicy      string
+	SpillQueueSize  int
+	EphemeralPolicy string
+}
+
+func NewBackpressureConfig(env *config.Environment) BackpressureConfig {
+	cfg := BackpressureConfig{
+		ChatPolicy:      strings.ToLower(env.SocketChatOverflowPolicy),
+		SpillQueueSize:  env.SocketSpillQueueSize,
+		EphemeralPolicy: strings.ToLower(env.SocketEphemeralOverflowPolicy),
+	}
+
+	if cfg.ChatPolicy != ChatOverflowSpill && cfg.ChatPolicy != ChatOverflowDisconnect {
+		log.Printf("Backpressure: Unknown chat overflow policy '%s', using '%s'", cfg.ChatPolicy, ChatOverflowSpill)
+		cfg.ChatPolicy = ChatOverflowSpill
+	}
+	if cfg.EphemeralPolicy != EphemeralOverflowCoalesce && cfg.EphemeralPolicy != EphemeralOverflowDrop {
+		log.Printf("Backpressure: Unknown ephemeral overflow policy '%s', using '%s'", cfg.EphemeralPolicy, EphemeralOverflowCoalesce)
+		cfg.EphemeralPolicy = EphemeralOverflowCoalesce
+	}
+	return cfg
+}
+
+// ClientQueueStats là số liệu hàng đợi gửi của một kết nối
+type ClientQueueStats struct {
+	UserID         string `json:"user_id"`
+	ConnID         string `json:"conn_id"`
+	QueueDepth     int    `json:"queue_depth"`     // Số frame đang chờ trong kênh Send
+	QueueCapacity  int    `json:"queue_capacity"`  // Sức chứa kênh Send
+	SpillDepth     int    `json:"spill_depth"`     // Số frame chat trong hàng đợi tràn
+	PendingMerged  int    `json:"pending_merged"`  // Số frame ephemeral đang chờ sau khi gộp
+	SpilledTotal   uint64 `json:"spilled_total"`   // Tổng số frame chat từng bị đẩy vào hàng đợi tràn
+	CoalescedTotal uint64 `json:"coalesced_total"` // Tổng số frame ephemeral bị frame mới hơn thay thế
+	DroppedTotal   uint64 `json:"dropped_total"`   // Tổng số frame bị bỏ
+	ResyncRequired bool   `json:"resync_required"` // Kết nối đã bị đóng vì không giao được frame chat
+}
+
+// clientQueue giữ phần backlog của kết nối khi kênh Send đầy. Frame chat nằm trong
+// spill theo đúng thứ tự, frame ephemeral nằm trong pending theo khóa gộp.
+type clientQueue struct {
+	spill         [][]byte
+	pending       map[string][]byte
+	pendingOrder  []string
+	resyncClosing bool
+
+	spilledTotal   atomic.Uint64
+	coalescedTotal atomic.Uint64
+	droppedTotal   atomic.Uint64
+}
+
+func (q *clientQueue) hasBacklog() bool {
+	return len(q.spill) > 0 || len(q.pending) > 0
+}
+
+// enqueue đưa frame vào hàng gửi của client theo chính sách backpressure của class.
+// Trả về false nếu frame bị bỏ (hoặc kết nối bị đóng để đồng bộ lại).
+func (c *Client) enqueue(frame []byte, class messageClass, coalesceKey string) bool {
+	policy := c.Hub.backpressure
+
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+
+	if c.queue.resyncClosing {
+		c.queue.droppedTotal.Add(1)
+		return false
+	}
+
+	// Khi đã có backlog, frame chat phải xếp sau backlog để giữ đúng thứ tự
+	if !c.queue.hasBacklog() || (class == messageClassEphemeral && coalesceKey == "") {
+		select {
+		case c.Send <- frame:
+			return true
+		default:
+		}
+	}
+
+	if class == messageClassEphemeral {
+		if policy.EphemeralPolicy != EphemeralOverflowCoalesce || coalesceKey == "" {
+			c.queue.droppedTotal.Add(1)
+			return false
+		}
+		if c.queue.pending == nil {
+			c.queue.pending = make(map[string][]byte)
+		}
+		if _, exists := c.queue.pending[coalesceKey]; exists {
+			c.queue.coalescedTotal.Add(1)
+		} else {
+			c.queue.pendingOrder = append(c.queue.pendingOrder, coalesceKey)
+		}
+		c.queue.pending[coalesceKey] = frame
+		return true
+	}
+
+	if policy.ChatPolicy == ChatOverflowSpill && len(c.queue.spill) < policy.SpillQueueSize {
+		c.queue.spill = append(c.queue.spill, frame)
+		c.queue.spilledTotal.Add(1)
+		return true
+	}
+
+	// Không thể giao frame chat: đóng kết nối để client kết nối lại và RESUME
+	c.queue.droppedTotal.Add(1)
+	c.requireResyncLocked()
+	return false
+}
+
+// requireResyncLocked đóng kết nối với lý do "resync required" (một lần duy nhất).
+// Caller phải giữ c.queueMutex.
+func (c *Client) requireResyncLocked() {
+	if c.queue.resyncClosing {
+		return
+	}
+	c.queue.resyncClosing = true
+	log.Printf("Client %s (conn %s): Send queue overflow (spill %d), closing with '%s'", c.ID, c.ConnID, len(c.queue.spill), closeReasonResyncRequired)
+	// WriteControl có thể chờ tới writeWait, không chặn goroutine đang fan-out
+	go c.closeWith(websocket.CloseTryAgainLater, closeReasonResyncRequired)
+}
+
+// drainBacklog chuyển backlog vào kênh Send khi còn chỗ. Được WritePump gọi sau mỗi
+// lần ghi nên backlog luôn được xả dần khi client đọc kịp trở lại.
+func (c *Client) drainBacklog() {
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+
+	// Báo cho sendBlocking đang chờ sau khi backlog đã được xả (defer chạy trước Unlock)
+	defer c.signalSendSpace()
+
+	for len(c.queue.spill) > 0 {
+		select {
+		case c.Send <- c.queue.spill[0]:
+			c.queue.spill[0] = nil
+			c.queue.spill = c.queue.spill[1:]
+		default:
+			return
+		}
+	}
+	if len(c.queue.spill) == 0 {
+		c.queue.spill = nil
+	}
+
+	for len(c.queue.pendingOrder) > 0 {
+		key := c.queue.pendingOrder[0]
+		select {
+		case c.Send <- c.queue.pending[key]:
+			delete(c.queue.pending, key)
+			c.queue.pendingOrder = c.queue.pendingOrder[1:]
+		default:
+			return
+		}
+	}
+	c.queue.pendingOrder = nil
+}
+
+// signalSendSpace đánh thức sendBlocking đang chờ kênh Send có chỗ, không block
+func (c *Client) signalSendSpace() {
+	select {
+	case c.sendSpace <- struct{}{}:
+	default:
+	}
+}
+
+// QueueStats trả về số liệu hàng đợi gửi hiện tại của kết nối
+func (c *Client) QueueStats() ClientQueueStats {
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+
+	return ClientQueueStats{
+		UserID:         c.ID,
+		ConnID:         c.ConnID,
+		QueueDepth:     len(c.Send),
+		QueueCapacity:  cap(c.Send),
+		SpillDepth:     len(c.queue.spill),
+		PendingMerged:  len(c.queue.pending),
+		SpilledTotal:   c.queue.spilledTotal.Load(),
+		CoalescedTotal: c.queue.coalescedTotal.Load(),
+		DroppedTotal:   c.queue.droppedTotal.Load(),
+		ResyncRequired: c.queue.resyncClosing,
+	}
+}
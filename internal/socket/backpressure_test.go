@@ -0,0 +1,79 @@
+//go:build unit
+// +build unit
+
+package socket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackpressureTestClient(sendSize int) (*Client, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	hub := &Hub{backpressure: BackpressureConfig{
+		ChatPolicy:      ChatOverflowSpill,
+		SpillQueueSize:  10,
+		EphemeralPolicy: EphemeralOverflowCoalesce,
+	}}
+	return &Client{
+		ID:        "user-1",
+		ConnID:    "conn-1",
+		Send:      make(chan []byte, sendSize),
+		Hub:       hub,
+		ctx:       ctx,
+		cancel:    cancel,
+		sendSpace: make(chan struct{}, 1),
+	}, cancel
+}
+
+// writeAll đọc kênh Send như WritePump (xả backlog sau mỗi frame) cho tới khi đủ count frame
+func writeAll(t *testing.T, client *Client, count int) []string {
+	var written []string
+	for len(written) < count {
+		select {
+		case frame := <-client.Send:
+			written = append(written, string(frame))
+			client.drainBacklog()
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d of %d frames: %v", len(written), count, written)
+		}
+	}
+	return written
+}
+
+func TestSendBlockingWaitsBehindSpilledFrames(t *testing.T) {
+	client, cancel := newBackpressureTestClient(1)
+	defer cancel()
+
+	require.True(t, client.enqueue([]byte("live-1"), messageClassChat, ""))
+	require.True(t, client.enqueue([]byte("live-2"), messageClassChat, ""))
+	require.Equal(t, 1, client.QueueStats().SpillDepth)
+
+	done := make(chan bool, 1)
+	go func() { done <- client.sendBlocking([]byte("replay")) }()
+
+	assert.Equal(t, []string{"live-1", "live-2", "replay"}, writeAll(t, client, 3))
+	assert.True(t, <-done)
+	assert.Zero(t, client.QueueStats().SpillDepth)
+}
+
+func TestSendBlockingStopsWhenClientDisconnects(t *testing.T) {
+	client, cancel := newBackpressureTestClient(1)
+
+	require.True(t, client.enqueue([]byte("live-1"), messageClassChat, ""))
+
+	done := make(chan bool, 1)
+	go func() { done <- client.sendBlocking([]byte("replay")) }()
+
+	cancel()
+	select {
+	case sent := <-done:
+		assert.False(t, sent)
+	case <-time.After(time.Second):
+		t.Fatal("sendBlocking did not return after the client disconnected")
+	}
+}
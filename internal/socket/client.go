@@ -3,6 +3,8 @@ package socket
 import (
 	"context"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,91 +17,221 @@ const (
 	maxMessageSize = 4096                // Kích thước tối đa của message.
 )
 
+// Client là một kết nối realtime (WebSocket hoặc SSE). Một user có thể có nhiều Client
+// cùng lúc (nhiều tab, nhiều thiết bị): ID là UserID dùng chung, ConnID định danh riêng
+// từng kết nối. Hub chỉ làm việc với Client, phần phụ thuộc giao thức nằm trong Conn.
 type Client struct {
 	ID     string
-	Conn   *websocket.Conn
-	Send   chan []byte
+	ConnID string
+	Conn   ClientConn  // WebSocket hoặc SSE
+	Send   chan []byte // Frame đã được mã hóa bằng codec của client
 	Hub    *Hub
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	codec Codec // Theo subprotocol thỏa thuận khi upgrade (JSON hoặc MessagePack)
+
+	// Tuần tự hóa các hành động gửi qua REST của kết nối SSE
+	dispatchMutex sync.Mutex
+
+	// Các active view kết nối đang ở trong (chỉ mục ngược), để khi disconnect
+	// chỉ gỡ khỏi các view này thay vì quét mọi view của Hub
+	viewsMutex sync.Mutex
+	views      map[string]struct{}
+
+	lastActivity atomic.Int64 // UnixNano của frame gần nhất client gửi (trừ PING), dùng để tự chuyển away
+
+	// Trạng thái rate limit cục bộ, chỉ được truy cập từ goroutine ReadPump
+	buckets          map[SocketMessageType]*tokenBucket
+	rateLimitStrikes int
+	mutedUntil       time.Time
+
+	// Trong lúc replay RESUME, sự kiện realtime của phòng được giữ lại trong held
+	// và chỉ được gửi sau khi replay xong để client nhận đúng thứ tự seq.
+	liveMutex sync.Mutex
+	holding   bool
+	held      [][]byte
+
+	// Backlog khi kênh Send đầy, xử lý theo BackpressureConfig của Hub
+	queueMutex sync.Mutex
+	queue      clientQueue
+
+	// Được báo mỗi khi WritePump ghi xong một frame (kênh Send vừa có chỗ), để gửi blocking
+	// chờ mà không giữ queueMutex
+	sendSpace chan struct{}
 }
 
-// Đọc message từ client và chuyển đến Hub xử lý
-func (c *Client) ReadPump() {
-	defer func() {
-		c.Hub.Unregister <- c
-		c.Conn.Close()
-		c.cancel()
-		log.Printf("Client %s: ReadPump stopped and unregistered.", c.ID)
-	}()
-
-	c.Conn.SetReadLimit(maxMessageSize)
-	c.Conn.SetReadDeadline(time.Now().UTC().Add(pongWait)) // Thiết lập deadline đọc ban đầu
-	c.Conn.SetPongHandler(func(string) error {             // Xử lý khi nhận được Pong message
-		c.Conn.SetReadDeadline(time.Now().UTC().Add(pongWait))
-		return nil
-	})
+// maxHeldLiveMessages giới hạn số sự kiện realtime giữ lại trong một lần replay
+const maxHeldLiveMessages = 512
 
-	for {
-		select {
-		case <-c.ctx.Done():
-			log.Printf("Client %s: Context done, exiting ReadPump.", c.ID)
-			return
-		default:
-			// Đọc message từ WebSocket
-			_, message, err := c.Conn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNoStatusReceived) {
-					log.Printf("Client %s: Error reading message: %v", c.ID, err)
-				} else {
-					log.Printf("Client %s: WebSocket closed: %v", c.ID, err) // Client tự đóng hoặc lỗi mạng
-				}
-				return // Thoát vòng lặp, defer sẽ được gọi
+// deliverLive gửi một sự kiện realtime cho client, không block.
+// Trả về false nếu sự kiện bị bỏ theo chính sách backpressure hoặc bộ đệm replay đầy.
+func (c *Client) deliverLive(message []byte, class messageClass, coalesceKey string) bool {
+	c.liveMutex.Lock()
+	if c.holding {
+		defer c.liveMutex.Unlock()
+		if len(c.held) >= maxHeldLiveMessages {
+			c.queueMutex.Lock()
+			c.queue.droppedTotal.Add(1)
+			if class == messageClassChat {
+				c.requireResyncLocked()
 			}
-			// Chuyển tin nhắn đến Hub xử lý với context
-			c.Hub.HandleMessageWithContext(c, message, c.ctx)
+			c.queueMutex.Unlock()
+			return false
 		}
+		c.held = append(c.held, message)
+		return true
 	}
+	c.liveMutex.Unlock()
+
+	return c.enqueue(message, class, coalesceKey)
 }
 
-// Gửi message tới client
-func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod) // Tạo ticker để gửi Ping định kỳ
-	defer func() {
-		ticker.Stop()
-		c.Conn.Close()
-		log.Printf("Client %s: WritePump stopped.", c.ID)
-	}()
+// holdLiveDelivery bắt đầu giữ lại sự kiện realtime trong lúc replay
+func (c *Client) holdLiveDelivery() {
+	c.liveMutex.Lock()
+	c.holding = true
+	c.liveMutex.Unlock()
+}
 
+// releaseLiveDelivery gửi lần lượt các sự kiện đã giữ lại rồi trở lại gửi trực tiếp
+func (c *Client) releaseLiveDelivery() {
 	for {
-		select {
-		case <-c.ctx.Done():
-			log.Printf("Client %s: Context done, exiting WritePump.", c.ID)
-			// Gửi CloseMessage khi context bị hủy (ví dụ từ ReadPump)
-			c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+		c.liveMutex.Lock()
+		if len(c.held) == 0 {
+			c.holding = false
+			c.liveMutex.Unlock()
 			return
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait)) // Đặt deadline cho việc ghi
-			if !ok {
-				// Kênh Send đã bị đóng (thường do Hub đóng khi unregister)
-				log.Printf("Client %s: Send channel closed.", c.ID)
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+		}
+		batch := c.held
+		c.held = nil
+		c.liveMutex.Unlock()
+
+		for _, message := range batch {
+			if !c.sendBlocking(message) {
+				c.liveMutex.Lock()
+				c.holding = false
+				c.held = nil
+				c.liveMutex.Unlock()
 				return
 			}
+		}
+	}
+}
 
-			// Ghi message ra WebSocket
-			err := c.Conn.WriteMessage(websocket.TextMessage, message)
-			if err != nil {
-				log.Printf("Client %s: Error writing message: %v", c.ID, err)
-				return // Thoát vòng lặp, defer sẽ được gọi
-			}
-		case <-ticker.C:
-			// Gửi ping định kỳ để giữ kết nối
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("Client %s: Error sending ping: %v", c.ID, err)
-				return // Thoát vòng lặp, defer sẽ được gọi
+func (c *Client) trackView(chatRoomID string) {
+	c.viewsMutex.Lock()
+	defer c.viewsMutex.Unlock()
+	if c.views == nil {
+		c.views = make(map[string]struct{})
+	}
+	c.views[chatRoomID] = struct{}{}
+}
+
+func (c *Client) untrackView(chatRoomID string) {
+	c.viewsMutex.Lock()
+	defer c.viewsMutex.Unlock()
+	delete(c.views, chatRoomID)
+}
+
+func (c *Client) inView(chatRoomID string) bool {
+	c.viewsMutex.Lock()
+	defer c.viewsMutex.Unlock()
+	_, exists := c.views[chatRoomID]
+	return exists
+}
+
+// activeViewIDs trả về bản sao danh sách phòng kết nối đang xem
+func (c *Client) activeViewIDs() []string {
+	c.viewsMutex.Lock()
+	defer c.viewsMutex.Unlock()
+	ids := make([]string, 0, len(c.views))
+	for id := range c.views {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// takeLocalToken lấy một token từ bucket cục bộ của kết nối cho loại message
+func (c *Client) takeLocalToken(messageType SocketMessageType, rule rateLimitRule, now time.Time) bool {
+	if c.buckets == nil {
+		c.buckets = make(map[SocketMessageType]*tokenBucket)
+	}
+
+	bucket, ok := c.buckets[messageType]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(rule.Burst), last: now}
+		c.buckets[messageType] = bucket
+	}
+	return bucket.take(rule, now)
+}
+
+// closeWithPolicyViolation đóng kết nối với mã 1008, ReadPump sẽ tự unregister
+func (c *Client) closeWithPolicyViolation(reason string) {
+	c.closeWith(websocket.ClosePolicyViolation, reason)
+}
+
+// closeWith đóng kết nối với mã và lý do theo mã đóng WebSocket
+func (c *Client) closeWith(code int, reason string) {
+	c.Conn.Close(code, reason)
+}
+
+// sendMessage mã hóa message bằng codec của client và gửi không block theo chính sách backpressure
+func (c *Client) sendMessage(message SocketMessage) bool {
+	frame, err := c.codec.Encode(message)
+	if err != nil {
+		log.Printf("Client %s: Error encoding message type '%s': %v", c.ID, message.Type, err)
+		return false
+	}
+
+	return c.enqueue(frame, classifyMessage(message.Type), "")
+}
+
+// sendMessageBlocking mã hóa message và chờ tới khi gửi được hoặc client ngắt kết nối
+func (c *Client) sendMessageBlocking(message SocketMessage) bool {
+	frame, err := c.codec.Encode(message)
+	if err != nil {
+		log.Printf("Client %s: Error encoding message type '%s': %v", c.ID, message.Type, err)
+		return false
+	}
+	return c.sendBlocking(frame)
+}
+
+// sendBlocking gửi frame chat và chờ tới khi gửi được hoặc client ngắt kết nối. Frame đi qua
+// cùng hàng gửi với enqueue: khi hàng tràn còn frame chat, frame phải chờ chúng được xả hết
+// để không vượt lên trước. Không giữ queueMutex trong lúc chờ để fan-out tới kết nối này
+// (vào held hoặc backlog) không bị chặn bởi client đọc chậm.
+func (c *Client) sendBlocking(message []byte) bool {
+	for {
+		c.queueMutex.Lock()
+		if c.queue.resyncClosing {
+			c.queueMutex.Unlock()
+			return false
+		}
+		if len(c.queue.spill) == 0 {
+			select {
+			case c.Send <- message:
+				c.queueMutex.Unlock()
+				return true
+			default:
 			}
 		}
+		c.queueMutex.Unlock()
+
+		select {
+		case <-c.sendSpace:
+		case <-c.ctx.Done():
+			return false
+		}
 	}
 }
+
+// ReadPump nhận frame từ client cho tới khi kết nối đóng rồi unregister khỏi Hub
+func (c *Client) ReadPump() {
+	c.Conn.ReadPump(c)
+}
+
+// WritePump ghi các frame trong kênh Send ra client
+func (c *Client) WritePump() {
+	c.Conn.WritePump(c)
+}
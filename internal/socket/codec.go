@@ -0,0 +1,197 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// Tên subprotocol client gửi trong header Sec-WebSocket-Protocol
+const (
+	SubprotocolJSON    = "gochat.json"
+	SubprotocolMsgPack = "gochat.msgpack"
+)
+
+// Codec mã hóa/giải mã SocketMessage trên đường truyền WebSocket.
+// Payload Data bên trong vẫn được xử lý dưới dạng JSON ở hub và MessageHandler,
+// codec chỉ quyết định định dạng của frame gửi/nhận với client.
+type Codec interface {
+	Subprotocol() string
+	FrameType() int // websocket.TextMessage hoặc websocket.BinaryMessage
+	Encode(message SocketMessage) ([]byte, error)
+	Decode(data []byte) (SocketMessage, error)
+}
+
+// supportedSubprotocols theo thứ tự ưu tiên của server khi client đề xuất nhiều subprotocol
+var supportedSubprotocols = []string{SubprotocolMsgPack, SubprotocolJSON}
+
+var (
+	jsonSocketCodec    Codec = jsonCodec{}
+	msgPackSocketCodec Codec = newMsgPackCodec()
+)
+
+// codecForSubprotocol trả về codec theo subprotocol đã thỏa thuận, mặc định là JSON
+func codecForSubprotocol(subprotocol string) Codec {
+	switch subprotocol {
+	case SubprotocolMsgPack:
+		return msgPackSocketCodec
+	default:
+		return jsonSocketCodec
+	}
+}
+
+// --- JSON ---
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string { return SubprotocolJSON }
+
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Encode(message SocketMessage) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (jsonCodec) Decode(data []byte) (SocketMessage, error) {
+	var message SocketMessage
+	err := json.Unmarshal(data, &message)
+	return message, err
+}
+
+// --- MessagePack ---
+
+// msgPackEnvelope là SocketMessage trên đường truyền MessagePack: Data là map/array
+// MessagePack thật thay vì chuỗi JSON lồng bên trong
+type msgPackEnvelope struct {
+	Type      string `codec:"type"`
+	SenderID  string `codec:"sender_id"`
+	Timestamp int64  `codec:"timestamp"`
+	Data      any    `codec:"data,omitempty"`
+}
+
+type msgPackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgPackCodec() *msgPackCodec {
+	handle := &codec.MsgpackHandle{}
+	handle.WriteExt = true    // Dùng kiểu str/bin của spec mới
+	handle.RawToString = true // Client cũ gửi raw thì vẫn đọc thành string
+	handle.MapType = reflect.TypeOf(map[string]any(nil))
+	return &msgPackCodec{handle: handle}
+}
+
+func (c *msgPackCodec) Subprotocol() string { return SubprotocolMsgPack }
+
+func (c *msgPackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (c *msgPackCodec) Encode(message SocketMessage) ([]byte, error) {
+	envelope := msgPackEnvelope{
+		Type:      string(message.Type),
+		SenderID:  message.SenderID,
+		Timestamp: message.Timestamp,
+	}
+
+	if len(message.Data) > 0 {
+		data, err := decodeJSONValue(message.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message data: %w", err)
+		}
+		envelope.Data = data
+	}
+
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, c.handle).Encode(envelope); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgPackCodec) Decode(data []byte) (SocketMessage, error) {
+	var envelope msgPackEnvelope
+	if err := codec.NewDecoderBytes(data, c.handle).Decode(&envelope); err != nil {
+		return SocketMessage{}, err
+	}
+
+	message := SocketMessage{
+		Type:      SocketMessageType(envelope.Type),
+		SenderID:  envelope.SenderID,
+		Timestamp: envelope.Timestamp,
+	}
+
+	if envelope.Data != nil {
+		raw, err := json.Marshal(envelope.Data)
+		if err != nil {
+			return SocketMessage{}, fmt.Errorf("invalid message data: %w", err)
+		}
+		message.Data = raw
+	}
+	return message, nil
+}
+
+// decodeJSONValue giải mã JSON thành giá trị Go, giữ số nguyên là int64
+// (thay vì float64) để MessagePack mã hóa gọn và đúng kiểu
+func decodeJSONValue(raw json.RawMessage) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return normalizeJSONNumbers(value), nil
+}
+
+func normalizeJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeJSONNumbers(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeJSONNumbers(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// encodedMessage mã hóa một SocketMessage tối đa một lần cho mỗi codec khi fan-out
+// tới nhiều client, tránh marshal lại cho từng người nhận
+type encodedMessage struct {
+	message SocketMessage
+	frames  map[string][]byte
+}
+
+func newEncodedMessage(message SocketMessage) *encodedMessage {
+	return &encodedMessage{message: message, frames: make(map[string][]byte, 2)}
+}
+
+// frameFor trả về frame đã mã hóa theo codec của client. Không an toàn khi dùng
+// đồng thời từ nhiều goroutine; mỗi lần fan-out tạo encodedMessage riêng.
+func (m *encodedMessage) frameFor(client *Client) ([]byte, error) {
+	name := client.codec.Subprotocol()
+	if frame, ok := m.frames[name]; ok {
+		return frame, nil
+	}
+
+	frame, err := client.codec.Encode(m.message)
+	if err != nil {
+		return nil, err
+	}
+	m.frames[name] = frame
+	return frame, nil
+}
@@ -0,0 +1,20 @@
+package socket
+
+// Tên transport của kết nối
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// ClientConn là phần phụ thuộc giao thức của một Client. Hub, backpressure, RESUME
+// và MessageHandler chỉ làm việc với Client nên WebSocket và SSE được xử lý như nhau.
+type ClientConn interface {
+	Transport() string
+	// ReadPump nhận frame từ client và chuyển cho Hub cho tới khi kết nối đóng,
+	// sau đó unregister client. Kết nối chỉ nhận (SSE) thì chỉ chờ tới khi đóng.
+	ReadPump(c *Client)
+	// WritePump ghi các frame trong c.Send ra client
+	WritePump(c *Client)
+	// Close đóng kết nối với mã và lý do theo mã đóng WebSocket
+	Close(code int, reason string)
+}
@@ -0,0 +1,112 @@
+package socket
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseConn là ClientConn trên Server-Sent Events, dành cho mạng chặn WebSocket upgrade.
+// Kết nối chỉ nhận: client gửi hành động qua các REST endpoint đi kèm.
+// Mỗi frame là một SocketMessage JSON trong một sự kiện "data:".
+type sseConn struct {
+	writer     http.ResponseWriter
+	controller *http.ResponseController
+	requestCtx context.Context
+
+	closeOnce   sync.Once
+	closed      chan struct{}
+	closeCode   int
+	closeReason string
+}
+
+// ssePayloadClose là dữ liệu của sự kiện "close", tương đương close frame của WebSocket
+type ssePayloadClose struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+func newSSEConn(w http.ResponseWriter, r *http.Request) *sseConn {
+	return &sseConn{
+		writer:     w,
+		controller: http.NewResponseController(w),
+		requestCtx: r.Context(),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (s *sseConn) Transport() string { return TransportSSE }
+
+// Close yêu cầu WritePump gửi sự kiện close rồi kết thúc stream.
+// ResponseWriter không an toàn khi ghi đồng thời nên chỉ WritePump được ghi.
+func (s *sseConn) Close(code int, reason string) {
+	s.closeOnce.Do(func() {
+		s.closeCode = code
+		s.closeReason = reason
+		close(s.closed)
+	})
+}
+
+// ReadPump của SSE chỉ chờ tới khi client ngắt request hoặc server đóng stream
+func (s *sseConn) ReadPump(c *Client) {
+	defer func() {
+		c.Hub.unregister(c)
+		c.cancel()
+		log.Printf("Client %s (conn %s): SSE stream ended and unregistered.", c.ID, c.ConnID)
+	}()
+
+	select {
+	case <-s.requestCtx.Done():
+	case <-s.closed:
+	case <-c.ctx.Done():
+	}
+}
+
+// WritePump ghi frame ra stream. Phải chạy trong goroutine của HTTP handler
+// vì ResponseWriter hết hiệu lực khi handler trả về.
+func (s *sseConn) WritePump(c *Client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		s.Close(0, "")
+		log.Printf("Client %s: SSE WritePump stopped.", c.ID)
+	}()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-s.requestCtx.Done():
+			return
+		case <-s.closed:
+			// Báo lý do cho client (ví dụ "resync required") trước khi kết thúc stream
+			s.write("event: close\ndata: " + string(mustMarshal(ssePayloadClose{Code: s.closeCode, Reason: s.closeReason})) + "\n\n")
+			return
+		case message, ok := <-c.Send:
+			if !ok {
+				return
+			}
+			if err := s.write("data: " + string(message) + "\n\n"); err != nil {
+				log.Printf("Client %s: Error writing SSE event: %v", c.ID, err)
+				return
+			}
+			c.drainBacklog()
+		case <-ticker.C:
+			// Comment giữ kết nối qua proxy, EventSource bỏ qua dòng này
+			if err := s.write(": ping\n\n"); err != nil {
+				log.Printf("Client %s: Error sending SSE ping: %v", c.ID, err)
+				return
+			}
+		}
+	}
+}
+
+func (s *sseConn) write(event string) error {
+	s.controller.SetWriteDeadline(time.Now().Add(writeWait))
+	if _, err := s.writer.Write([]byte(event)); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
@@ -0,0 +1,110 @@
+package socket
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketConn là ClientConn trên gorilla/websocket
+type websocketConn struct {
+	conn *websocket.Conn
+}
+
+func newWebSocketConn(conn *websocket.Conn) *websocketConn {
+	return &websocketConn{conn: conn}
+}
+
+func (w *websocketConn) Transport() string { return TransportWebSocket }
+
+// Close gửi close frame rồi đóng kết nối, ReadPump sẽ tự unregister
+func (w *websocketConn) Close(code int, reason string) {
+	closeMessage := websocket.FormatCloseMessage(code, reason)
+	if err := w.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(writeWait)); err != nil {
+		log.Printf("WebSocket %s: Error sending close frame (%d): %v", w.conn.RemoteAddr(), code, err)
+	}
+	w.conn.Close()
+}
+
+// Đọc message từ client và chuyển đến Hub xử lý
+func (w *websocketConn) ReadPump(c *Client) {
+	defer func() {
+		c.Hub.unregister(c)
+		w.conn.Close()
+		c.cancel()
+		log.Printf("Client %s (conn %s): ReadPump stopped and unregistered.", c.ID, c.ConnID)
+	}()
+
+	w.conn.SetReadLimit(maxMessageSize)
+	w.conn.SetReadDeadline(time.Now().UTC().Add(pongWait)) // Thiết lập deadline đọc ban đầu
+	w.conn.SetPongHandler(func(string) error {             // Xử lý khi nhận được Pong message
+		w.conn.SetReadDeadline(time.Now().UTC().Add(pongWait))
+		return nil
+	})
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Printf("Client %s: Context done, exiting ReadPump.", c.ID)
+			return
+		default:
+			// Đọc message từ WebSocket
+			_, message, err := w.conn.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNoStatusReceived) {
+					log.Printf("Client %s: Error reading message: %v", c.ID, err)
+				} else {
+					log.Printf("Client %s: WebSocket closed: %v", c.ID, err) // Client tự đóng hoặc lỗi mạng
+				}
+				return // Thoát vòng lặp, defer sẽ được gọi
+			}
+			// Chuyển tin nhắn đến Hub xử lý với context
+			c.Hub.HandleMessageWithContext(c, message, c.ctx)
+		}
+	}
+}
+
+// Gửi message tới client
+func (w *websocketConn) WritePump(c *Client) {
+	ticker := time.NewTicker(pingPeriod) // Tạo ticker để gửi Ping định kỳ
+	defer func() {
+		ticker.Stop()
+		w.conn.Close()
+		log.Printf("Client %s: WritePump stopped.", c.ID)
+	}()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			log.Printf("Client %s: Context done, exiting WritePump.", c.ID)
+			// Gửi CloseMessage khi context bị hủy (ví dụ từ ReadPump)
+			w.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case message, ok := <-c.Send:
+			w.conn.SetWriteDeadline(time.Now().Add(writeWait)) // Đặt deadline cho việc ghi
+			if !ok {
+				// Kênh Send đã bị đóng (thường do Hub đóng khi unregister)
+				log.Printf("Client %s: Send channel closed.", c.ID)
+				w.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			// Ghi message ra WebSocket (text cho JSON, binary cho MessagePack)
+			err := w.conn.WriteMessage(c.codec.FrameType(), message)
+			if err != nil {
+				log.Printf("Client %s: Error writing message: %v", c.ID, err)
+				return // Thoát vòng lặp, defer sẽ được gọi
+			}
+			// Kênh Send vừa có chỗ, xả backlog tích lũy trong lúc client đọc chậm
+			c.drainBacklog()
+		case <-ticker.C:
+			// Gửi ping định kỳ để giữ kết nối
+			w.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := w.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("Client %s: Error sending ping: %v", c.ID, err)
+				return // Thoát vòng lặp, defer sẽ được gọi
+			}
+		}
+	}
+}
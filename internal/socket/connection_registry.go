@@ -0,0 +1,146 @@
+package socket
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// Thời gian tối đa cho mỗi thao tác ghi registry
+	registryOperationTimeout = 5 * time.Second
+	// Số cập nhật registry được xếp hàng cho mỗi shard trước khi vòng lặp shard phải chờ
+	registryUpdateQueueSize = 1024
+)
+
+// registryUpdate ghi nhận user có (connected=true) hoặc không còn kết nối trên instance này
+type registryUpdate struct {
+	userID    string
+	connected bool
+}
+
+// queueRegistryUpdate xếp cập nhật registry vào hàng đợi của shard. Mọi kết nối của user
+// thuộc cùng shard nên thứ tự thêm/xóa của một user được giữ nguyên khi ghi vào Redis.
+func (h *Hub) queueRegistryUpdate(shard *hubShard, userID string, connected bool) {
+	if h.registry == nil {
+		return
+	}
+	shard.registryUpdates <- registryUpdate{userID: userID, connected: connected}
+}
+
+// runRegistrySync ghi các cập nhật registry của shard vào Redis theo thứ tự
+func (h *Hub) runRegistrySync(shard *hubShard) {
+	for update := range shard.registryUpdates {
+		ctx, cancel := context.WithTimeout(context.Background(), registryOperationTimeout)
+		var err error
+		if update.connected {
+			err = h.registry.AddUser(ctx, h.instanceID, update.userID)
+		} else {
+			err = h.registry.RemoveUser(ctx, h.instanceID, update.userID)
+		}
+		cancel()
+
+		if err != nil {
+			log.Printf("Hub: Failed to sync connection registry for user %s: %v", update.userID, err)
+		}
+	}
+}
+
+// runConnectionRegistry gia hạn heartbeat của instance và dọn dữ liệu của các instance
+// đã chết (crash, mất mạng) cho tới khi instance drain.
+func (h *Hub) runConnectionRegistry() {
+	if h.registry == nil {
+		return
+	}
+
+	for _, shard := range h.shards {
+		go h.runRegistrySync(shard)
+	}
+
+	interval := max(h.registryTTL/3, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("Hub: Connection registry running for instance %s (heartbeat every %s)", h.instanceID, interval)
+	for {
+		h.renewRegistryHeartbeat()
+
+		select {
+		case <-h.registryCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Hub) renewRegistryHeartbeat() {
+	ctx, cancel := context.WithTimeout(h.registryCtx, registryOperationTimeout)
+	defer cancel()
+
+	restored, err := h.registry.Heartbeat(ctx, h.instanceID, h.registryTTL)
+	if err != nil {
+		log.Printf("Hub: Failed to renew connection registry heartbeat: %v", err)
+		return
+	}
+
+	// Instance từng bị coi là đã chết (heartbeat trễ quá TTL) và đã bị dọn:
+	// đăng ký lại các user đang kết nối để không lỡ sự kiện của họ
+	if restored {
+		var userIDs []string
+		h.forEachUser(func(userID string, _ map[string]*Client) {
+			userIDs = append(userIDs, userID)
+		})
+		for _, userID := range userIDs {
+			if err := h.registry.AddUser(ctx, h.instanceID, userID); err != nil {
+				log.Printf("Hub: Failed to re-register user %s in connection registry: %v", userID, err)
+			}
+		}
+		if len(userIDs) > 0 {
+			log.Printf("Hub: Re-registered %d users in connection registry", len(userIDs))
+		}
+	}
+
+	removed, err := h.registry.CleanupDeadInstances(ctx)
+	if err != nil {
+		log.Printf("Hub: Failed to clean up dead instances in connection registry: %v", err)
+		return
+	}
+	if len(removed) > 0 {
+		log.Printf("Hub: Cleaned up connection registry of dead instances %v", removed)
+	}
+}
+
+// leaveConnectionRegistry dừng heartbeat và xóa instance khỏi registry khi drain,
+// để các instance khác ngừng gửi sự kiện tới đây ngay thay vì chờ hết TTL
+func (h *Hub) leaveConnectionRegistry(ctx context.Context) error {
+	if h.registry == nil {
+		return nil
+	}
+	h.stopRegistry()
+	return h.registry.RemoveInstance(ctx, h.instanceID)
+}
+
+// userConnectedElsewhere cho biết theo connection registry user còn kết nối trên instance khác
+// instance này không. Không dùng registry hoặc tra cứu lỗi thì coi như không, để user không bị
+// kẹt online khi Redis lỗi.
+func (h *Hub) userConnectedElsewhere(userID string) bool {
+	if h.registry == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), registryOperationTimeout)
+	defer cancel()
+
+	usersByInstance, err := h.registry.FindUserInstances(ctx, []string{userID})
+	if err != nil {
+		log.Printf("Hub: Failed to look up other instances of user %s: %v", userID, err)
+		return false
+	}
+
+	for instanceID := range usersByInstance {
+		if instanceID != h.instanceID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrServerDraining khi instance đang drain và không nhận kết nối mới
+var ErrServerDraining = errors.New("server is draining connections")
+
+const (
+	reconnectReasonServiceRestart = "service_restart"
+	closeReasonServiceRestart     = "service restart"
+
+	// Chu kỳ kiểm tra kênh Send của client đã được ghi hết chưa
+	drainFlushPollInterval = 50 * time.Millisecond
+)
+
+// Drain đóng êm mọi kết nối realtime trước khi instance dừng (shutdown hoặc rolling deploy):
+// ngừng nhận kết nối mới, gửi RECONNECT kèm thời gian chờ ngẫu nhiên, ghi hết các frame
+// đang chờ rồi đóng với mã 1012, rời connection registry, sau đó dừng consumer của event bus.
+// User không bị chuyển offline vì họ sẽ kết nối lại vào instance khác. Hàm trả về khi xong
+// hoặc ctx hết hạn.
+func (sm *SocketManager) Drain(ctx context.Context) error {
+	return sm.Hub.drain(ctx)
+}
+
+// rejectIfDraining trả về true (và đã phản hồi 503) nếu instance đang drain.
+// Retry-After giúp client không kết nối lại ngay vào instance sắp dừng.
+func (sm *SocketManager) rejectIfDraining(w http.ResponseWriter, userID string) bool {
+	if !sm.Hub.draining.Load() {
+		return false
+	}
+
+	log.Printf("SocketManager: Rejected connection of user %s, server is draining", userID)
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(sm.Hub.drainJitter.Seconds()))))
+	http.Error(w, ErrServerDraining.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+func (h *Hub) drain(ctx context.Context) error {
+	if !h.draining.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	clients := h.allConnections()
+
+	log.Printf("Hub: Draining %d connections", len(clients))
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			client.sendMessage(SocketMessage{
+				Type:      SocketMessageTypeReconnect,
+				SenderID:  "system",
+				Timestamp: time.Now().UTC().UnixMilli(),
+				Data: mustMarshal(ReconnectPayload{
+					Reason:  reconnectReasonServiceRestart,
+					DelayMs: h.reconnectDelay().Milliseconds(),
+				}),
+			})
+			client.flushAndClose(ctx, websocket.CloseServiceRestart, closeReasonServiceRestart)
+		}(client)
+	}
+	wg.Wait()
+
+	if err := h.leaveConnectionRegistry(ctx); err != nil {
+		log.Printf("Hub: Failed to remove instance %s from connection registry: %v", h.instanceID, err)
+	}
+
+	log.Printf("Hub: All connections drained, stopping event bus consumer")
+	return h.stopEventConsumer(ctx)
+}
+
+// reconnectDelay trả về thời gian chờ ngẫu nhiên để các client không kết nối lại cùng lúc
+func (h *Hub) reconnectDelay() time.Duration {
+	if h.drainJitter <= 0 {
+		return 0
+	}
+	return rand.N(h.drainJitter)
+}
+
+// flushAndClose chờ kênh Send và backlog được ghi hết (hoặc ctx hết hạn) rồi đóng kết nối
+func (c *Client) flushAndClose(ctx context.Context, code int, reason string) {
+	ticker := time.NewTicker(drainFlushPollInterval)
+	defer ticker.Stop()
+
+	for !c.sendQueueEmpty() {
+		select {
+		case <-ctx.Done():
+			log.Printf("Client %s (conn %s): Drain deadline reached with %d frames pending", c.ID, c.ConnID, len(c.Send))
+			c.closeWith(code, reason)
+			return
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+	c.closeWith(code, reason)
+}
+
+func (c *Client) sendQueueEmpty() bool {
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+	return len(c.Send) == 0 && !c.queue.hasBacklog()
+}
+
+// stopEventConsumer hủy context của consumer và chờ consumer thoát
+func (h *Hub) stopEventConsumer(ctx context.Context) error {
+	h.stopConsumer()
+
+	select {
+	case <-h.consumerDone:
+		log.Println("Hub: Event bus consumer stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
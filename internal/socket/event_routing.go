@@ -0,0 +1,61 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gochat-backend/internal/infra/eventbus"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/usecase/chat"
+	"gochat-backend/internal/usecase/status"
+)
+
+// NewEventRecipientResolver trả về resolver xác định user nhận từng loại sự kiện, khớp với
+// cách handleBusEvent gửi sự kiện đó, để event bus chỉ gửi tới instance có người nhận.
+// membership_changed không có người nhận cụ thể: mọi instance cần nó để làm mới cache.
+func NewEventRecipientResolver(roomMembers *RoomMemberCache) eventbus.RecipientResolver {
+	return func(ctx context.Context, event *kafkainfra.MQEvent) ([]string, bool, error) {
+		switch event.EventType {
+		case kafkainfra.UserOnline, kafkainfra.UserOffline, kafkainfra.UserStatusChanged:
+			var payload status.PresenceChangedOutput
+			if err := json.Unmarshal(event.Metadata, &payload); err != nil {
+				return nil, false, fmt.Errorf("failed to unmarshal presence payload: %w", err)
+			}
+			return payload.Recipients, true, nil
+
+		case kafkainfra.MessageDeleted:
+			var deleted chat.MessageDeletedOutput
+			if err := json.Unmarshal(event.Metadata, &deleted); err != nil {
+				return nil, false, fmt.Errorf("failed to unmarshal message deleted payload: %w", err)
+			}
+			if deleted.Mode == chat.DeleteForMe {
+				return []string{deleted.DeletedBy}, true, nil
+			}
+			return roomMemberIDs(ctx, roomMembers, event.ChatRoomID)
+
+		case kafkainfra.MessageSent, kafkainfra.MessageEdited, kafkainfra.MessageRead,
+			kafkainfra.ReactionAdded, kafkainfra.ReactionRemoved,
+			kafkainfra.TypingStarted, kafkainfra.TypingStopped,
+			kafkainfra.UserJoinedRoom, kafkainfra.UserLeftRoom:
+			// Sự kiện active view chỉ tới người đang xem phòng, họ đều là thành viên phòng
+			return roomMemberIDs(ctx, roomMembers, event.ChatRoomID)
+
+		case kafkainfra.MembershipChanged:
+			// Làm mới cache của instance đang publish ngay, không chờ sự kiện quay lại qua bus,
+			// để tin nhắn gửi ngay sau đó được định tuyến theo danh sách thành viên mới
+			roomMembers.Invalidate(event.ChatRoomID)
+			return nil, false, nil
+
+		default:
+			return nil, false, nil
+		}
+	}
+}
+
+func roomMemberIDs(ctx context.Context, roomMembers *RoomMemberCache, chatRoomID string) ([]string, bool, error) {
+	memberIDs, err := roomMembers.MemberIDs(ctx, chatRoomID)
+	if err != nil {
+		return nil, false, err
+	}
+	return memberIDs, true, nil
+}
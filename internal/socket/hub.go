@@ -3,32 +3,42 @@ package socket
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gochat-backend/internal/infra/eventbus"
 	"gochat-backend/internal/infra/kafkainfra"
 	"gochat-backend/internal/repository"
 	"gochat-backend/internal/usecase"
+	"gochat-backend/internal/usecase/chat"
 	"gochat-backend/internal/usecase/status"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// ChatRoomActiveView quản lý các client đang chủ động xem một phòng chat cụ thể.
+// ChatRoomActiveView quản lý các kết nối đang chủ động xem một phòng chat cụ thể.
 type ChatRoomActiveView struct {
 	ID      string
-	Clients map[string]*Client
+	Clients map[string]*Client // Map connID -> client
 	mutex   sync.RWMutex
+	closed  bool // Đã bị xóa khỏi shard vì rỗng, kết nối mới phải dùng view mới
+}
+
+// hasUser kiểm tra user còn kết nối nào trong view không. Caller phải giữ view.mutex.
+func (v *ChatRoomActiveView) hasUser(userID string) bool {
+	for _, client := range v.Clients {
+		if client.ID == userID {
+			return true
+		}
+	}
+	return false
 }
 
 // Hub quản lý các phòng chat và kết nối
 type Hub struct {
-	ActiveRoomViews map[string]*ChatRoomActiveView
-	Clients         map[string]*Client // Map userId -> client
-
-	Register   chan *Client
-	Unregister chan *Client
-
-	mutex sync.RWMutex
+	// Kết nối và active view được chia vào các shard theo hash của UserID/ChatRoomID
+	shards []*hubShard
 
 	MessageHandler *MessageHandler
 
@@ -36,62 +46,77 @@ type Hub struct {
 
 	accountRepo  repository.AccountRepository
 	chatRoomRepo repository.ChatRoomRepository
+	roomMembers  *RoomMemberCache // Thành viên phòng cho fan-out, không truy vấn DB cho mỗi tin nhắn
+
+	eventBus eventbus.EventBus
+
+	backpressure BackpressureConfig // Chính sách khi kênh Send của client bị đầy
+
+	typing   *typingTracker     // Trạng thái typing theo (room, user) có TTL
+	presence *presenceDebouncer // Trì hoãn offline để tránh nhấp nháy khi reconnect
+	idle     *idleTracker       // User bị tự chuyển away vì không hoạt động
+
+	// Drain khi shutdown: không nhận kết nối mới, không chuyển offline user đang kết nối
+	draining    atomic.Bool
+	drainJitter time.Duration
 
-	kafkaService *kafkainfra.KafkaService
+	// Dừng consumer của event bus khi drain, consumerDone đóng khi consumer đã thoát
+	consumerCtx  context.Context
+	stopConsumer context.CancelFunc
+	consumerDone chan struct{}
+
+	// Connection registry: instance nào giữ kết nối của user, nil khi không định tuyến theo instance
+	instanceID   string
+	registry     repository.ConnectionRegistry
+	registryTTL  time.Duration
+	registryCtx  context.Context
+	stopRegistry context.CancelFunc
 }
 
 // NewHub khởi tạo Hub mới
-func NewHub(deps *usecase.SharedDependencies, statusUseCase status.StatusUseCase) *Hub {
+func NewHub(deps *usecase.SharedDependencies, statusUseCase status.StatusUseCase, chatUseCase chat.ChatUseCase, roomMembers *RoomMemberCache) *Hub {
 	hub := &Hub{
-		ActiveRoomViews: make(map[string]*ChatRoomActiveView),
-		Clients:         make(map[string]*Client),
-		Register:        make(chan *Client),
-		Unregister:      make(chan *Client),
-		statusUseCase:   statusUseCase,
-		accountRepo:     deps.AccountRepo,
-		chatRoomRepo:    deps.ChatRoomRepo,
-		kafkaService:    deps.KafkaService,
+		shards:        newHubShards(deps.Config.SocketHubShards),
+		statusUseCase: statusUseCase,
+		accountRepo:   deps.AccountRepo,
+		chatRoomRepo:  deps.ChatRoomRepo,
+		roomMembers:   roomMembers,
+		eventBus:      deps.EventBus,
+		backpressure:  NewBackpressureConfig(deps.Config),
+		typing:        newTypingTracker(time.Duration(deps.Config.SocketTypingTTLSeconds) * time.Second),
+		presence:      newPresenceDebouncer(time.Duration(deps.Config.SocketPresenceDebounceSeconds) * time.Second),
+		idle:          newIdleTracker(time.Duration(deps.Config.SocketIdleAwaySeconds) * time.Second),
+		drainJitter:   time.Duration(deps.Config.SocketDrainReconnectJitterSeconds) * time.Second,
+		consumerDone:  make(chan struct{}),
+		instanceID:    deps.InstanceID,
+		registry:      deps.ConnectionRegistry,
+		registryTTL:   time.Duration(deps.Config.ConnectionRegistryTTLSeconds) * time.Second,
 	}
+	hub.consumerCtx, hub.stopConsumer = context.WithCancel(context.Background())
+	hub.registryCtx, hub.stopRegistry = context.WithCancel(context.Background())
 
 	hub.MessageHandler = NewMessageHandler(
 		hub,
 		deps.ChatRoomRepo,
-		deps.MessageRepo,
-		deps.AccountRepo,
+		chatUseCase,
+		NewRateLimiter(NewRateLimitConfig(deps.Config), deps.RedisService),
 	)
 	return hub
 }
 
-// Run khởi chạy Hub
+// Run khởi chạy vòng lặp register/unregister của mọi shard và chờ chúng
 func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.Register:
-			h.mutex.Lock()
-			h.Clients[client.ID] = client
-			h.mutex.Unlock()
-			log.Printf("Client %s registered to hub", client.ID)
-
-		case client := <-h.Unregister:
-			userID := client.ID
-
-			// Cập nhật trạng thái offline
-			if err := h.statusUseCase.SetUserOffline(context.Background(), userID); err != nil {
-				log.Printf("Error setting user %s offline: %v", userID, err)
-			}
-
-			h.removeClientFromAllActiveViews(client)
-
-			h.mutex.Lock()
-			if _, exists := h.Clients[userID]; exists {
-				delete(h.Clients, userID)
-				log.Printf("Client %s (UserID) unregistered from Hub. Total online: %d", userID, len(h.Clients))
-			}
-
-			h.mutex.Unlock()
-			log.Printf("Client %s unregistered from hub", client.ID)
-		}
+	log.Printf("Hub: Running with %d shards", len(h.shards))
+
+	var wg sync.WaitGroup
+	for _, shard := range h.shards {
+		wg.Add(1)
+		go func(shard *hubShard) {
+			defer wg.Done()
+			h.runShard(shard)
+		}(shard)
 	}
+	wg.Wait()
 }
 
 func (h *Hub) HandleMessageWithContext(client *Client, data []byte, ctx context.Context) {
@@ -100,40 +125,60 @@ func (h *Hub) HandleMessageWithContext(client *Client, data []byte, ctx context.
 
 // Gửi tin nhắn đến TẤT CẢ THÀNH VIÊN (DB) của phòng đang online
 func (h *Hub) DeliverMessageToRoomRecipients(ctx context.Context, chatRoomID string, message SocketMessage) {
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshalling message for room %s: %v", chatRoomID, err)
-		return
-	}
-
-	// 1. Lấy danh sách thành viên của phòng từ DB
-	roomMembersDB, err := h.chatRoomRepo.FindChatRoomMembers(ctx, chatRoomID)
+	// Danh sách thành viên lấy từ cache, chỉ truy vấn DB khi phòng chưa có trong cache
+	memberIDs, err := h.roomMembers.MemberIDs(ctx, chatRoomID)
 	if err != nil {
-		log.Printf("Hub: Error fetching DB members for room %s: %v", chatRoomID, err)
+		log.Printf("Hub: Error fetching members for room %s: %v", chatRoomID, err)
 		return
 	}
 
-	if len(roomMembersDB) == 0 {
+	if len(memberIDs) == 0 {
 		log.Printf("Hub: No DB members found for room %s. Message not delivered.", chatRoomID)
 		return
 	}
 
-	log.Printf("Hub: Delivering message type '%s' to %d DB members of room %s", message.Type, len(roomMembersDB), chatRoomID)
+	log.Printf("Hub: Delivering message type '%s' to %d DB members of room %s", message.Type, len(memberIDs), chatRoomID)
 
-	for _, member := range roomMembersDB {
-		recipientID := member.UserId
+	h.deliverToRoomMembers(chatRoomID, memberIDs, message)
+}
 
-		// 2. Kiểm tra xem thành viên có online không và lấy *Client
-		h.mutex.RLock()
-		recipientClient, isOnline := h.Clients[recipientID]
-		h.mutex.RUnlock()
+// deliverRoomEvent gửi message của sự kiện phòng. Sự kiện đã được định tuyến tới instance
+// này mang sẵn người nhận nên không cần tra thành viên phòng từ DB.
+func (h *Hub) deliverRoomEvent(event *kafkainfra.MQEvent, message SocketMessage) {
+	if event.TargetUserIDs != nil {
+		h.deliverToRoomMembers(event.ChatRoomID, event.TargetUserIDs, message)
+		return
+	}
+	h.DeliverMessageToRoomRecipients(context.Background(), event.ChatRoomID, message)
+}
 
-		if isOnline && recipientClient != nil {
-			select {
-			case recipientClient.Send <- messageJSON:
-				log.Printf("Hub: Message sent to online client %s for room %s", recipientID, chatRoomID)
-			default:
-				log.Printf("Hub: Send channel for client %s is full or closed. Message for room %s might be dropped for this client.", recipientID, chatRoomID)
+// deliverToRoomMembers gửi message tới mọi kết nối trên instance này của các thành viên phòng
+func (h *Hub) deliverToRoomMembers(chatRoomID string, memberIDs []string, message SocketMessage) {
+	// Mỗi codec chỉ mã hóa message một lần cho toàn bộ người nhận
+	encoded := newEncodedMessage(message)
+	class := classifyMessage(message.Type)
+	coalesceKey := coalesceKeyFor(chatRoomID, message)
+
+	// Lấy mọi kết nối đang online của các thành viên (nhiều tab/thiết bị), mỗi shard khóa một lần
+	connections := h.connectionsOfUsers(memberIDs)
+
+	for _, recipientID := range memberIDs {
+		recipientClients := connections[recipientID]
+
+		if len(recipientClients) > 0 {
+			for _, recipientClient := range recipientClients {
+				frame, err := encoded.frameFor(recipientClient)
+				if err != nil {
+					log.Printf("Hub: Error encoding message for client %s (conn %s): %v", recipientID, recipientClient.ConnID, err)
+					continue
+				}
+				if recipientClient.deliverLive(frame, class, coalesceKey) {
+					log.Printf("Hub: Message sent to online client %s (conn %s) for room %s", recipientID, recipientClient.ConnID, chatRoomID)
+				} else {
+					stats := recipientClient.QueueStats()
+					log.Printf("Hub: Message type '%s' for room %s not delivered to client %s (conn %s): queue %d/%d, spill %d, dropped %d",
+						message.Type, chatRoomID, recipientID, recipientClient.ConnID, stats.QueueDepth, stats.QueueCapacity, stats.SpillDepth, stats.DroppedTotal)
+				}
 			}
 		} else {
 			// Tin nhắn đã được lưu vào DB, user offline sẽ thấy khi online lại
@@ -142,63 +187,71 @@ func (h *Hub) DeliverMessageToRoomRecipients(ctx context.Context, chatRoomID str
 	}
 }
 
+// deliverToUser gửi message tới client của một user nếu user đang online trên instance này
+func (h *Hub) deliverToUser(userID string, message SocketMessage) {
+	clients := h.userConnections(userID)
+	if len(clients) == 0 {
+		return
+	}
+
+	encoded := newEncodedMessage(message)
+	class := classifyMessage(message.Type)
+	coalesceKey := coalesceKeyFor("", message)
+	for _, client := range clients {
+		frame, err := encoded.frameFor(client)
+		if err != nil {
+			log.Printf("Hub: Error encoding message type '%s' for client %s: %v", message.Type, userID, err)
+			continue
+		}
+		if !client.deliverLive(frame, class, coalesceKey) {
+			log.Printf("Hub: Message type '%s' not delivered to client %s (conn %s), dropped total %d", message.Type, userID, client.ConnID, client.QueueStats().DroppedTotal)
+		}
+	}
+}
+
+// ConnectionQueueStats trả về số liệu hàng đợi gửi của mọi kết nối của user trên instance này
+func (h *Hub) ConnectionQueueStats(userID string) []ClientQueueStats {
+	clients := h.userConnections(userID)
+	stats := make([]ClientQueueStats, 0, len(clients))
+	for _, client := range clients {
+		stats = append(stats, client.QueueStats())
+	}
+	return stats
+}
+
 func (h *Hub) BroadcastToRoom(chatRoomID string, message SocketMessage) {
-	h.mutex.RLock()
-	room, exists := h.ActiveRoomViews[chatRoomID]
-	h.mutex.RUnlock()
+	room, exists := h.activeView(chatRoomID)
 
 	if !exists {
 		log.Printf("Cannot broadcast to non-existent chat room: %s", chatRoomID)
 		return
 	}
 
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshalling message: %v", err)
-		return
-	}
+	encoded := newEncodedMessage(message)
+	class := classifyMessage(message.Type)
+	coalesceKey := coalesceKeyFor(chatRoomID, message)
 
 	room.mutex.RLock()
 	defer room.mutex.RUnlock()
 
-	var failedClients []*Client
-
-	for clientID, client := range room.Clients {
-		select {
-		case client.Send <- messageJSON:
-			// Gửi thành công
-		default:
-			// Kênh đầy hoặc bị đóng
-			failedClients = append(failedClients, client)
-			log.Printf("Failed to send message to client %s", clientID)
+	for connID, client := range room.Clients {
+		frame, err := encoded.frameFor(client)
+		if err != nil {
+			log.Printf("Error encoding message for client %s: %v", connID, err)
+			continue
 		}
-	}
 
-	// Xử lý các client không nhận được tin nhắn
-	for _, client := range failedClients {
-		h.removeClientFromAllActiveViews(client)
+		// Kết nối không theo kịp frame chat sẽ tự bị đóng và unregister theo chính sách backpressure
+		if !client.deliverLive(frame, class, coalesceKey) {
+			log.Printf("Failed to send message type '%s' to client %s (conn %s)", message.Type, client.ID, connID)
+		}
 	}
 }
 
 // --- Quản lý Active Room Views ---
 // JoinActiveRoomView xử lý khi client muốn chủ động xem một phòng chat.
 func (h *Hub) JoinActiveRoomView(chatRoomID string, client *Client) {
-	h.mutex.Lock() // Lock để truy cập ActiveRoomViews
-	if _, exists := h.ActiveRoomViews[chatRoomID]; !exists {
-		h.ActiveRoomViews[chatRoomID] = &ChatRoomActiveView{
-			ID:      chatRoomID,
-			Clients: make(map[string]*Client),
-		}
-	}
-	activeView := h.ActiveRoomViews[chatRoomID]
-	h.mutex.Unlock()
-
-	activeView.mutex.Lock()
-	_, alreadyInView := activeView.Clients[client.ID]
-	if !alreadyInView {
-		activeView.Clients[client.ID] = client
-	}
-	activeView.mutex.Unlock()
+	alreadyInView, userAlreadyInView := h.addToActiveView(chatRoomID, client)
 
 	// Gửi phản hồi join thành công cho client
 	joinSuccessPayload := JoinSuccessPayload{ChatRoomID: chatRoomID, Status: "joined_active_view"}
@@ -208,12 +261,14 @@ func (h *Hub) JoinActiveRoomView(chatRoomID string, client *Client) {
 		Timestamp: time.Now().UnixMilli(),
 		Data:      mustMarshal(joinSuccessPayload),
 	}
-	client.Send <- mustMarshal(successMsg)
+	client.sendMessageBlocking(successMsg)
 
 	if alreadyInView {
-		log.Printf("Client %s re-confirmed active view for room %s", client.ID, chatRoomID)
+		log.Printf("Client %s (conn %s) re-confirmed active view for room %s", client.ID, client.ConnID, chatRoomID)
+	} else if userAlreadyInView {
+		log.Printf("Client %s joined active view for room %s from another connection (conn %s)", client.ID, chatRoomID, client.ConnID)
 	} else {
-		log.Printf("Client %s joined active view for room %s", client.ID, chatRoomID)
+		log.Printf("Client %s (conn %s) joined active view for room %s", client.ID, client.ConnID, chatRoomID)
 		// Thông báo cho các client *khác* đang active trong view này
 		userJoinedPayload := UserEventPayload{ChatRoomID: chatRoomID, UserID: client.ID} // Cần lấy thêm name, avatar từ AccountRepo nếu muốn
 		account, _ := h.accountRepo.FindById(context.TODO(), client.ID)
@@ -235,31 +290,20 @@ func (h *Hub) JoinActiveRoomView(chatRoomID string, client *Client) {
 				Metadata:   payloadBytes,
 			}
 
-			h.kafkaService.PublishChatEvent(context.Background(), kafkaEvent)
+			h.eventBus.PublishChatEvent(context.Background(), kafkaEvent)
 		}
 	}
 }
 
 // LeaveActiveRoomView xử lý khi client không còn xem phòng chat đó nữa.
 func (h *Hub) LeaveActiveRoomView(chatRoomID string, client *Client) {
-	h.mutex.RLock() // RLock để đọc ActiveRoomViews
-	activeView, exists := h.ActiveRoomViews[chatRoomID]
-	h.mutex.RUnlock()
-
+	// User chỉ thực sự rời view khi kết nối cuối cùng của họ trong view rời đi
+	userActuallyLeftView, currentActiveViewersCount, exists := h.removeFromActiveView(chatRoomID, client)
 	if !exists {
 		log.Printf("Client %s tried to leave non-existent active view %s", client.ID, chatRoomID)
 		return
 	}
 
-	userActuallyLeftView := false
-	activeView.mutex.Lock()
-	if _, clientWasInView := activeView.Clients[client.ID]; clientWasInView {
-		delete(activeView.Clients, client.ID)
-		userActuallyLeftView = true
-	}
-	currentActiveViewersCount := len(activeView.Clients)
-	activeView.mutex.Unlock()
-
 	if userActuallyLeftView {
 		log.Printf("Client %s left active view for room %s", client.ID, chatRoomID)
 		userLeftPayload := UserEventPayload{
@@ -280,65 +324,43 @@ func (h *Hub) LeaveActiveRoomView(chatRoomID string, client *Client) {
 				Metadata:   payloadBytes,
 			}
 
-			h.kafkaService.PublishChatEvent(context.Background(), kafkaEvent)
-		}
-
-		userLeftMsg := SocketMessage{
-			Type:      SocketMessageTypeUserLeft,
-			SenderID:  "system",
-			Timestamp: time.Now().UnixMilli(),
-			Data:      mustMarshal(userLeftPayload),
+			h.eventBus.PublishChatEvent(context.Background(), kafkaEvent)
 		}
-		h.broadcastToActiveView(chatRoomID, userLeftMsg, "") // Gửi cho tất cả active (bao gồm cả client nếu họ vẫn còn listen)
 
-		if currentActiveViewersCount == 0 {
-			h.mutex.Lock() // Lock để xóa ActiveRoomViews[chatRoomID]
-			delete(h.ActiveRoomViews, chatRoomID)
-			h.mutex.Unlock()
-			log.Printf("Active room view %s deleted (no active viewers)", chatRoomID)
-		} else {
-			h.sendActiveUsersListToView(chatRoomID) // Cập nhật danh sách cho những người còn lại
+		// View rỗng đã được xóa, không còn ai trên instance này để thông báo
+		if currentActiveViewersCount > 0 {
+			userLeftMsg := SocketMessage{
+				Type:      SocketMessageTypeUserLeft,
+				SenderID:  "system",
+				Timestamp: time.Now().UnixMilli(),
+				Data:      mustMarshal(userLeftPayload),
+			}
+			h.broadcastToActiveView(chatRoomID, userLeftMsg, "") // Gửi cho tất cả active (bao gồm cả client nếu họ vẫn còn listen)
+			h.sendActiveUsersListToView(chatRoomID)              // Cập nhật danh sách cho những người còn lại
 		}
 	}
 }
 
-// IsClientInActiveView kiểm tra client có đang active trong view không.
-func (h *Hub) IsClientInActiveView(chatRoomID, clientID string) bool {
-	h.mutex.RLock()
-	activeView, exists := h.ActiveRoomViews[chatRoomID]
-	h.mutex.RUnlock()
-
-	if !exists {
-		return false
-	}
-
-	activeView.mutex.RLock()
-	_, clientIsViewing := activeView.Clients[clientID]
-	activeView.mutex.RUnlock()
-	return clientIsViewing
+// IsClientInActiveView kiểm tra kết nối của client có đang active trong view không.
+func (h *Hub) IsClientInActiveView(chatRoomID string, client *Client) bool {
+	return client.inView(chatRoomID)
 }
 
 // removeClientFromAllActiveViews xóa client khỏi tất cả active views khi client disconnect.
 func (h *Hub) removeClientFromAllActiveViews(client *Client) {
-	h.mutex.RLock()
-	// Sao chép key để tránh deadlock khi gọi LeaveActiveRoomView
-	activeViewIDs := make([]string, 0, len(h.ActiveRoomViews))
-	for id := range h.ActiveRoomViews {
-		activeViewIDs = append(activeViewIDs, id)
-	}
-	h.mutex.RUnlock()
+	// Kết nối đóng giữa chừng thì không để "đang nhập" treo lại cho người khác
+	h.stopTypingForConnection(client)
 
-	for _, viewID := range activeViewIDs {
+	// Chỉ mục ngược của client cho biết các view cần gỡ, không phải quét mọi view
+	for _, viewID := range client.activeViewIDs() {
 		h.LeaveActiveRoomView(viewID, client) // Hàm này đã có logging bên trong
 	}
-	log.Printf("Client %s removed from all active views.", client.ID)
+	log.Printf("Client %s (conn %s) removed from all active views.", client.ID, client.ConnID)
 }
 
 // sendActiveUsersListToView gửi danh sách client đang active trong một view.
 func (h *Hub) sendActiveUsersListToView(chatRoomID string) {
-	h.mutex.RLock()
-	activeView, exists := h.ActiveRoomViews[chatRoomID]
-	h.mutex.RUnlock()
+	activeView, exists := h.activeView(chatRoomID)
 
 	if !exists {
 		return
@@ -346,8 +368,13 @@ func (h *Hub) sendActiveUsersListToView(chatRoomID string) {
 
 	activeView.mutex.RLock()
 	// Lấy thông tin chi tiết của user từ AccountRepo
-	usersPayloadList := make([]UserEventPayload, 0, len(activeView.Clients))
-	for userID := range activeView.Clients {
+	// Một user có thể xem phòng từ nhiều kết nối, chỉ liệt kê mỗi user một lần
+	userIDs := make(map[string]struct{}, len(activeView.Clients))
+	for _, client := range activeView.Clients {
+		userIDs[client.ID] = struct{}{}
+	}
+	usersPayloadList := make([]UserEventPayload, 0, len(userIDs))
+	for userID := range userIDs {
 		account, err := h.accountRepo.FindById(context.TODO(), userID) // Sử dụng context phù hợp
 		if err == nil && account != nil {
 			usersPayloadList = append(usersPayloadList, UserEventPayload{
@@ -372,23 +399,19 @@ func (h *Hub) sendActiveUsersListToView(chatRoomID string) {
 	h.broadcastToActiveView(chatRoomID, usersListMsg, "") // Gửi cho tất cả trong active view
 }
 
-// broadcastToActiveView gửi message đến tất cả client đang active trong một view.
-// `excludeClientID` để không gửi lại cho sender (nếu cần).
+// broadcastToActiveView gửi message đến tất cả kết nối đang active trong một view.
+// `excludeClientID` là UserID, loại trừ mọi kết nối của user đó (ví dụ sender).
 func (h *Hub) broadcastToActiveView(chatRoomID string, message SocketMessage, excludeClientID string) {
-	h.mutex.RLock()
-	activeView, exists := h.ActiveRoomViews[chatRoomID]
-	h.mutex.RUnlock()
+	activeView, exists := h.activeView(chatRoomID)
 
 	if !exists {
 		log.Printf("Hub: Cannot broadcast to non-existent active view: %s", chatRoomID)
 		return
 	}
 
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Hub: Error marshalling message for active view %s: %v", chatRoomID, err)
-		return
-	}
+	encoded := newEncodedMessage(message)
+	class := classifyMessage(message.Type)
+	coalesceKey := coalesceKeyFor(chatRoomID, message)
 
 	activeView.mutex.RLock() // Chỉ cần RLock để đọc danh sách client
 	// Tạo một slice copy của clients để tránh giữ lock lâu khi gửi
@@ -401,33 +424,39 @@ func (h *Hub) broadcastToActiveView(chatRoomID string, message SocketMessage, ex
 	activeView.mutex.RUnlock()
 
 	for _, client := range clientsToSend {
-		select {
-		case client.Send <- messageJSON:
-		default:
-			log.Printf("Hub: Send channel for client %s in active view %s is full/closed.", client.ID, chatRoomID)
+		frame, err := encoded.frameFor(client)
+		if err != nil {
+			log.Printf("Hub: Error encoding message for client %s in active view %s: %v", client.ID, chatRoomID, err)
+			continue
+		}
+
+		if !client.deliverLive(frame, class, coalesceKey) {
+			log.Printf("Hub: Message type '%s' not delivered to client %s (conn %s) in active view %s", message.Type, client.ID, client.ConnID, chatRoomID)
 		}
 	}
 }
 
-// startKafkaConsumer khởi động consumer Kafka để nhận tin nhắn
-func (h *Hub) startKafkaConsumer() {
-	log.Println("Attempting to start Kafka consumer...")
-	if h.kafkaService == nil {
-		log.Println("ERROR: Kafka service is nil, cannot start consumer")
+// startEventConsumer khởi động consumer của event bus để nhận sự kiện từ mọi instance
+func (h *Hub) startEventConsumer() {
+	log.Println("Attempting to start event bus consumer...")
+	if h.eventBus == nil {
+		log.Println("ERROR: Event bus is nil, cannot start consumer")
+		close(h.consumerDone)
 		return
 	}
 
-	// Tạo context riêng cho Kafka consumer
-	ctx := context.Background()
-
-	// Bắt đầu consumer trong goroutine riêng
+	// Bắt đầu consumer trong goroutine riêng, dừng khi drain hủy consumerCtx
 	go func() {
-		log.Println("Starting Kafka consumer in a separate goroutine...")
-		err := h.kafkaService.StartChatConsumer(ctx, h.handleKafkaEvent)
-		if err != nil {
-			log.Printf("Kafka consumer stopped with error: %v", err)
-		} else {
-			log.Println("Kafka consumer stopped without error (unexpected)")
+		defer close(h.consumerDone)
+		log.Println("Starting event bus consumer in a separate goroutine...")
+		err := h.eventBus.StartChatConsumer(h.consumerCtx, h.handleBusEvent)
+		switch {
+		case errors.Is(err, context.Canceled):
+			log.Println("Event bus consumer stopped by drain")
+		case err != nil:
+			log.Printf("Event bus consumer stopped with error: %v", err)
+		default:
+			log.Println("Event bus consumer stopped without error (unexpected)")
 		}
 	}()
 
@@ -435,63 +464,38 @@ func (h *Hub) startKafkaConsumer() {
 	// Lưu ý: Đây chỉ là giả định consumer đã khởi động, không có cách nào để biết chắc chắn
 	// mà không triển khai cơ chế phản hồi từ consumer
 	time.Sleep(2 * time.Second)
-	log.Println("Kafka consumer setup completed - now listening for events")
+	log.Println("Event bus consumer setup completed - now listening for events")
 }
 
-// handleKafkaEvent xử lý sự kiện từ Kafka
-func (h *Hub) handleKafkaEvent(event *kafkainfra.MQEvent) error {
-	log.Printf("Received Kafka event: %s for room %s from user %s",
+// handleBusEvent xử lý sự kiện nhận từ event bus
+func (h *Hub) handleBusEvent(event *kafkainfra.MQEvent) error {
+	log.Printf("Received bus event: %s for room %s from user %s",
 		event.EventType, event.ChatRoomID, event.SenderID)
 
-	var socketMsg SocketMessage
-
 	switch event.EventType {
-	case kafkainfra.MessageSent:
-		var payload ChatMessageReceivePayload
-
-		if err := json.Unmarshal(event.Metadata, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal message payload: %w", err)
-		}
-
-		socketMsg = SocketMessage{
-			Type:      SocketMessageTypeNewMessage,
-			SenderID:  event.SenderID,
-			Timestamp: event.Timestamp.UnixMilli(),
-			Data:      mustMarshal(payload),
+	case kafkainfra.MessageSent, kafkainfra.MessageEdited, kafkainfra.ReactionAdded, kafkainfra.ReactionRemoved, kafkainfra.MessageRead:
+		// Read receipt cũng gửi cho cả người đọc để các thiết bị khác của họ cập nhật số tin chưa đọc
+		socketMsg, err := roomEventMessage(event)
+		if err != nil {
+			return err
 		}
 
-		h.DeliverMessageToRoomRecipients(context.Background(), event.ChatRoomID, socketMsg)
+		h.deliverRoomEvent(event, socketMsg)
 
-	case kafkainfra.TypingStarted:
+	case kafkainfra.TypingStarted, kafkainfra.TypingStopped:
 		var payload TypingPayload
 
 		if err := json.Unmarshal(event.Metadata, &payload); err != nil {
 			return fmt.Errorf("failed to unmarshal typing payload: %w", err)
 		}
 
-		typingMsg := SocketMessage{
-			Type:      SocketMessageTypeTyping,
-			SenderID:  event.SenderID,
-			Timestamp: time.Now().UTC().UnixMilli(),
-			Data:      mustMarshal(payload),
-		}
-
-		h.broadcastToActiveView(payload.ChatRoomID, typingMsg, event.SenderID)
-	case kafkainfra.TypingStopped:
-		var payload TypingPayload
-
-		if err := json.Unmarshal(event.Metadata, &payload); err != nil {
-			return fmt.Errorf("failed to unmarshal typing payload: %w", err)
-		}
+		key := typingKey{ChatRoomID: payload.ChatRoomID, UserID: event.SenderID}
+		h.typing.observe(key, event.EventType == kafkainfra.TypingStarted, time.Now())
 
-		typingMsg := SocketMessage{
-			Type:      SocketMessageTypeTyping,
-			SenderID:  event.SenderID,
-			Timestamp: time.Now().UTC().UnixMilli(),
-			Data:      mustMarshal(payload),
-		}
+		h.broadcastToActiveView(payload.ChatRoomID, newTypingMessage(key, payload.IsTyping, payload.Reason), event.SenderID)
 
-		h.broadcastToActiveView(payload.ChatRoomID, typingMsg, event.SenderID)
+	case kafkainfra.UserOnline, kafkainfra.UserOffline, kafkainfra.UserStatusChanged:
+		return h.handlePresenceEvent(event)
 
 	case kafkainfra.UserJoinedRoom:
 		var payload UserEventPayload
@@ -525,8 +529,172 @@ func (h *Hub) handleKafkaEvent(event *kafkainfra.MQEvent) error {
 		}
 
 		h.broadcastToActiveView(payload.ChatRoomID, userLeftMsg, payload.UserID)
+
+	case kafkainfra.MessageDeleted:
+		var deleted chat.MessageDeletedOutput
+
+		if err := json.Unmarshal(event.Metadata, &deleted); err != nil {
+			return fmt.Errorf("failed to unmarshal message deleted payload: %w", err)
+		}
+
+		deletedMsg := messageDeletedMessage(event, &deleted)
+
+		// "Xóa phía tôi" chỉ cần đồng bộ cho chính người xóa, thu hồi thì gửi cho cả phòng
+		if deleted.Mode == chat.DeleteForMe {
+			h.deliverToUser(deleted.DeletedBy, deletedMsg)
+		} else {
+			h.deliverRoomEvent(event, deletedMsg)
+		}
+
+	case kafkainfra.MembershipChanged:
+		// Mọi instance nhận sự kiện này (không định tuyến) để bỏ danh sách thành viên đã cũ
+		h.roomMembers.Invalidate(event.ChatRoomID)
+		log.Printf("Hub: Room member cache invalidated for room %s", event.ChatRoomID)
+
+	case kafkainfra.DeliveryGap:
+		h.requireResync(resyncReasonEventBusReconnected)
 	default:
 		return fmt.Errorf("unsupported event type: %s", event.EventType)
 	}
 	return nil
 }
+
+// roomEventMessage dựng frame gửi client cho sự kiện được cấp seq trong phòng (tin nhắn mới,
+// sửa, thu hồi, reaction, đã đọc). Dùng chung cho gửi realtime và replay RESUME để hai đường
+// gửi ra cùng một frame.
+func roomEventMessage(event *kafkainfra.MQEvent) (SocketMessage, error) {
+	switch event.EventType {
+	case kafkainfra.MessageSent:
+		var message chat.MessageOutput
+
+		if err := json.Unmarshal(event.Metadata, &message); err != nil {
+			return SocketMessage{}, fmt.Errorf("failed to unmarshal message payload: %w", err)
+		}
+
+		return SocketMessage{
+			Type:      SocketMessageTypeNewMessage,
+			SenderID:  event.SenderID,
+			Timestamp: event.Timestamp.UnixMilli(),
+			Data:      mustMarshal(receivePayloadFromOutput(&message)),
+		}, nil
+
+	case kafkainfra.MessageEdited:
+		var message chat.MessageOutput
+
+		if err := json.Unmarshal(event.Metadata, &message); err != nil {
+			return SocketMessage{}, fmt.Errorf("failed to unmarshal message edited payload: %w", err)
+		}
+
+		editedAt := event.Timestamp
+		if message.EditedAt != nil {
+			editedAt = *message.EditedAt
+		}
+
+		return SocketMessage{
+			Type:      SocketMessageTypeMessageEdited,
+			SenderID:  event.SenderID,
+			Timestamp: event.Timestamp.UnixMilli(),
+			Data: mustMarshal(MessageEditedPayload{
+				ChatRoomID: message.ChatRoomID,
+				MessageID:  message.ID,
+				Content:    message.Content,
+				EditedAt:   editedAt.UnixMilli(),
+				Seq:        event.Seq,
+			}),
+		}, nil
+
+	case kafkainfra.MessageDeleted:
+		var deleted chat.MessageDeletedOutput
+
+		if err := json.Unmarshal(event.Metadata, &deleted); err != nil {
+			return SocketMessage{}, fmt.Errorf("failed to unmarshal message deleted payload: %w", err)
+		}
+
+		return messageDeletedMessage(event, &deleted), nil
+
+	case kafkainfra.ReactionAdded, kafkainfra.ReactionRemoved:
+		var reaction chat.ReactionUpdatedOutput
+
+		if err := json.Unmarshal(event.Metadata, &reaction); err != nil {
+			return SocketMessage{}, fmt.Errorf("failed to unmarshal reaction payload: %w", err)
+		}
+
+		counts := make([]ReactionCountPayload, 0, len(reaction.Reactions))
+		for _, r := range reaction.Reactions {
+			counts = append(counts, ReactionCountPayload{Emoji: r.Emoji, Count: r.Count})
+		}
+
+		return SocketMessage{
+			Type:      SocketMessageTypeReactionUpdated,
+			SenderID:  event.SenderID,
+			Timestamp: event.Timestamp.UnixMilli(),
+			Data: mustMarshal(ReactionUpdatedPayload{
+				ChatRoomID: reaction.ChatRoomID,
+				MessageID:  reaction.MessageID,
+				UserID:     reaction.UserID,
+				Emoji:      reaction.Emoji,
+				Added:      reaction.Added,
+				Reactions:  counts,
+				Seq:        event.Seq,
+			}),
+		}, nil
+
+	case kafkainfra.MessageRead:
+		var receipt chat.ReadReceiptOutput
+
+		if err := json.Unmarshal(event.Metadata, &receipt); err != nil {
+			return SocketMessage{}, fmt.Errorf("failed to unmarshal read receipt payload: %w", err)
+		}
+
+		return SocketMessage{
+			Type:      SocketMessageTypeReadReceipt,
+			SenderID:  event.SenderID,
+			Timestamp: event.Timestamp.UnixMilli(),
+			Data: mustMarshal(ReadReceiptPayload{
+				ChatRoomID: receipt.ChatRoomID,
+				MessageID:  receipt.MessageID,
+				UserID:     receipt.UserID,
+				ReadAt:     receipt.ReadAt.UnixMilli(),
+				Seq:        event.Seq,
+			}),
+		}, nil
+
+	default:
+		return SocketMessage{}, fmt.Errorf("unsupported room event type: %s", event.EventType)
+	}
+}
+
+func messageDeletedMessage(event *kafkainfra.MQEvent, deleted *chat.MessageDeletedOutput) SocketMessage {
+	return SocketMessage{
+		Type:      SocketMessageTypeMessageDeleted,
+		SenderID:  event.SenderID,
+		Timestamp: event.Timestamp.UnixMilli(),
+		Data: mustMarshal(MessageDeletedPayload{
+			ChatRoomID: deleted.ChatRoomID,
+			MessageID:  deleted.MessageID,
+			Mode:       string(deleted.Mode),
+			DeletedBy:  deleted.DeletedBy,
+			DeletedAt:  deleted.DeletedAt.UnixMilli(),
+			Seq:        event.Seq,
+		}),
+	}
+}
+
+// resyncReasonEventBusReconnected là lý do RESYNC_REQUIRED khi instance vừa subscribe lại bus
+const resyncReasonEventBusReconnected = "event_bus_reconnected"
+
+// requireResync yêu cầu mọi kết nối trên instance này RESUME vì sự kiện gửi tới có thể đã bị lỡ
+func (h *Hub) requireResync(reason string) {
+	clients := h.allConnections()
+	log.Printf("Hub: Asking %d connections to resync (%s)", len(clients), reason)
+
+	message := SocketMessage{
+		Type:      SocketMessageTypeResyncRequired,
+		SenderID:  "system",
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Data:      mustMarshal(ResyncRequiredPayload{Reason: reason}),
+	}
+	for _, client := range clients {
+		client.sendMessage(message)
+	}
+}
@@ -0,0 +1,296 @@
+package socket
+
+import (
+	"log"
+	"sync"
+)
+
+// hubShard giữ một phần kết nối và active view của Hub. Kết nối thuộc shard theo hash
+// của UserID, active view thuộc shard theo hash của ChatRoomID. Mỗi shard có lock và
+// vòng lặp register/unregister riêng nên các shard không tranh chấp nhau.
+type hubShard struct {
+	mutex   sync.RWMutex
+	clients map[string]map[string]*Client  // Map userId -> connID -> client
+	views   map[string]*ChatRoomActiveView // Map chatRoomID -> active view
+
+	register   chan *Client
+	unregister chan *Client
+
+	registryUpdates chan registryUpdate // Thêm/xóa user trong connection registry theo thứ tự
+}
+
+func newHubShards(count int) []*hubShard {
+	count = max(count, 1)
+	shards := make([]*hubShard, count)
+	for i := range shards {
+		shards[i] = &hubShard{
+			clients:    make(map[string]map[string]*Client),
+			views:      make(map[string]*ChatRoomActiveView),
+			register:   make(chan *Client),
+			unregister: make(chan *Client),
+
+			registryUpdates: make(chan registryUpdate, registryUpdateQueueSize),
+		}
+	}
+	return shards
+}
+
+// shardIndex băm key bằng FNV-1a (không cấp phát bộ nhớ như hash/fnv)
+func shardIndex(key string, count int) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return int(hash % uint32(count))
+}
+
+func (h *Hub) userShard(userID string) *hubShard {
+	return h.shards[shardIndex(userID, len(h.shards))]
+}
+
+func (h *Hub) roomShard(chatRoomID string) *hubShard {
+	return h.shards[shardIndex(chatRoomID, len(h.shards))]
+}
+
+// register chuyển client tới vòng lặp của shard sở hữu user
+func (h *Hub) register(client *Client) {
+	h.userShard(client.ID).register <- client
+}
+
+// unregister chuyển client tới vòng lặp của shard sở hữu user để gỡ khỏi Hub
+func (h *Hub) unregister(client *Client) {
+	h.userShard(client.ID).unregister <- client
+}
+
+// runShard xử lý register/unregister của một shard. Mọi kết nối của một user nằm cùng
+// shard nên việc đếm kết nối đầu tiên/cuối cùng của user vẫn tuần tự.
+func (h *Hub) runShard(shard *hubShard) {
+	for {
+		select {
+		case client := <-shard.register:
+			connCount := shard.addClient(client)
+			log.Printf("Client %s (conn %s) registered to hub. User connections: %d", client.ID, client.ConnID, connCount)
+
+			// Kết nối đầu tiên của user: báo online cho bạn bè và ghi nhận user ở instance này
+			if connCount == 1 {
+				h.userConnected(client.ID)
+				h.queueRegistryUpdate(shard, client.ID, true)
+			}
+
+		case client := <-shard.unregister:
+			h.removeClientFromAllActiveViews(client)
+
+			lastConnection := shard.removeClient(client)
+			log.Printf("Client %s (conn %s) unregistered from Hub.", client.ID, client.ConnID)
+
+			if lastConnection {
+				h.queueRegistryUpdate(shard, client.ID, false)
+			}
+
+			// Chỉ chuyển offline khi kết nối cuối cùng của user đóng (sau khoảng debounce).
+			// Khi drain, user sẽ kết nối lại vào instance khác nên giữ nguyên trạng thái.
+			if lastConnection && !h.draining.Load() {
+				h.userDisconnected(client.ID)
+			}
+		}
+	}
+}
+
+// addClient thêm kết nối và trả về số kết nối hiện có của user trong shard
+func (s *hubShard) addClient(client *Client) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.clients[client.ID]; !exists {
+		s.clients[client.ID] = make(map[string]*Client)
+	}
+	s.clients[client.ID][client.ConnID] = client
+	return len(s.clients[client.ID])
+}
+
+// removeClient gỡ kết nối, trả về true nếu đó là kết nối cuối cùng của user
+func (s *hubShard) removeClient(client *Client) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conns, exists := s.clients[client.ID]
+	if !exists {
+		return false
+	}
+	if _, registered := conns[client.ConnID]; !registered {
+		return false
+	}
+	delete(conns, client.ConnID)
+	if len(conns) == 0 {
+		delete(s.clients, client.ID)
+		return true
+	}
+	return false
+}
+
+// activeView trả về active view của phòng nếu đang có kết nối xem phòng
+func (h *Hub) activeView(chatRoomID string) (*ChatRoomActiveView, bool) {
+	shard := h.roomShard(chatRoomID)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	view, exists := shard.views[chatRoomID]
+	return view, exists
+}
+
+// addToActiveView thêm kết nối vào active view của phòng (tạo view nếu chưa có).
+// Trả về kết nối đã có trong view chưa và user đã xem phòng từ kết nối khác chưa.
+func (h *Hub) addToActiveView(chatRoomID string, client *Client) (alreadyInView bool, userAlreadyInView bool) {
+	shard := h.roomShard(chatRoomID)
+
+	for {
+		shard.mutex.Lock()
+		view, exists := shard.views[chatRoomID]
+		if !exists {
+			view = &ChatRoomActiveView{
+				ID:      chatRoomID,
+				Clients: make(map[string]*Client),
+			}
+			shard.views[chatRoomID] = view
+		}
+		shard.mutex.Unlock()
+
+		view.mutex.Lock()
+		// View vừa bị xóa vì rỗng sau khi lấy ra khỏi map: lấy (hoặc tạo) view mới
+		if view.closed {
+			view.mutex.Unlock()
+			continue
+		}
+
+		_, alreadyInView = view.Clients[client.ConnID]
+		// User đã xem phòng này từ một thiết bị khác thì không thông báo USER_JOINED lần nữa
+		userAlreadyInView = view.hasUser(client.ID)
+		if !alreadyInView {
+			view.Clients[client.ConnID] = client
+			client.trackView(chatRoomID)
+		}
+		view.mutex.Unlock()
+		return alreadyInView, userAlreadyInView
+	}
+}
+
+// removeFromActiveView gỡ kết nối khỏi active view của phòng và xóa view nếu không còn ai.
+// Trả về user có thực sự rời view không (kết nối cuối của user trong view) và số kết nối còn lại.
+func (h *Hub) removeFromActiveView(chatRoomID string, client *Client) (userLeft bool, remaining int, exists bool) {
+	view, exists := h.activeView(chatRoomID)
+	if !exists {
+		return false, 0, false
+	}
+
+	view.mutex.Lock()
+	if _, clientWasInView := view.Clients[client.ConnID]; clientWasInView {
+		delete(view.Clients, client.ConnID)
+		client.untrackView(chatRoomID)
+		userLeft = !view.hasUser(client.ID)
+	}
+	remaining = len(view.Clients)
+	view.mutex.Unlock()
+
+	if remaining == 0 {
+		h.deleteViewIfEmpty(view)
+	}
+	return userLeft, remaining, true
+}
+
+// deleteViewIfEmpty xóa view khỏi shard nếu vẫn rỗng (có thể đã có kết nối mới join)
+func (h *Hub) deleteViewIfEmpty(view *ChatRoomActiveView) {
+	shard := h.roomShard(view.ID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	view.mutex.Lock()
+	defer view.mutex.Unlock()
+	if len(view.Clients) > 0 || view.closed {
+		return
+	}
+	view.closed = true
+	if shard.views[view.ID] == view {
+		delete(shard.views, view.ID)
+	}
+	log.Printf("Active room view %s deleted (no active viewers)", view.ID)
+}
+
+// findConnection trả về kết nối connID của user trên instance này, nil nếu không có
+func (h *Hub) findConnection(userID, connID string) *Client {
+	shard := h.userShard(userID)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	return shard.clients[userID][connID]
+}
+
+// userConnections trả về bản sao danh sách kết nối của user trên instance này
+func (h *Hub) userConnections(userID string) []*Client {
+	shard := h.userShard(userID)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	conns := shard.clients[userID]
+	clients := make([]*Client, 0, len(conns))
+	for _, client := range conns {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// connectionsOfUsers trả về kết nối của nhiều user, mỗi shard chỉ bị khóa một lần
+// thay vì một lần cho mỗi user (fan-out tới thành viên phòng). Chi phí không tăng theo
+// số shard: chỉ shard có người nhận mới bị khóa và không cấp phát gì theo shard.
+func (h *Hub) connectionsOfUsers(userIDs []string) map[string][]*Client {
+	result := make(map[string][]*Client, len(userIDs))
+
+	// Shard của từng user, -1 khi user đã được lấy kết nối. Phòng nhỏ dùng mảng trên stack.
+	var buf [64]int
+	indexes := buf[:0]
+	for _, userID := range userIDs {
+		indexes = append(indexes, shardIndex(userID, len(h.shards)))
+	}
+
+	for i, index := range indexes {
+		if index < 0 {
+			continue
+		}
+
+		// Lấy kết nối của mọi user còn lại thuộc cùng shard trong một lần khóa
+		shard := h.shards[index]
+		shard.mutex.RLock()
+		for j := i; j < len(userIDs); j++ {
+			if indexes[j] != index {
+				continue
+			}
+			indexes[j] = -1
+			for _, client := range shard.clients[userIDs[j]] {
+				result[userIDs[j]] = append(result[userIDs[j]], client)
+			}
+		}
+		shard.mutex.RUnlock()
+	}
+	return result
+}
+
+// forEachUser gọi fn với danh sách kết nối của từng user đang online trên instance này.
+// fn chạy khi đang giữ RLock của shard nên không được gọi lại vào Hub.
+func (h *Hub) forEachUser(fn func(userID string, conns map[string]*Client)) {
+	for _, shard := range h.shards {
+		shard.mutex.RLock()
+		for userID, conns := range shard.clients {
+			fn(userID, conns)
+		}
+		shard.mutex.RUnlock()
+	}
+}
+
+// allConnections trả về mọi kết nối trên instance này
+func (h *Hub) allConnections() []*Client {
+	var clients []*Client
+	h.forEachUser(func(_ string, conns map[string]*Client) {
+		for _, client := range conns {
+			clients = append(clients, client)
+		}
+	})
+	return clients
+}
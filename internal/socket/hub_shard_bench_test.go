@@ -0,0 +1,142 @@
+package socket
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	benchUsers          = 10000
+	benchRooms          = 1000
+	benchRoomMembers    = 8
+	benchConnsPerWorker = 256
+)
+
+// hubBenchData là ID user, ID phòng và danh sách thành viên phòng tạo sẵn, để vòng đo
+// không tốn thời gian dựng chuỗi mà chỉ còn thao tác trên Hub
+type hubBenchData struct {
+	userIDs     []string
+	roomIDs     []string
+	roomMembers [][]string
+}
+
+func newHubBenchData() *hubBenchData {
+	data := &hubBenchData{
+		userIDs:     make([]string, benchUsers),
+		roomIDs:     make([]string, benchRooms),
+		roomMembers: make([][]string, benchRooms),
+	}
+	for i := range data.userIDs {
+		data.userIDs[i] = "user-" + strconv.Itoa(i)
+	}
+	for i := range data.roomIDs {
+		data.roomIDs[i] = "room-" + strconv.Itoa(i)
+		members := make([]string, benchRoomMembers)
+		for j := range members {
+			members[j] = data.userIDs[(i+j*benchRooms)%benchUsers]
+		}
+		data.roomMembers[i] = members
+	}
+	return data
+}
+
+// newBenchmarkHub tạo Hub chỉ có shard, đã có sẵn benchUsers kết nối đang xem benchRooms phòng
+func newBenchmarkHub(shards int, data *hubBenchData) *Hub {
+	hub := &Hub{shards: newHubShards(shards)}
+	for i, userID := range data.userIDs {
+		client := &Client{ID: userID, ConnID: "conn-" + strconv.Itoa(i)}
+		hub.userShard(client.ID).addClient(client)
+		hub.addToActiveView(data.roomIDs[i%benchRooms], client)
+	}
+	return hub
+}
+
+// benchHubConnect là vòng đời của một kết nối trên Hub: register, join view, leave, unregister
+func benchHubConnect(hub *Hub, client *Client, chatRoomID string) {
+	shard := hub.userShard(client.ID)
+	shard.addClient(client)
+	hub.addToActiveView(chatRoomID, client)
+	hub.removeFromActiveView(chatRoomID, client)
+	shard.removeClient(client)
+}
+
+// newBenchClients tạo bộ Client riêng cho một goroutine của RunParallel, để các goroutine
+// không tranh chấp cùng một Client
+func newBenchClients(data *hubBenchData, worker int) []*Client {
+	clients := make([]*Client, benchConnsPerWorker)
+	for i := range clients {
+		userID := data.userIDs[(worker*benchConnsPerWorker+i)%benchUsers]
+		clients[i] = &Client{ID: userID, ConnID: "bench-" + strconv.Itoa(worker) + "-" + strconv.Itoa(i)}
+	}
+	return clients
+}
+
+// BenchmarkHubShards đo thông lượng của Hub khi nhiều goroutine cùng dùng, ID và Client
+// được tạo sẵn nên số đo chỉ gồm lock và map của Hub:
+//   - connect: vòng đời kết nối (khóa ghi shard của user và shard của phòng)
+//   - fanout: tìm kết nối của thành viên phòng để gửi tin nhắn (khóa đọc)
+//   - mixed: mỗi kết nối mở/đóng kèm fanoutPerConnect lần fan-out, như khi user
+//     kết nối/ngắt trong lúc tin nhắn vẫn đang được gửi tới các phòng khác
+//
+// Shard giúp khi khóa ghi của một kết nối không chặn fan-out tới user ở shard khác nên
+// cần chạy với -cpu lớn hơn 1 trên máy nhiều core:
+//
+//	go test ./internal/socket -run '^$' -bench HubShards -cpu 1,4,8
+func BenchmarkHubShards(b *testing.B) {
+	const fanoutPerConnect = 4
+	data := newHubBenchData()
+
+	for _, shards := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("connect/shards=%d", shards), func(b *testing.B) {
+			hub := newBenchmarkHub(shards, data)
+			var nextWorker atomic.Int64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				clients := newBenchClients(data, int(nextWorker.Add(1)))
+				for i := 0; pb.Next(); i++ {
+					benchHubConnect(hub, clients[i%benchConnsPerWorker], data.roomIDs[i%benchRooms])
+				}
+			})
+		})
+	}
+
+	for _, shards := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("fanout/shards=%d", shards), func(b *testing.B) {
+			hub := newBenchmarkHub(shards, data)
+			var nextRoom atomic.Int64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					hub.connectionsOfUsers(data.roomMembers[int(nextRoom.Add(1))%benchRooms])
+				}
+			})
+		})
+	}
+
+	for _, shards := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("mixed/shards=%d", shards), func(b *testing.B) {
+			hub := newBenchmarkHub(shards, data)
+			var nextWorker atomic.Int64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				worker := int(nextWorker.Add(1))
+				clients := newBenchClients(data, worker)
+				for i := 0; pb.Next(); i++ {
+					if i%(fanoutPerConnect+1) == 0 {
+						benchHubConnect(hub, clients[i%benchConnsPerWorker], data.roomIDs[i%benchRooms])
+						continue
+					}
+					hub.connectionsOfUsers(data.roomMembers[(worker*benchRooms/8+i)%benchRooms])
+				}
+			})
+		})
+	}
+}
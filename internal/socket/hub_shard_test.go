@@ -0,0 +1,214 @@
+//go:build unit
+// +build unit
+
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	domainStatus "gochat-backend/internal/domain/status"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/repository"
+	"gochat-backend/internal/usecase/status"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConnectionRegistry ghi lại các lần thêm/xóa user, mỗi lần gọi được gửi vào calls
+type fakeConnectionRegistry struct {
+	repository.ConnectionRegistry
+	calls chan string
+}
+
+func newFakeConnectionRegistry() *fakeConnectionRegistry {
+	return &fakeConnectionRegistry{calls: make(chan string, 16)}
+}
+
+func (r *fakeConnectionRegistry) AddUser(ctx context.Context, instanceID, userID string) error {
+	r.calls <- "add:" + instanceID + ":" + userID
+	return nil
+}
+
+func (r *fakeConnectionRegistry) RemoveUser(ctx context.Context, instanceID, userID string) error {
+	r.calls <- "remove:" + instanceID + ":" + userID
+	return nil
+}
+
+func (r *fakeConnectionRegistry) FindUserInstances(ctx context.Context, userIDs []string) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+// fakePresenceStatusUseCase đếm số lần presence được phát và số lần user bị chuyển offline
+type fakePresenceStatusUseCase struct {
+	status.StatusUseCase
+	mutex     sync.Mutex
+	published map[string]int
+	offline   map[string]int
+}
+
+func newFakePresenceStatusUseCase() *fakePresenceStatusUseCase {
+	return &fakePresenceStatusUseCase{published: make(map[string]int), offline: make(map[string]int)}
+}
+
+func (s *fakePresenceStatusUseCase) GetOwnStatus(ctx context.Context, userID string) (*status.UserStatusOutput, error) {
+	return &status.UserStatusOutput{UserID: userID, Status: domainStatus.Online}, nil
+}
+
+func (s *fakePresenceStatusUseCase) PublishPresence(ctx context.Context, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.published[userID]++
+	return nil
+}
+
+func (s *fakePresenceStatusUseCase) SetUserOffline(ctx context.Context, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.offline[userID]++
+	return nil
+}
+
+func (s *fakePresenceStatusUseCase) publishedCount(userID string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.published[userID]
+}
+
+func (s *fakePresenceStatusUseCase) offlineCount(userID string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.offline[userID]
+}
+
+// newTestHub tạo Hub chỉ có shard, presence và registry, rồi chạy vòng lặp của các shard
+func newTestHub(registry repository.ConnectionRegistry, statusUseCase status.StatusUseCase, presenceDelay time.Duration) *Hub {
+	hub := &Hub{
+		shards:        newHubShards(2),
+		statusUseCase: statusUseCase,
+		typing:        newTypingTracker(time.Minute),
+		presence:      newPresenceDebouncer(presenceDelay),
+		idle:          newIdleTracker(0),
+		instanceID:    "instance-1",
+		registry:      registry,
+		registryTTL:   time.Minute,
+	}
+	for _, shard := range hub.shards {
+		go hub.runShard(shard)
+		if registry != nil {
+			go hub.runRegistrySync(shard)
+		}
+	}
+	return hub
+}
+
+func newTestClient(hub *Hub, userID, connID string) *Client {
+	return &Client{ID: userID, ConnID: connID, Hub: hub, Send: make(chan []byte, 1)}
+}
+
+// waitForCall chờ registry nhận lần gọi tiếp theo
+func waitForCall(t *testing.T, registry *fakeConnectionRegistry) string {
+	select {
+	case call := <-registry.calls:
+		return call
+	case <-time.After(time.Second):
+		t.Fatal("connection registry was not called")
+		return ""
+	}
+}
+
+func TestShardLoopSyncsConnectionRegistry(t *testing.T) {
+	registry := newFakeConnectionRegistry()
+	hub := newTestHub(registry, newFakePresenceStatusUseCase(), time.Hour)
+
+	first := newTestClient(hub, "user-1", "conn-1")
+	hub.register(first)
+	assert.Equal(t, "add:instance-1:user-1", waitForCall(t, registry))
+
+	// Kết nối thứ hai của user không ghi registry lần nữa, vòng lặp shard vẫn nhận register
+	second := newTestClient(hub, "user-1", "conn-2")
+	hub.register(second)
+	hub.unregister(second)
+
+	hub.unregister(first)
+	assert.Equal(t, "remove:instance-1:user-1", waitForCall(t, registry))
+
+	// Shard vẫn tiếp tục xử lý sau khi ghi registry
+	hub.register(newTestClient(hub, "user-1", "conn-3"))
+	assert.Equal(t, "add:instance-1:user-1", waitForCall(t, registry))
+	require.Len(t, hub.userConnections("user-1"), 1)
+}
+
+func TestQuickConnectAndDisconnectStillGoesOffline(t *testing.T) {
+	statusUseCase := newFakePresenceStatusUseCase()
+	hub := newTestHub(nil, statusUseCase, 20*time.Millisecond)
+
+	// Kết nối rồi ngắt ngay: offline phải được hẹn sau khi trạng thái online đã được ghi nhận
+	for i := 0; i < 50; i++ {
+		userID := "user-" + strconv.Itoa(i)
+		client := newTestClient(hub, userID, "conn-"+strconv.Itoa(i))
+		hub.register(client)
+		hub.unregister(client)
+	}
+
+	for i := 0; i < 50; i++ {
+		userID := "user-" + strconv.Itoa(i)
+		assert.Eventually(t, func() bool { return statusUseCase.offlineCount(userID) == 1 }, time.Second, 5*time.Millisecond,
+			"user %s must go offline after the debounce", userID)
+		assert.Empty(t, hub.userConnections(userID))
+	}
+}
+
+func TestReconnectWithinDebounceDoesNotGoOffline(t *testing.T) {
+	statusUseCase := newFakePresenceStatusUseCase()
+	hub := newTestHub(nil, statusUseCase, 50*time.Millisecond)
+
+	first := newTestClient(hub, "user-1", "conn-1")
+	hub.register(first)
+	assert.Eventually(t, func() bool { return statusUseCase.publishedCount("user-1") == 1 }, time.Second, 5*time.Millisecond)
+
+	hub.unregister(first)
+	hub.register(newTestClient(hub, "user-1", "conn-2"))
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Zero(t, statusUseCase.offlineCount("user-1"))
+	// Kết nối lại trong khoảng debounce không phát online lần nữa
+	assert.Equal(t, 1, statusUseCase.publishedCount("user-1"))
+}
+
+func TestDeliveryGapAsksEveryConnectionToResync(t *testing.T) {
+	registry := newFakeConnectionRegistry()
+	hub := newTestHub(registry, newFakePresenceStatusUseCase(), time.Hour)
+
+	clients := []*Client{
+		newTestClient(hub, "user-1", "conn-1"),
+		newTestClient(hub, "user-2", "conn-2"),
+	}
+	for _, client := range clients {
+		client.codec = jsonSocketCodec
+		hub.register(client)
+		waitForCall(t, registry)
+	}
+
+	require.NoError(t, hub.handleBusEvent(&kafkainfra.MQEvent{EventType: kafkainfra.DeliveryGap}))
+
+	for _, client := range clients {
+		select {
+		case frame := <-client.Send:
+			var message SocketMessage
+			require.NoError(t, json.Unmarshal(frame, &message))
+			assert.Equal(t, SocketMessageTypeResyncRequired, message.Type)
+
+			var payload ResyncRequiredPayload
+			require.NoError(t, json.Unmarshal(message.Data, &payload))
+			assert.Equal(t, resyncReasonEventBusReconnected, payload.Reason)
+		case <-time.After(time.Second):
+			t.Fatalf("connection %s was not asked to resync", client.ConnID)
+		}
+	}
+}
@@ -2,47 +2,56 @@ package socket
 
 import (
 	"context"
-	"encoding/json"
-	domain "gochat-backend/internal/domain/chat"
-	"gochat-backend/internal/infra/kafkainfra"
+	"errors"
+	"fmt"
+	domainStatus "gochat-backend/internal/domain/status"
 	"gochat-backend/internal/repository"
+	"gochat-backend/internal/usecase/chat"
+	"gochat-backend/internal/usecase/status"
 	"log"
-	"strings"
 	"time"
+)
 
-	"github.com/google/uuid"
+const (
+	maxResumeRooms         = 50  // Số phòng tối đa trong một RESUME (giữ payload dưới maxMessageSize)
+	maxResumeReplayPerRoom = 200 // Số sự kiện tối đa replay cho mỗi phòng, vượt quá thì client tải lại qua REST
 )
 
 type MessageHandler struct {
 	hub                *Hub
+	rateLimiter        *RateLimiter
 	chatRoomRepository repository.ChatRoomRepository
-	messageRepository  repository.MessageRepository
-	accountRepository  repository.AccountRepository
+	chatUseCase        chat.ChatUseCase
 }
 
 func NewMessageHandler(
 	hub *Hub,
 	chatRoomRepository repository.ChatRoomRepository,
-	messageRepository repository.MessageRepository,
-	accountRepository repository.AccountRepository,
+	chatUseCase chat.ChatUseCase,
+	rateLimiter *RateLimiter,
 ) *MessageHandler {
 	return &MessageHandler{
 		hub:                hub,
+		rateLimiter:        rateLimiter,
 		chatRoomRepository: chatRoomRepository,
-		messageRepository:  messageRepository,
-		accountRepository:  accountRepository,
+		chatUseCase:        chatUseCase,
 	}
 }
 
 // HandleSocketMessageWithContext xử lý tin nhắn từ client với context
 func (mh *MessageHandler) HandleSocketMessageWithContext(client *Client, data []byte, ctx context.Context) {
-	var socketMsg SocketMessage
-	if err := json.Unmarshal(data, &socketMsg); err != nil {
+	socketMsg, err := client.codec.Decode(data)
+	if err != nil {
 		mh.sendErrorToClient(client, "Message format is invalid", "")
-		log.Printf("MH: Error parsing message: %v. Data: %s", err, string(data))
+		log.Printf("MH: Error parsing %s message: %v. Data: %q", client.codec.Subprotocol(), err, data)
 		return
 	}
 
+	mh.HandleDecodedMessage(client, socketMsg, ctx)
+}
+
+// HandleDecodedMessage xử lý một SocketMessage đã giải mã, từ ReadPump hoặc từ REST (SSE)
+func (mh *MessageHandler) HandleDecodedMessage(client *Client, socketMsg SocketMessage, ctx context.Context) {
 	// Gán SenderID và Timestamp nếu client không gửi (hoặc để ghi đè)
 	socketMsg.SenderID = client.ID // Luôn dùng ID của client đã xác thực
 	socketMsg.Timestamp = time.Now().UTC().UnixMilli()
@@ -56,6 +65,15 @@ func (mh *MessageHandler) HandleSocketMessageWithContext(client *Client, data []
 		return
 	}
 
+	if !mh.enforceRateLimit(client, socketMsg.Type, ctx) {
+		return
+	}
+
+	// PING chỉ là heartbeat của ứng dụng, không tính là user đang hoạt động
+	if socketMsg.Type != SocketMessageTypePing {
+		mh.hub.markActive(client)
+	}
+
 	switch socketMsg.Type {
 	case SocketMessageTypeChat:
 		mh.handleChatMessage(client, socketMsg, ctx)
@@ -67,6 +85,18 @@ func (mh *MessageHandler) HandleSocketMessageWithContext(client *Client, data []
 		mh.handleTypingMessage(client, socketMsg, ctx)
 	case SocketMessageTypeReadReceipt:
 		mh.handleReadReceiptMessage(client, socketMsg, ctx)
+	case SocketMessageTypeEditMessage:
+		mh.handleEditMessage(client, socketMsg, ctx)
+	case SocketMessageTypeDeleteMessage:
+		mh.handleDeleteMessage(client, socketMsg, ctx)
+	case SocketMessageTypeReact:
+		mh.handleReactMessage(client, socketMsg, ctx, true)
+	case SocketMessageTypeUnreact:
+		mh.handleReactMessage(client, socketMsg, ctx, false)
+	case SocketMessageTypeResume:
+		mh.handleResumeMessage(client, socketMsg, ctx)
+	case SocketMessageTypeSetStatus:
+		mh.handleSetStatusMessage(client, socketMsg, ctx)
 	case SocketMessageTypePing:
 		mh.sendPongToClient(client)
 	default:
@@ -86,98 +116,35 @@ func (mh *MessageHandler) handleChatMessage(client *Client, socketMsg SocketMess
 
 	log.Printf("MH: Handling CHAT message from client %s for room %s", client.ID, payload.ChatRoomID)
 
-	// 1. Kiểm tra client có phải là thành viên (DB) của phòng này không
-	isMemberDB, err := mh.chatRoomRepository.IsUserMemberOfChatRoom(ctx, client.ID, payload.ChatRoomID)
-	if err != nil {
-		log.Printf("MH: Error checking DB membership for client %s in room %s: %v", client.ID, payload.ChatRoomID, err)
-		mh.sendErrorToClient(client, "Could not verify room membership.", "MEMBERSHIP_CHECK_FAILED")
-		return
-	}
-	if !isMemberDB {
-		log.Printf("MH: Client %s is not a DB member of room %s. CHAT message rejected.", client.ID, payload.ChatRoomID)
-		mh.sendErrorToClient(client, "You are not a member of this chat room.", "NOT_A_MEMBER")
-		return
-	}
-
-	if payload.Content == "" {
-		mh.sendErrorToClient(client, "Message content cannot be empty", "EMPTY_CONTENT")
-		return
-	}
-
 	if CheckContext(ctx, client.ID, "MH: Context canceled during CHAT message processing (after parse)") {
 		return
 	}
 
-	// 3. Tạo đối tượng Message domain để lưu vào DB
-	dbMessage := &domain.Message{
-		ID:         uuid.New().String(), // Server tạo ID cho message
-		SenderId:   socketMsg.SenderID,
-		ChatRoomId: payload.ChatRoomID,
-		Type:       domain.TextMessageType, // Giả định là TEXT, có thể mở rộng dựa vào MimeType
-		MimeType:   payload.MimeType,
-		Content:    payload.Content,
-		CreatedAt:  time.UnixMilli(socketMsg.Timestamp).UTC(), // Dùng timestamp từ server
-	}
-
-	// Logic xác định MessageType dựa trên MimeType
-	if payload.MimeType != "" {
-		if strings.HasPrefix(payload.MimeType, "image/") {
-			dbMessage.Type = domain.ImageMessageType
-		} else if strings.HasPrefix(payload.MimeType, "video/") {
-			dbMessage.Type = domain.VideoMessageType
-		} else if strings.HasPrefix(payload.MimeType, "audio/") {
-			dbMessage.Type = domain.AudioMessageType
-		} else if payload.MimeType != "text/plain" {
-			dbMessage.Type = domain.FileMessageType
-		}
+	// Client retry khi mất ACK sẽ gửi lại cùng temp_message_id nên nó là khóa idempotency mặc định
+	idempotencyKey := payload.IdempotencyKey
+	if idempotencyKey == "" {
+		idempotencyKey = payload.TempMessageID
 	}
 
-	// 4. Lưu message vào DB
-	err = mh.messageRepository.CreateMessage(ctx, dbMessage)
+	// Usecase kiểm tra thành viên, lưu tin nhắn và publish MessageSent giống như REST
+	message, err := mh.chatUseCase.SendMessage(ctx, client.ID, payload.ChatRoomID, chat.SendMessageInput{
+		Content:          payload.Content,
+		MimeType:         payload.MimeType,
+		ReplyToMessageID: payload.ReplyToMessageID,
+		IdempotencyKey:   idempotencyKey,
+	})
 	if err != nil {
-		log.Printf("MH: Error saving message to DB from client %s: %v", client.ID, err)
-		mh.sendErrorToClient(client, "Could not save your message.", "DB_SAVE_FAILED")
+		log.Printf("MH: Error sending CHAT message from client %s to room %s: %v", client.ID, payload.ChatRoomID, err)
+		code := chatErrorCode(err, "SEND_FAILED")
+		mh.sendNackToClient(client, payload, chatErrorMessage(code), code)
 		return
 	}
 
-	// 5. Chuẩn bị message để broadcast (có thể enrich data)
-	senderAccount, _ := mh.accountRepository.FindById(ctx, dbMessage.SenderId)
-	senderName := "Unknown User"
-	avatarURL := ""
-	if senderAccount != nil {
-		senderName = senderAccount.Name
-		avatarURL = senderAccount.AvatarURL
-	}
-
-	receivePayload := ChatMessageReceivePayload{
-		MessageID:  dbMessage.ID,
-		SenderName: senderName,
-		AvatarURL:  avatarURL,
-		Content:    dbMessage.Content,
-		MimeType:   dbMessage.MimeType,
-		ChatRoomID: dbMessage.ChatRoomId,
-	}
-
-	payloadBytes, err := json.Marshal(receivePayload)
+	// Xác nhận với người gửi để client thay tin nhắn tạm bằng ID thật
+	mh.sendAckToClient(client, payload, message)
 
-	if err != nil {
-		log.Printf("MH: Failed to marshal payload for Kafka: %v", err)
-		return
-	}
-
-	// Create Kafka event
-	kafkaEvent := &kafkainfra.MQEvent{
-		EventType:  kafkainfra.MessageSent,
-		ChatRoomID: dbMessage.ChatRoomId,
-		SenderID:   dbMessage.SenderId,
-		Timestamp:  dbMessage.CreatedAt,
-		Metadata:   payloadBytes,
-	}
-
-	// Send event đến Kafka
-	if err := mh.hub.kafkaService.PublishChatEvent(ctx, kafkaEvent); err != nil {
-		log.Printf("MH: Failed to publish to Kafka: %v", err)
-	}
+	// Gửi tin nhắn xong thì không còn đang nhập
+	mh.hub.stopTyping(ctx, payload.ChatRoomID, client.ID, TypingStopReasonMessageSent)
 }
 
 func (mh *MessageHandler) handleJoinRoomMessage(client *Client, socketMsg SocketMessage, ctx context.Context) {
@@ -242,42 +209,19 @@ func (mh *MessageHandler) handleTypingMessage(client *Client, socketMsg SocketMe
 		return
 	}
 
-	if mh.hub.IsClientInActiveView(payload.ChatRoomID, client.ID) {
-		// Gửi message này tới các client khác trong active view, trừ sender
+	if mh.hub.IsClientInActiveView(payload.ChatRoomID, client) {
 		log.Printf("MH: TYPING message from client %s for room %s: IsTyping=%t", client.ID, payload.ChatRoomID, payload.IsTyping)
-		// Tạo một bản sao đảm bảo SenderID, UserID và Timestamp được thiết lập đúng
-		typingPayload := TypingPayload{
-			UserID:     client.ID,
-			ChatRoomID: payload.ChatRoomID,
-			IsTyping:   payload.IsTyping,
-		}
+		key := typingKey{ChatRoomID: payload.ChatRoomID, UserID: client.ID}
 
-		// Chuyển đổi payload thành bytes để gửi qua Kafka
-		payloadBytes, err := json.Marshal(typingPayload)
-		if err != nil {
-			log.Printf("MH: Failed to marshal typing payload: %v", err)
-			return
-		}
-
-		// Xác định loại sự kiện Kafka dựa trên trạng thái typing
-		eventType := kafkainfra.TypingStarted
 		if !payload.IsTyping {
-			eventType = kafkainfra.TypingStopped
-		}
-
-		// Tạo sự kiện Kafka
-		kafkaEvent := &kafkainfra.MQEvent{
-			EventType:  eventType,
-			ChatRoomID: payload.ChatRoomID,
-			SenderID:   client.ID,
-			Timestamp:  time.Now().UTC(),
-			Metadata:   payloadBytes,
+			mh.hub.typing.stop(key)
+			mh.hub.publishTypingEvent(ctx, key, false, "")
+			return
 		}
 
-		// Publish sự kiện đến Kafka
-		if err := mh.hub.kafkaService.PublishChatEvent(ctx, kafkaEvent); err != nil {
-			log.Printf("MH: Failed to publish typing event to Kafka: %v", err)
-		}
+		// Ghi nhận TTL để tự gửi typing_stopped nếu client không gửi lại hoặc bị crash
+		mh.hub.typing.start(key, client.ConnID, time.Now())
+		mh.hub.publishTypingEvent(ctx, key, true, "")
 	}
 }
 
@@ -290,21 +234,309 @@ func (mh *MessageHandler) handleReadReceiptMessage(client *Client, socketMsg Soc
 		return
 	}
 
-	if payload.ChatRoomID == "" {
-		log.Printf("MH: READ_RECEIPT message from client %s missing ChatRoomID.", client.ID)
+	if payload.ChatRoomID == "" || payload.MessageID == "" {
+		log.Printf("MH: READ_RECEIPT message from client %s missing ChatRoomID or MessageID.", client.ID)
+		return
+	}
+
+	// Usecase lưu vị trí đã đọc và publish MessageRead nếu vị trí tiến lên,
+	// hub sẽ đẩy READ_RECEIPT cho mọi thiết bị của thành viên phòng
+	if _, err := mh.chatUseCase.MarkMessageRead(ctx, client.ID, payload.ChatRoomID, payload.MessageID); err != nil {
+		log.Printf("MH: Error marking message %s read for client %s: %v", payload.MessageID, client.ID, err)
+		code := chatErrorCode(err, "READ_RECEIPT_FAILED")
+		mh.sendErrorToClient(client, chatErrorMessage(code), code)
+		return
+	}
+}
+
+func (mh *MessageHandler) handleEditMessage(client *Client, socketMsg SocketMessage, ctx context.Context) {
+	payload, err := ParsePayload[EditMessagePayload](socketMsg.Data)
+	if err != nil {
+		log.Printf("MH: Error parsing EDIT_MESSAGE payload from client %s: %v", client.ID, err)
+		mh.sendErrorToClient(client, "Invalid EDIT_MESSAGE payload format", "INVALID_EDIT_PAYLOAD")
+		return
+	}
+
+	if payload.ChatRoomID == "" || payload.MessageID == "" {
+		mh.sendErrorToClient(client, "ChatRoomID and MessageID are required for EDIT_MESSAGE", "EDIT_MISSING_IDS")
+		return
+	}
+
+	// Usecase lưu lịch sử chỉnh sửa và publish MessageEdited, hub sẽ đẩy cập nhật cho thành viên phòng
+	if _, err := mh.chatUseCase.EditMessage(ctx, client.ID, payload.ChatRoomID, payload.MessageID, payload.Content); err != nil {
+		log.Printf("MH: Error editing message %s from client %s: %v", payload.MessageID, client.ID, err)
+		code := chatErrorCode(err, "EDIT_FAILED")
+		mh.sendErrorToClient(client, chatErrorMessage(code), code)
+		return
+	}
+
+	log.Printf("MH: EDIT_MESSAGE from client %s for message %s processed.", client.ID, payload.MessageID)
+}
+
+func (mh *MessageHandler) handleDeleteMessage(client *Client, socketMsg SocketMessage, ctx context.Context) {
+	payload, err := ParsePayload[DeleteMessagePayload](socketMsg.Data)
+	if err != nil {
+		log.Printf("MH: Error parsing DELETE_MESSAGE payload from client %s: %v", client.ID, err)
+		mh.sendErrorToClient(client, "Invalid DELETE_MESSAGE payload format", "INVALID_DELETE_PAYLOAD")
+		return
+	}
+
+	if payload.ChatRoomID == "" || payload.MessageID == "" {
+		mh.sendErrorToClient(client, "ChatRoomID and MessageID are required for DELETE_MESSAGE", "DELETE_MISSING_IDS")
+		return
+	}
+
+	mode := chat.MessageDeleteMode(payload.Mode)
+	if mode == "" {
+		mode = chat.DeleteForMe
+	}
+
+	if _, err := mh.chatUseCase.DeleteMessage(ctx, client.ID, payload.ChatRoomID, payload.MessageID, mode); err != nil {
+		log.Printf("MH: Error deleting message %s from client %s: %v", payload.MessageID, client.ID, err)
+		code := chatErrorCode(err, "DELETE_FAILED")
+		mh.sendErrorToClient(client, chatErrorMessage(code), code)
+		return
+	}
+
+	log.Printf("MH: DELETE_MESSAGE (%s) from client %s for message %s processed.", mode, client.ID, payload.MessageID)
+}
+
+// handleReactMessage xử lý cả REACT (add = true) và UNREACT (add = false)
+func (mh *MessageHandler) handleReactMessage(client *Client, socketMsg SocketMessage, ctx context.Context, add bool) {
+	payload, err := ParsePayload[ReactPayload](socketMsg.Data)
+	if err != nil {
+		log.Printf("MH: Error parsing %s payload from client %s: %v", socketMsg.Type, client.ID, err)
+		mh.sendErrorToClient(client, fmt.Sprintf("Invalid %s payload format", socketMsg.Type), "INVALID_REACT_PAYLOAD")
+		return
+	}
+
+	if payload.ChatRoomID == "" || payload.MessageID == "" {
+		mh.sendErrorToClient(client, fmt.Sprintf("ChatRoomID and MessageID are required for %s", socketMsg.Type), "REACT_MISSING_IDS")
+		return
+	}
+
+	// Usecase publish ReactionAdded/ReactionRemoved, hub sẽ đẩy REACTION_UPDATED cho thành viên phòng
+	if add {
+		_, err = mh.chatUseCase.ReactToMessage(ctx, client.ID, payload.ChatRoomID, payload.MessageID, payload.Emoji)
+	} else {
+		_, err = mh.chatUseCase.UnreactToMessage(ctx, client.ID, payload.ChatRoomID, payload.MessageID, payload.Emoji)
+	}
+	if err != nil {
+		log.Printf("MH: Error handling %s on message %s from client %s: %v", socketMsg.Type, payload.MessageID, client.ID, err)
+		code := chatErrorCode(err, "REACT_FAILED")
+		mh.sendErrorToClient(client, chatErrorMessage(code), code)
 		return
 	}
 
-	// Logic này phức tạp hơn:
-	// 1. Xác nhận messageID tồn tại và thuộc về chatRoomID.
-	// 2. Cập nhật trạng thái "đã đọc" trong DB (nếu có).
-	// 3. Gửi thông báo "đã đọc" đến sender của message gốc (nếu sender đó online và active trong view).
-	// Hoặc gửi cho tất cả mọi người trong active view biết "user X đã đọc đến message Y".
+	log.Printf("MH: %s from client %s for message %s processed.", socketMsg.Type, client.ID, payload.MessageID)
+}
+
+// enforceRateLimit trả về false nếu frame bị bỏ do vượt giới hạn. Mức phạt tăng dần:
+// báo RATE_LIMITED, mute tạm thời, rồi đóng kết nối với mã policy violation.
+func (mh *MessageHandler) enforceRateLimit(client *Client, messageType SocketMessageType, ctx context.Context) bool {
+	switch mh.rateLimiter.Check(ctx, client, messageType) {
+	case rateLimitLimited:
+		log.Printf("MH: Client %s rate limited on %s", client.ID, messageType)
+		mh.sendErrorToClient(client, fmt.Sprintf("Too many %s messages, please slow down", messageType), "RATE_LIMITED")
+		return false
+	case rateLimitMuted:
+		log.Printf("MH: Client %s is muted, dropping %s", client.ID, messageType)
+		mh.sendErrorToClient(client, "You are temporarily muted for sending too many messages", "RATE_LIMITED")
+		return false
+	case rateLimitDisconnect:
+		log.Printf("MH: Client %s (conn %s) disconnected for repeated rate limit violations", client.ID, client.ConnID)
+		client.closeWithPolicyViolation("rate limit exceeded")
+		return false
+	default:
+		return true
+	}
+}
+
+// handleResumeMessage replay các tin nhắn và sự kiện (sửa, thu hồi, reaction, đã đọc) client bị lỡ
+// kể từ seq cuối đã thấy của từng phòng, với đúng frame như khi gửi realtime.
+// Sự kiện realtime đến trong lúc replay được giữ lại và gửi sau, để client nhận đúng thứ tự seq.
+func (mh *MessageHandler) handleResumeMessage(client *Client, socketMsg SocketMessage, ctx context.Context) {
+	payload, err := ParsePayload[ResumePayload](socketMsg.Data)
+	if err != nil {
+		log.Printf("MH: Error parsing RESUME payload from client %s: %v", client.ID, err)
+		mh.sendErrorToClient(client, "Invalid RESUME payload format", "INVALID_RESUME_PAYLOAD")
+		return
+	}
 
-	// Hiện tại, đơn giản là broadcast cho active view:
-	if mh.hub.IsClientInActiveView(payload.ChatRoomID, client.ID) {
-		mh.hub.broadcastToActiveView(payload.ChatRoomID, socketMsg, client.ID)
+	if len(payload.Rooms) > maxResumeRooms {
+		mh.sendErrorToClient(client, fmt.Sprintf("RESUME supports at most %d rooms", maxResumeRooms), "RESUME_TOO_MANY_ROOMS")
+		return
 	}
+
+	client.holdLiveDelivery()
+	defer client.releaseLiveDelivery()
+
+	for chatRoomID, lastSeq := range payload.Rooms {
+		if CheckContext(ctx, client.ID, "MH: Context canceled during RESUME replay") {
+			return
+		}
+
+		replay, err := mh.chatUseCase.GetRoomEventsAfterSeq(ctx, client.ID, chatRoomID, lastSeq, maxResumeReplayPerRoom)
+		if err != nil {
+			log.Printf("MH: Error replaying room %s for client %s: %v", chatRoomID, client.ID, err)
+			code := chatErrorCode(err, "RESUME_FAILED")
+			mh.sendErrorToClient(client, fmt.Sprintf("%s (room %s)", chatErrorMessage(code), chatRoomID), code)
+			continue
+		}
+
+		for _, event := range replay.Events {
+			replayMsg, err := roomEventMessage(event)
+			if err != nil {
+				log.Printf("MH: Error building replay of seq %d in room %s for client %s: %v", event.Seq, chatRoomID, client.ID, err)
+				continue
+			}
+			if !client.sendMessageBlocking(replayMsg) {
+				return
+			}
+		}
+
+		resumedMsg := SocketMessage{
+			Type:      SocketMessageTypeResumed,
+			SenderID:  "system",
+			Timestamp: time.Now().UTC().UnixMilli(),
+			Data: mustMarshal(ResumedPayload{
+				ChatRoomID:    chatRoomID,
+				ReplayedCount: len(replay.Events),
+				LastSeq:       replay.LastSeq,
+				HasMore:       replay.HasMore,
+			}),
+		}
+		if !client.sendMessageBlocking(resumedMsg) {
+			return
+		}
+
+		log.Printf("MH: RESUME replayed %d events of room %s for client %s (has_more=%t)", len(replay.Events), chatRoomID, client.ID, replay.HasMore)
+	}
+}
+
+// receivePayloadFromOutput dựng payload NEW_MESSAGE từ tin nhắn đã lưu
+func receivePayloadFromOutput(message *chat.MessageOutput) ChatMessageReceivePayload {
+	payload := ChatMessageReceivePayload{
+		ChatRoomID:       message.ChatRoomID,
+		MessageID:        message.ID,
+		SenderName:       message.SenderName,
+		AvatarURL:        message.AvatarURL,
+		Content:          message.Content,
+		MimeType:         message.MimeType,
+		ReplyToMessageID: message.ReplyToMessageID,
+		Seq:              message.Seq,
+		IsDeleted:        message.IsDeleted,
+	}
+
+	if message.ReplyTo != nil {
+		payload.ReplyTo = &MessagePreviewPayload{
+			MessageID:  message.ReplyTo.ID,
+			SenderID:   message.ReplyTo.SenderID,
+			SenderName: message.ReplyTo.SenderName,
+			Type:       string(message.ReplyTo.Type),
+			Snippet:    message.ReplyTo.Snippet,
+			IsDeleted:  message.ReplyTo.IsDeleted,
+		}
+	}
+
+	return payload
+}
+
+// chatErrorMessages là thông báo cố định gửi cho client theo mã lỗi. Client không bao giờ nhận
+// err.Error() vì lỗi hệ thống có thể chứa chi tiết nội bộ (câu lệnh, lỗi MySQL); lỗi đầy đủ chỉ
+// được log ở server.
+var chatErrorMessages = map[string]string{
+	"EMPTY_CONTENT":           "Message content cannot be empty.",
+	"NOT_A_MEMBER":            "You are not a member of this chat room.",
+	"NOT_MESSAGE_SENDER":      "Only the original sender can modify this message.",
+	"ROOM_NOT_FOUND":          "Chat room not found.",
+	"MESSAGE_NOT_FOUND":       "Message not found.",
+	"MESSAGE_DELETED":         "Message has been deleted.",
+	"INVALID_DELETE_MODE":     "Delete mode must be for_me or for_everyone.",
+	"INVALID_REACTION":        "Reaction emoji must be between 1 and 32 bytes.",
+	"INVALID_REPLY_TO":        "Reply target must be a message in the same chat room.",
+	"INVALID_IDEMPOTENCY_KEY": "Idempotency key must be at most 64 bytes.",
+	"DB_SAVE_FAILED":          "Could not save message.",
+	"SEND_FAILED":             "Could not send message.",
+	"READ_RECEIPT_FAILED":     "Could not update read position.",
+	"EDIT_FAILED":             "Could not edit message.",
+	"DELETE_FAILED":           "Could not delete message.",
+	"REACT_FAILED":            "Could not update reaction.",
+	"RESUME_FAILED":           "Could not resume room.",
+}
+
+// chatErrorMessage trả về thông báo cố định của mã lỗi
+func chatErrorMessage(code string) string {
+	if message, ok := chatErrorMessages[code]; ok {
+		return message
+	}
+	return "Request failed."
+}
+
+// chatErrorCode ánh xạ lỗi nghiệp vụ của ChatUseCase sang mã lỗi gửi cho client
+func chatErrorCode(err error, fallback string) string {
+	switch {
+	case errors.Is(err, chat.ErrEmptyContent):
+		return "EMPTY_CONTENT"
+	case errors.Is(err, chat.ErrNotChatRoomMember):
+		return "NOT_A_MEMBER"
+	case errors.Is(err, chat.ErrNotMessageSender):
+		return "NOT_MESSAGE_SENDER"
+	case errors.Is(err, chat.ErrChatRoomNotFound):
+		return "ROOM_NOT_FOUND"
+	case errors.Is(err, chat.ErrMessageNotFound):
+		return "MESSAGE_NOT_FOUND"
+	case errors.Is(err, chat.ErrMessageDeleted):
+		return "MESSAGE_DELETED"
+	case errors.Is(err, chat.ErrInvalidDeleteMode):
+		return "INVALID_DELETE_MODE"
+	case errors.Is(err, chat.ErrInvalidReaction):
+		return "INVALID_REACTION"
+	case errors.Is(err, chat.ErrInvalidReplyTo):
+		return "INVALID_REPLY_TO"
+	case errors.Is(err, chat.ErrInvalidIdempotencyKey):
+		return "INVALID_IDEMPOTENCY_KEY"
+	case errors.Is(err, chat.ErrMessageNotSaved):
+		return "DB_SAVE_FAILED"
+	default:
+		return fallback
+	}
+}
+
+// handleSetStatusMessage đặt trạng thái tự chọn và đồng bộ cho mọi kết nối của user
+func (mh *MessageHandler) handleSetStatusMessage(client *Client, socketMsg SocketMessage, ctx context.Context) {
+	payload, err := ParsePayload[SetStatusPayload](socketMsg.Data)
+	if err != nil {
+		log.Printf("MH: Invalid SET_STATUS payload from client %s: %v", client.ID, err)
+		mh.sendErrorToClient(client, "Invalid SET_STATUS payload format", "INVALID_STATUS_PAYLOAD")
+		return
+	}
+
+	output, err := mh.hub.statusUseCase.SetUserPresence(ctx, client.ID, status.SetStatusInput{
+		Status:           domainStatus.UserStatusType(payload.Status),
+		CustomText:       payload.CustomText,
+		ExpiresInSeconds: payload.ExpiresInSeconds,
+	})
+	if err != nil {
+		log.Printf("MH: Error setting status for client %s: %v", client.ID, err)
+		switch {
+		case errors.Is(err, status.ErrInvalidStatus):
+			mh.sendErrorToClient(client, err.Error(), "INVALID_STATUS")
+		case errors.Is(err, status.ErrCustomTextTooLong), errors.Is(err, status.ErrInvalidStatusExpiry):
+			mh.sendErrorToClient(client, err.Error(), "INVALID_CUSTOM_STATUS")
+		default:
+			mh.sendErrorToClient(client, "Could not update status.", "STATUS_UPDATE_FAILED")
+		}
+		return
+	}
+
+	// Các tab/thiết bị khác của user cũng cần thấy trạng thái mới
+	mh.hub.deliverToUser(client.ID, SocketMessage{
+		Type:      SocketMessageTypeStatusUpdated,
+		SenderID:  "system",
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Data:      mustMarshal(presencePayloadFromOutput(output)),
+	})
 }
 
 func (mh *MessageHandler) sendErrorToClient(client *Client, errorMsg string, errorCode string) {
@@ -317,13 +549,50 @@ func (mh *MessageHandler) sendErrorToClient(client *Client, errorMsg string, err
 	}
 
 	// Gửi không block
-	select {
-	case client.Send <- mustMarshal(msg):
-	default:
+	if !client.sendMessage(msg) {
 		log.Printf("MH: Failed to send error message to client %s (channel full/closed). Error: %s", client.ID, errorMsg)
 	}
 }
 
+// sendAckToClient gửi MESSAGE_ACK cho người gửi sau khi tin nhắn đã được lưu vào DB
+func (mh *MessageHandler) sendAckToClient(client *Client, payload *ChatMessageSendPayload, message *chat.MessageOutput) {
+	msg := SocketMessage{
+		Type:      SocketMessageTypeMessageAck,
+		SenderID:  "system",
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Data: mustMarshal(MessageAckPayload{
+			ChatRoomID:    message.ChatRoomID,
+			TempMessageID: payload.TempMessageID,
+			MessageID:     message.ID,
+			CreatedAt:     message.CreatedAt.UnixMilli(),
+			Seq:           message.Seq,
+		}),
+	}
+
+	if !client.sendMessage(msg) {
+		log.Printf("MH: Failed to send MESSAGE_ACK to client %s (channel full/closed). Message: %s", client.ID, message.ID)
+	}
+}
+
+// sendNackToClient gửi MESSAGE_NACK cho người gửi khi tin nhắn bị từ chối, dùng chung mã lỗi với ERROR
+func (mh *MessageHandler) sendNackToClient(client *Client, payload *ChatMessageSendPayload, errorMsg string, errorCode string) {
+	msg := SocketMessage{
+		Type:      SocketMessageTypeMessageNack,
+		SenderID:  "system",
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Data: mustMarshal(MessageNackPayload{
+			ChatRoomID:    payload.ChatRoomID,
+			TempMessageID: payload.TempMessageID,
+			Message:       errorMsg,
+			Code:          errorCode,
+		}),
+	}
+
+	if !client.sendMessage(msg) {
+		log.Printf("MH: Failed to send MESSAGE_NACK to client %s (channel full/closed). Error: %s", client.ID, errorMsg)
+	}
+}
+
 func (mh *MessageHandler) sendPongToClient(client *Client) {
 	msg := SocketMessage{
 		Type:      SocketMessageTypePong,
@@ -331,9 +600,7 @@ func (mh *MessageHandler) sendPongToClient(client *Client) {
 		Timestamp: time.Now().UTC().UnixMilli(),
 	}
 
-	select {
-	case client.Send <- mustMarshal(msg):
-	default:
+	if !client.sendMessage(msg) {
 		log.Printf("MH: Failed to send PONG to client %s (channel full/closed).", client.ID)
 	}
 }
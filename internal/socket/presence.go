@@ -0,0 +1,237 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	domainStatus "gochat-backend/internal/domain/status"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/usecase/status"
+	"log"
+	"sync"
+	"time"
+)
+
+// presenceDebouncer trì hoãn việc chuyển offline sau khi kết nối cuối cùng đóng.
+// Nếu user kết nối lại trong khoảng debounce (reload trang, đổi mạng) thì không
+// phát offline lẫn online, bạn bè không thấy trạng thái nhấp nháy.
+type presenceDebouncer struct {
+	mutex          sync.Mutex
+	delay          time.Duration
+	pendingOffline map[string]*time.Timer // userID -> timer chuyển offline
+}
+
+func newPresenceDebouncer(delay time.Duration) *presenceDebouncer {
+	return &presenceDebouncer{
+		delay:          delay,
+		pendingOffline: make(map[string]*time.Timer),
+	}
+}
+
+// connected hủy offline đang chờ của user. Trả về true nếu user thực sự vừa online
+// (không có offline đang chờ) và cần phát sự kiện online.
+func (d *presenceDebouncer) connected(userID string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	timer, pending := d.pendingOffline[userID]
+	if !pending {
+		return true
+	}
+	timer.Stop()
+	delete(d.pendingOffline, userID)
+	return false
+}
+
+// disconnected hẹn giờ gọi goOffline sau khoảng debounce
+func (d *presenceDebouncer) disconnected(userID string, goOffline func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if timer, pending := d.pendingOffline[userID]; pending {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d.delay, func() {
+		d.mutex.Lock()
+		if d.pendingOffline[userID] != timer {
+			d.mutex.Unlock()
+			return
+		}
+		delete(d.pendingOffline, userID)
+		d.mutex.Unlock()
+
+		goOffline()
+	})
+	d.pendingOffline[userID] = timer
+}
+
+// idleTracker ghi nhận các user đã bị tự chuyển away vì mọi kết nối đều idle
+type idleTracker struct {
+	mutex     sync.Mutex
+	idleAfter time.Duration
+	idleUsers map[string]struct{}
+}
+
+func newIdleTracker(idleAfter time.Duration) *idleTracker {
+	return &idleTracker{idleAfter: idleAfter, idleUsers: make(map[string]struct{})}
+}
+
+// markIdle trả về true nếu user vừa chuyển sang idle
+func (t *idleTracker) markIdle(userID string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, idle := t.idleUsers[userID]; idle {
+		return false
+	}
+	t.idleUsers[userID] = struct{}{}
+	return true
+}
+
+// clear trả về true nếu user đang idle và vừa được bỏ đánh dấu
+func (t *idleTracker) clear(userID string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, idle := t.idleUsers[userID]; !idle {
+		return false
+	}
+	delete(t.idleUsers, userID)
+	return true
+}
+
+// userConnected được gọi trong vòng lặp shard khi user có kết nối đầu tiên trên instance này.
+// Offline đang chờ được hủy ngay trong vòng lặp để giữ đúng thứ tự với userDisconnected
+// (kết nối rồi ngắt ngay không được để user kẹt online), chỉ việc phát presence chạy nền.
+func (h *Hub) userConnected(userID string) {
+	if !h.presence.connected(userID) {
+		log.Printf("Hub: User %s reconnected within presence debounce window", userID)
+		return
+	}
+	go h.publishVisiblePresence(context.Background(), userID)
+}
+
+// userDisconnected được gọi khi kết nối cuối cùng của user trên instance này đóng. User chỉ
+// chuyển offline khi sau khoảng debounce không còn kết nối nào, trên instance này lẫn instance khác.
+func (h *Hub) userDisconnected(userID string) {
+	h.idle.clear(userID)
+
+	h.presence.disconnected(userID, func() {
+		// User có thể đã kết nối lại đúng lúc timer chạy
+		if len(h.userConnections(userID)) > 0 {
+			return
+		}
+		// Kết nối cuối cùng trên instance này đóng nhưng user vẫn có thể đang kết nối qua
+		// instance khác (điện thoại ở A, laptop ở B): instance đóng kết nối sau cùng mới báo offline
+		if h.userConnectedElsewhere(userID) {
+			log.Printf("Hub: User %s is still connected on another instance, not going offline", userID)
+			return
+		}
+
+		if err := h.statusUseCase.SetUserOffline(context.Background(), userID); err != nil {
+			log.Printf("Error setting user %s offline: %v", userID, err)
+		}
+		h.publishVisiblePresence(context.Background(), userID)
+	})
+}
+
+// markActive ghi nhận hoạt động của kết nối, đưa user đang tự động away về online
+func (h *Hub) markActive(client *Client) {
+	client.lastActivity.Store(time.Now().UnixNano())
+
+	if h.idle.clear(client.ID) {
+		go h.setIdle(client.ID, false)
+	}
+}
+
+// runIdleSweeper định kỳ chuyển away các user mà mọi kết nối đều không hoạt động
+func (h *Hub) runIdleSweeper() {
+	if h.idle.idleAfter <= 0 {
+		return
+	}
+
+	interval := min(h.idle.idleAfter/2, 30*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		threshold := now.Add(-h.idle.idleAfter).UnixNano()
+
+		var idleUserIDs []string
+		h.forEachUser(func(userID string, conns map[string]*Client) {
+			for _, client := range conns {
+				if client.lastActivity.Load() > threshold {
+					return
+				}
+			}
+			idleUserIDs = append(idleUserIDs, userID)
+		})
+
+		for _, userID := range idleUserIDs {
+			if h.idle.markIdle(userID) {
+				h.setIdle(userID, true)
+			}
+		}
+	}
+}
+
+func (h *Hub) setIdle(userID string, idle bool) {
+	ctx := context.Background()
+	if err := h.statusUseCase.SetUserIdle(ctx, userID, idle); err != nil {
+		log.Printf("Hub: Error setting idle=%t for user %s: %v", idle, userID, err)
+		return
+	}
+	h.publishVisiblePresence(ctx, userID)
+}
+
+// publishVisiblePresence báo trạng thái hiển thị cho bạn bè khi kết nối thay đổi.
+// User invisible luôn hiện offline nên việc kết nối/idle của họ không được phát đi.
+func (h *Hub) publishVisiblePresence(ctx context.Context, userID string) {
+	own, err := h.statusUseCase.GetOwnStatus(ctx, userID)
+	if err != nil {
+		log.Printf("Hub: Error getting own status of user %s: %v", userID, err)
+		return
+	}
+	if own.Status == domainStatus.Invisible {
+		return
+	}
+
+	if err := h.statusUseCase.PublishPresence(ctx, userID); err != nil {
+		log.Printf("Hub: Failed to publish presence of user %s: %v", userID, err)
+	}
+}
+
+// handlePresenceEvent giao PRESENCE tới những người nhận đang kết nối vào instance này
+func (h *Hub) handlePresenceEvent(event *kafkainfra.MQEvent) error {
+	var payload status.PresenceChangedOutput
+	if err := json.Unmarshal(event.Metadata, &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal presence payload: %w", err)
+	}
+
+	presenceMsg := SocketMessage{
+		Type:      SocketMessageTypePresence,
+		SenderID:  event.SenderID,
+		Timestamp: event.Timestamp.UnixMilli(),
+		Data:      mustMarshal(presencePayloadFromOutput(&payload.UserStatusOutput)),
+	}
+
+	// Sự kiện đã định tuyến chỉ mang người nhận đang kết nối trên instance này
+	recipients := payload.Recipients
+	if event.TargetUserIDs != nil {
+		recipients = event.TargetUserIDs
+	}
+	for _, recipientID := range recipients {
+		h.deliverToUser(recipientID, presenceMsg)
+	}
+	return nil
+}
+
+func presencePayloadFromOutput(output *status.UserStatusOutput) PresencePayload {
+	return PresencePayload{
+		UserID:              output.UserID,
+		Status:              string(output.Status),
+		LastSeen:            output.RawLastSeen * 1000,
+		CustomText:          output.CustomText,
+		CustomTextExpiresAt: output.CustomTextExpiresAt * 1000,
+	}
+}
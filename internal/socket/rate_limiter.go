@@ -0,0 +1,210 @@
+package socket
+
+import (
+	"context"
+	"fmt"
+	"gochat-backend/config"
+	"gochat-backend/internal/infra/redisinfra"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	rateLimitBucketKeyPrefix = "socket_rate_bucket:"
+	rateLimitStrikeKeyPrefix = "socket_rate_strikes:"
+	rateLimitMutedKeyPrefix  = "socket_rate_muted:"
+)
+
+type rateLimitRule struct {
+	RatePerSecond float64
+	Burst         int
+}
+
+// RateLimitConfig cấu hình token bucket cho từng loại socket message và chính sách xử phạt
+type RateLimitConfig struct {
+	Enabled bool
+	Rules   map[SocketMessageType]rateLimitRule
+	Default rateLimitRule
+
+	ViolationWindow time.Duration // Khoảng thời gian đếm số lần vi phạm
+	MuteAfter       int           // Số lần vi phạm trong window thì bị mute
+	MuteDuration    time.Duration
+	DisconnectAfter int // Số lần vi phạm trong window thì bị ngắt kết nối
+}
+
+// Luật mặc định khi cấu hình không hợp lệ, trùng giá trị default trong config
+var (
+	defaultChatRateLimitRule    = rateLimitRule{RatePerSecond: 5, Burst: 10}
+	defaultTypingRateLimitRule  = rateLimitRule{RatePerSecond: 2, Burst: 5}
+	defaultMessageRateLimitRule = rateLimitRule{RatePerSecond: 10, Burst: 20}
+)
+
+func NewRateLimitConfig(env *config.Environment) RateLimitConfig {
+	typingRule := newRateLimitRule("typing", env.SocketTypingRatePerSecond, env.SocketTypingBurst, defaultTypingRateLimitRule)
+	chatRule := newRateLimitRule("chat", env.SocketChatRatePerSecond, env.SocketChatBurst, defaultChatRateLimitRule)
+	defaultRule := newRateLimitRule("default", env.SocketDefaultRatePerSecond, env.SocketDefaultBurst, defaultMessageRateLimitRule)
+
+	return RateLimitConfig{
+		Enabled: env.SocketRateLimitEnabled,
+		Rules: map[SocketMessageType]rateLimitRule{
+			SocketMessageTypeChat:        chatRule,
+			SocketMessageTypeEditMessage: chatRule,
+			SocketMessageTypeTyping:      typingRule,
+		},
+		Default:         defaultRule,
+		ViolationWindow: time.Duration(env.SocketRateLimitWindowSeconds) * time.Second,
+		MuteAfter:       env.SocketRateLimitMuteAfter,
+		MuteDuration:    time.Duration(env.SocketRateLimitMuteSeconds) * time.Second,
+		DisconnectAfter: env.SocketRateLimitDisconnectAfter,
+	}
+}
+
+// newRateLimitRule kiểm tra rate và burst phải dương: rate 0 làm bucket không bao giờ nạp lại
+// (TTL của bucket trên Redis thành vô hạn), burst 0 chặn mọi frame. Giá trị sai dùng fallback.
+func newRateLimitRule(name string, ratePerSecond float64, burst int, fallback rateLimitRule) rateLimitRule {
+	rule := rateLimitRule{RatePerSecond: ratePerSecond, Burst: burst}
+	if !(rule.RatePerSecond > 0) || math.IsInf(rule.RatePerSecond, 0) {
+		log.Printf("RateLimiter: Invalid %s rate %v per second, using %v", name, rule.RatePerSecond, fallback.RatePerSecond)
+		rule.RatePerSecond = fallback.RatePerSecond
+	}
+	if rule.Burst <= 0 {
+		log.Printf("RateLimiter: Invalid %s burst %d, using %d", name, rule.Burst, fallback.Burst)
+		rule.Burst = fallback.Burst
+	}
+	return rule
+}
+
+func (c RateLimitConfig) ruleFor(messageType SocketMessageType) rateLimitRule {
+	if rule, ok := c.Rules[messageType]; ok {
+		return rule
+	}
+	return c.Default
+}
+
+type rateLimitVerdict int
+
+const (
+	rateLimitAllow      rateLimitVerdict = iota
+	rateLimitLimited                     // Vượt giới hạn: bỏ frame và báo RATE_LIMITED
+	rateLimitMuted                       // Đang bị mute: bỏ mọi frame trong thời gian mute
+	rateLimitDisconnect                  // Vi phạm quá nhiều: đóng kết nối với mã policy violation
+)
+
+// RateLimiter áp dụng token bucket ở hai tầng: bucket cục bộ theo từng kết nối
+// và bucket dùng chung trên Redis theo user, để mở nhiều kết nối hay kết nối lại
+// cũng không được reset giới hạn. Nếu Redis lỗi thì chỉ dùng bucket cục bộ.
+type RateLimiter struct {
+	config       RateLimitConfig
+	redisService redisinfra.RedisService
+}
+
+func NewRateLimiter(config RateLimitConfig, redisService redisinfra.RedisService) *RateLimiter {
+	return &RateLimiter{config: config, redisService: redisService}
+}
+
+// Check quyết định frame của client có được xử lý hay không và ghi nhận vi phạm
+func (l *RateLimiter) Check(ctx context.Context, client *Client, messageType SocketMessageType) rateLimitVerdict {
+	if l == nil || !l.config.Enabled {
+		return rateLimitAllow
+	}
+
+	now := time.Now()
+	rule := l.config.ruleFor(messageType)
+
+	if l.isMuted(ctx, client, now) {
+		return l.recordViolation(ctx, client, now, rateLimitMuted)
+	}
+
+	// Bucket cục bộ luôn được kiểm tra trước, không tốn round-trip tới Redis
+	if !client.takeLocalToken(messageType, rule, now) {
+		return l.recordViolation(ctx, client, now, rateLimitLimited)
+	}
+
+	if l.redisService != nil {
+		key := fmt.Sprintf("%s%s:%s", rateLimitBucketKeyPrefix, client.ID, messageType)
+		allowed, err := l.redisService.AllowTokenBucket(ctx, key, rule.RatePerSecond, rule.Burst)
+		if err != nil {
+			log.Printf("RateLimiter: Redis bucket unavailable for user %s, using local limit only: %v", client.ID, err)
+		} else if !allowed {
+			return l.recordViolation(ctx, client, now, rateLimitLimited)
+		}
+	}
+
+	return rateLimitAllow
+}
+
+// recordViolation tăng số lần vi phạm của user và leo thang hình phạt khi vượt ngưỡng
+func (l *RateLimiter) recordViolation(ctx context.Context, client *Client, now time.Time, verdict rateLimitVerdict) rateLimitVerdict {
+	client.rateLimitStrikes++
+	strikes := int64(client.rateLimitStrikes)
+
+	if l.redisService != nil {
+		shared, err := l.redisService.Increment(ctx, rateLimitStrikeKeyPrefix+client.ID, l.config.ViolationWindow)
+		if err != nil {
+			log.Printf("RateLimiter: Failed to record strike for user %s: %v", client.ID, err)
+		} else {
+			strikes = shared
+		}
+	}
+
+	switch {
+	case l.config.DisconnectAfter > 0 && strikes >= int64(l.config.DisconnectAfter):
+		return rateLimitDisconnect
+	case verdict == rateLimitLimited && l.config.MuteAfter > 0 && strikes >= int64(l.config.MuteAfter):
+		l.mute(ctx, client, now)
+		return rateLimitMuted
+	default:
+		return verdict
+	}
+}
+
+func (l *RateLimiter) isMuted(ctx context.Context, client *Client, now time.Time) bool {
+	if now.Before(client.mutedUntil) {
+		return true
+	}
+
+	if l.redisService == nil {
+		return false
+	}
+
+	// Mute được lưu trên Redis để kết nối lại không thoát được mute
+	var mutedUntil int64
+	if err := l.redisService.Get(ctx, rateLimitMutedKeyPrefix+client.ID, &mutedUntil); err != nil {
+		return false
+	}
+
+	client.mutedUntil = time.UnixMilli(mutedUntil)
+	return now.Before(client.mutedUntil)
+}
+
+func (l *RateLimiter) mute(ctx context.Context, client *Client, now time.Time) {
+	client.mutedUntil = now.Add(l.config.MuteDuration)
+
+	if l.redisService == nil {
+		return
+	}
+
+	if err := l.redisService.Set(ctx, rateLimitMutedKeyPrefix+client.ID, client.mutedUntil.UnixMilli(), l.config.MuteDuration); err != nil {
+		log.Printf("RateLimiter: Failed to persist mute for user %s: %v", client.ID, err)
+	}
+}
+
+// tokenBucket là bucket cục bộ của một kết nối cho một loại message.
+// Chỉ được dùng trong goroutine ReadPump của client nên không cần lock.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(rule rateLimitRule, now time.Time) bool {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+elapsed*rule.RatePerSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,48 @@
+//go:build unit
+// +build unit
+
+package socket
+
+import (
+	"testing"
+	"time"
+
+	"gochat-backend/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRateLimitConfigReplacesNonPositiveRules(t *testing.T) {
+	cfg := NewRateLimitConfig(&config.Environment{
+		SocketChatRatePerSecond:    0,
+		SocketChatBurst:            10,
+		SocketTypingRatePerSecond:  2,
+		SocketTypingBurst:          0,
+		SocketDefaultRatePerSecond: -1,
+		SocketDefaultBurst:         -5,
+	})
+
+	assert.Equal(t, defaultChatRateLimitRule, cfg.ruleFor(SocketMessageTypeChat))
+	assert.Equal(t, defaultTypingRateLimitRule, cfg.ruleFor(SocketMessageTypeTyping))
+	assert.Equal(t, defaultMessageRateLimitRule, cfg.ruleFor(SocketMessageTypeJoin))
+}
+
+func TestNewRateLimitConfigKeepsValidRules(t *testing.T) {
+	cfg := NewRateLimitConfig(&config.Environment{
+		SocketChatRatePerSecond:    0.5,
+		SocketChatBurst:            3,
+		SocketTypingRatePerSecond:  2,
+		SocketTypingBurst:          5,
+		SocketDefaultRatePerSecond: 10,
+		SocketDefaultBurst:         20,
+	})
+
+	rule := cfg.ruleFor(SocketMessageTypeChat)
+	assert.Equal(t, rateLimitRule{RatePerSecond: 0.5, Burst: 3}, rule)
+
+	// Bucket vẫn được nạp lại với rate nhỏ hơn 1
+	now := time.Now()
+	bucket := &tokenBucket{tokens: 0, last: now}
+	assert.False(t, bucket.take(rule, now))
+	assert.True(t, bucket.take(rule, now.Add(2*time.Second)))
+}
@@ -0,0 +1,134 @@
+package socket
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"gochat-backend/config"
+	"gochat-backend/internal/repository"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRoomMemberCacheSize = 10000
+	defaultRoomMemberCacheTTL  = 5 * time.Minute
+)
+
+// roomMemberEntry là danh sách thành viên đã nạp của một phòng
+type roomMemberEntry struct {
+	chatRoomID string
+	memberIDs  []string
+	loadedAt   time.Time
+}
+
+// RoomMemberCache giữ danh sách thành viên của các phòng vừa có sự kiện để fan-out không phải
+// truy vấn MySQL cho mỗi tin nhắn. Cache giới hạn số phòng (bỏ phòng lâu không dùng nhất) và
+// mỗi phòng chỉ sống trong TTL. Sự kiện membership_changed xóa phòng khỏi cache trên mọi
+// instance; TTL là lưới an toàn khi sự kiện đó bị lỡ.
+type RoomMemberCache struct {
+	chatRoomRepo repository.ChatRoomRepository
+	maxRooms     int
+	ttl          time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element // chatRoomID -> phần tử trong lru
+	lru     *list.List               // Đầu danh sách là phòng vừa được dùng
+
+	// Tăng mỗi lần invalidate: kết quả nạp từ DB bắt đầu trước lần invalidate
+	// có thể đã cũ nên không được ghi vào cache
+	generation uint64
+}
+
+func NewRoomMemberCache(chatRoomRepo repository.ChatRoomRepository, cfg *config.Environment) *RoomMemberCache {
+	maxRooms := cfg.SocketRoomMemberCacheSize
+	if maxRooms <= 0 {
+		maxRooms = defaultRoomMemberCacheSize
+	}
+	ttl := time.Duration(cfg.SocketRoomMemberCacheTTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultRoomMemberCacheTTL
+	}
+
+	return &RoomMemberCache{
+		chatRoomRepo: chatRoomRepo,
+		maxRooms:     maxRooms,
+		ttl:          ttl,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+// MemberIDs trả về UserID các thành viên của phòng, nạp từ DB nếu chưa có hoặc đã hết hạn.
+// Slice trả về dùng chung với cache, caller không được sửa.
+func (c *RoomMemberCache) MemberIDs(ctx context.Context, chatRoomID string) ([]string, error) {
+	now := time.Now()
+
+	c.mutex.Lock()
+	if element, exists := c.entries[chatRoomID]; exists {
+		entry := element.Value.(*roomMemberEntry)
+		if now.Sub(entry.loadedAt) < c.ttl {
+			c.lru.MoveToFront(element)
+			c.mutex.Unlock()
+			return entry.memberIDs, nil
+		}
+		c.removeElement(element)
+	}
+	generation := c.generation
+	c.mutex.Unlock()
+
+	members, err := c.chatRoomRepo.FindChatRoomMembers(ctx, chatRoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch members of room %s: %w", chatRoomID, err)
+	}
+
+	memberIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserId)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.generation == generation {
+		c.store(&roomMemberEntry{chatRoomID: chatRoomID, memberIDs: memberIDs, loadedAt: now})
+	}
+	return memberIDs, nil
+}
+
+// Invalidate xóa phòng khỏi cache, lần fan-out sau sẽ nạp lại từ DB
+func (c *RoomMemberCache) Invalidate(chatRoomID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	if element, exists := c.entries[chatRoomID]; exists {
+		c.removeElement(element)
+	}
+}
+
+// Len trả về số phòng đang có trong cache
+func (c *RoomMemberCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// store ghi entry vào cache và bỏ phòng lâu không dùng nhất khi vượt giới hạn. Caller phải giữ mutex.
+func (c *RoomMemberCache) store(entry *roomMemberEntry) {
+	if element, exists := c.entries[entry.chatRoomID]; exists {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.chatRoomID] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxRooms {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement xóa phần tử khỏi lru và map. Caller phải giữ mutex.
+func (c *RoomMemberCache) removeElement(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*roomMemberEntry).chatRoomID)
+}
@@ -0,0 +1,71 @@
+package socket
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"gochat-backend/config"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/repository"
+)
+
+// countingChatRoomRepo giả lập MySQL: trả thành viên phòng theo cách chia của newBenchmarkHub
+// và đếm số truy vấn FindChatRoomMembers
+type countingChatRoomRepo struct {
+	repository.ChatRoomRepository
+	queries atomic.Int64
+}
+
+func (r *countingChatRoomRepo) FindChatRoomMembers(ctx context.Context, chatRoomID string) ([]*domain.ChatRoomMember, error) {
+	r.queries.Add(1)
+
+	roomIndex, _ := strconv.Atoi(chatRoomID[len("room-"):])
+	members := make([]*domain.ChatRoomMember, 0, benchRoomMembers)
+	for i := 0; i < benchRoomMembers; i++ {
+		members = append(members, &domain.ChatRoomMember{
+			ChatRoomId: chatRoomID,
+			UserId:     "user-" + strconv.Itoa((roomIndex+i*benchRooms)%benchUsers),
+		})
+	}
+	return members, nil
+}
+
+// BenchmarkRoomFanOut đo phần tra cứu người nhận của fan-out một tin nhắn (thành viên phòng
+// rồi kết nối của họ) khi truy vấn DB cho mỗi tin nhắn so với khi dùng RoomMemberCache.
+// Chỉ số db-queries/op cho biết số truy vấn MySQL trung bình của mỗi tin nhắn:
+//
+//	go test ./internal/socket -run '^$' -bench RoomFanOut
+func BenchmarkRoomFanOut(b *testing.B) {
+	b.Run("cache=off", func(b *testing.B) {
+		hub := newBenchmarkHub(4, newHubBenchData())
+		repo := &countingChatRoomRepo{}
+		ctx := context.Background()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			members, _ := repo.FindChatRoomMembers(ctx, "room-"+strconv.Itoa(i%benchRooms))
+			memberIDs := make([]string, 0, len(members))
+			for _, member := range members {
+				memberIDs = append(memberIDs, member.UserId)
+			}
+			hub.connectionsOfUsers(memberIDs)
+		}
+		b.ReportMetric(float64(repo.queries.Load())/float64(b.N), "db-queries/op")
+	})
+
+	b.Run("cache=on", func(b *testing.B) {
+		hub := newBenchmarkHub(4, newHubBenchData())
+		repo := &countingChatRoomRepo{}
+		cache := NewRoomMemberCache(repo, &config.Environment{})
+		ctx := context.Background()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			memberIDs, _ := cache.MemberIDs(ctx, "room-"+strconv.Itoa(i%benchRooms))
+			hub.connectionsOfUsers(memberIDs)
+		}
+		b.ReportMetric(float64(repo.queries.Load())/float64(b.N), "db-queries/op")
+	})
+}
@@ -2,44 +2,63 @@ package socket
 
 import (
 	"context"
+	"errors"
 	"gochat-backend/internal/usecase"
+	"gochat-backend/internal/usecase/chat"
 	"gochat-backend/internal/usecase/status"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// ErrConnectionNotFound khi ConnID không thuộc về user hoặc kết nối đã đóng
+var ErrConnectionNotFound = errors.New("realtime connection not found")
+
 type SocketManager struct {
-	Hub           *Hub
-	statusUseCase status.StatusUseCase
+	Hub            *Hub
+	statusUseCase  status.StatusUseCase
+	allowedOrigins []string
 }
 
-// NewSocketManager khởi tạo SocketManager mới
-func NewSocketManager(deps *usecase.SharedDependencies, statusUseCase status.StatusUseCase) *SocketManager {
-	hub := NewHub(deps, statusUseCase)
+// NewSocketManager khởi tạo SocketManager mới. roomMembers dùng chung với event bus
+// để cả hai cùng được làm mới khi có sự kiện membership_changed.
+func NewSocketManager(deps *usecase.SharedDependencies, statusUseCase status.StatusUseCase, chatUseCase chat.ChatUseCase, roomMembers *RoomMemberCache) *SocketManager {
+	hub := NewHub(deps, statusUseCase, chatUseCase, roomMembers)
 	// Khởi chạy hub trong goroutine riêng
 	go hub.Run()
 
-	go hub.startKafkaConsumer()
+	go hub.startEventConsumer()
+
+	go hub.runTypingSweeper()
+
+	go hub.runIdleSweeper()
+
+	go hub.runConnectionRegistry()
 
 	return &SocketManager{
-		Hub:           hub,
-		statusUseCase: statusUseCase,
+		Hub:            hub,
+		statusUseCase:  statusUseCase,
+		allowedOrigins: deps.Config.AllowedOrigins(),
 	}
 }
 
 // ServeWS xử lý upgrade HTTP lên WebSocket và đăng ký client mới
 // clientID ở đây CHÍNH LÀ UserID của người dùng đã xác thực
 func (sm *SocketManager) ServeWS(w http.ResponseWriter, r *http.Request, userID string) {
+	if sm.rejectIfDraining(w, userID) {
+		return
+	}
+
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			// TODO: Implement a proper origin check for production
-			// Ví dụ: return r.Header.Get("Origin") == "http://yourfrontend.com"
-			return true
-		},
+		CheckOrigin:     sm.checkOrigin,
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
+		// Client chọn định dạng qua Sec-WebSocket-Protocol, không gửi thì dùng JSON
+		Subprotocols: supportedSubprotocols,
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -48,10 +67,77 @@ func (sm *SocketManager) ServeWS(w http.ResponseWriter, r *http.Request, userID
 		http.Error(w, "Could not open websocket connection", http.StatusBadRequest)
 		return
 	}
-	log.Printf("SocketManager: WebSocket connection upgraded for user %s", userID)
+	clientCodec := codecForSubprotocol(conn.Subprotocol())
+	log.Printf("SocketManager: WebSocket connection upgraded for user %s (codec %s)", userID, clientCodec.Subprotocol())
+
+	client := sm.registerClient(r.Context(), userID, newWebSocketConn(conn), clientCodec)
+
+	// Goroutine đọc và ghi message cho client này
+	// ReadPump và WritePump sẽ tự xử lý việc đóng kết nối và unregister khi cần
+	go client.WritePump()
+	go client.ReadPump() // ReadPump nên chạy sau WritePump để WritePump có thể gửi CloseMessage nếu ReadPump thoát trước
+
+	log.Printf("SocketManager: Client %s (conn %s) registered and pumps started.", userID, client.ConnID)
+}
+
+// checkOrigin chỉ cho phép upgrade từ các origin trong CORS_ALLOW_ORIGIN ("*" cho phép tất cả).
+// Request không có Origin đến từ client không phải trình duyệt nên không bị chặn cross-site.
+func (sm *SocketManager) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range sm.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	log.Printf("SocketManager: Rejected WebSocket upgrade from origin %s", origin)
+	return false
+}
+
+// ServeSSE mở stream Server-Sent Events cho user đã xác thực và đăng ký với Hub như
+// một client chỉ nhận. Hàm chỉ trả về khi stream kết thúc.
+func (sm *SocketManager) ServeSSE(w http.ResponseWriter, r *http.Request, userID string) {
+	if sm.rejectIfDraining(w, userID) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Tắt buffer của nginx
+	w.WriteHeader(http.StatusOK)
+
+	conn := newSSEConn(w, r)
+	if err := conn.controller.Flush(); err != nil {
+		log.Printf("SocketManager: SSE not supported for user %s: %v", userID, err)
+		return
+	}
+
+	// SSE là text nên luôn dùng JSON
+	client := sm.registerClient(r.Context(), userID, conn, jsonSocketCodec)
+
+	// Client cần ConnID để gửi kèm khi gọi các REST endpoint hành động
+	client.sendMessage(SocketMessage{
+		Type:      SocketMessageTypeConnected,
+		SenderID:  "system",
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Data:      mustMarshal(ConnectedPayload{ConnID: client.ConnID, Transport: conn.Transport()}),
+	})
 
+	go client.ReadPump()
+	client.WritePump()
+
+	log.Printf("SocketManager: SSE stream for client %s (conn %s) closed.", userID, client.ConnID)
+}
+
+// registerClient tạo Client cho một kết nối đã mở, cập nhật online và đăng ký với Hub
+func (sm *SocketManager) registerClient(ctx context.Context, userID string, conn ClientConn, clientCodec Codec) *Client {
 	// Cập nhật trạng thái user online
-	if err := sm.statusUseCase.SetUserOnline(r.Context(), userID); err != nil {
+	if err := sm.statusUseCase.SetUserOnline(ctx, userID); err != nil {
 		log.Printf("SocketManager: Error setting user %s online: %v", userID, err)
 		// Không hủy kết nối ở đây, vẫn cho phép user kết nối
 	}
@@ -60,21 +146,36 @@ func (sm *SocketManager) ServeWS(w http.ResponseWriter, r *http.Request, userID
 	clientCtx, clientCancel := context.WithCancel(context.Background())
 
 	client := &Client{
-		ID:     userID, // Client.ID chính là UserID
-		Conn:   conn,
-		Send:   make(chan []byte, 256), // Kênh buffered để tránh block
-		Hub:    sm.Hub,
-		ctx:    clientCtx,
-		cancel: clientCancel,
+		ID:        userID,              // Client.ID chính là UserID
+		ConnID:    uuid.New().String(), // Mỗi tab/thiết bị là một kết nối riêng
+		Conn:      conn,
+		Send:      make(chan []byte, 256), // Kênh buffered để tránh block
+		Hub:       sm.Hub,
+		ctx:       clientCtx,
+		cancel:    clientCancel,
+		codec:     clientCodec,
+		sendSpace: make(chan struct{}, 1),
 	}
+	client.lastActivity.Store(time.Now().UnixNano())
 
 	// Đăng ký client với Hub
-	sm.Hub.Register <- client
+	sm.Hub.register(client)
+	return client
+}
 
-	// Goroutine đọc và ghi message cho client này
-	// ReadPump và WritePump sẽ tự xử lý việc đóng kết nối và unregister khi cần
-	go client.WritePump()
-	go client.ReadPump() // ReadPump nên chạy sau WritePump để WritePump có thể gửi CloseMessage nếu ReadPump thoát trước
+// Dispatch xử lý một hành động client gửi qua REST (dành cho kết nối SSE) như thể
+// nhận được trên chính kết nối đó; phản hồi (ACK, lỗi, ...) được gửi qua stream
+func (sm *SocketManager) Dispatch(userID, connID string, message SocketMessage) error {
+	client := sm.Hub.findConnection(userID, connID)
+	if client == nil {
+		return ErrConnectionNotFound
+	}
+
+	// Các request REST có thể tới đồng thời, trạng thái rate limit của client
+	// chỉ an toàn khi được xử lý tuần tự như trong ReadPump
+	client.dispatchMutex.Lock()
+	defer client.dispatchMutex.Unlock()
 
-	log.Printf("SocketManager: Client %s registered and pumps started.", userID)
+	sm.Hub.MessageHandler.HandleDecodedMessage(client, message, client.ctx)
+	return nil
 }
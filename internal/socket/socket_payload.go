@@ -16,6 +16,15 @@ type ChatMessageSendPayload struct {
 	Content       string `json:"content"`
 	MimeType      string `json:"mime_type,omitempty"`
 	TempMessageID string `json:"temp_message_id,omitempty"`
+	// ReplyToMessageID là tin nhắn được trích dẫn, phải cùng phòng
+	ReplyToMessageID string `json:"reply_to_message_id,omitempty"`
+	// IdempotencyKey chống tạo trùng khi client gửi lại, để trống thì dùng TempMessageID
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// ResumePayload chứa seq cuối cùng client đã thấy của từng phòng (chat_room_id -> seq)
+type ResumePayload struct {
+	Rooms map[string]int64 `json:"rooms"`
 }
 
 type JoinRoomPayload struct {
@@ -30,11 +39,27 @@ type TypingPayload struct {
 	UserID     string `json:"user_id"`
 	ChatRoomID string `json:"chat_room_id,omitempty"`
 	IsTyping   bool   `json:"is_typing"`
+	Reason     string `json:"reason,omitempty"` // Server điền khi tự dừng typing: expired, message_sent, disconnected
 }
 
 type ReadReceiptPayload struct {
 	ChatRoomID string `json:"chat_room_id,omitempty"`
-	MessageID  string `json:"message_id"` // ID của tin nhắn đã đọc
+	MessageID  string `json:"message_id"`        // ID của tin nhắn đã đọc
+	UserID     string `json:"user_id,omitempty"` // Server điền khi fan-out: người đã đọc
+	ReadAt     int64  `json:"read_at,omitempty"` // Server điền khi fan-out
+	Seq        int64  `json:"seq,omitempty"`     // Server điền khi fan-out
+}
+
+type EditMessagePayload struct {
+	ChatRoomID string `json:"chat_room_id,omitempty"`
+	MessageID  string `json:"message_id"`
+	Content    string `json:"content"`
+}
+
+type DeleteMessagePayload struct {
+	ChatRoomID string `json:"chat_room_id,omitempty"`
+	MessageID  string `json:"message_id"`
+	Mode       string `json:"mode"` // "for_me" hoặc "for_everyone"
 }
 
 // --- Payloads cho Server -> Client ---
@@ -45,6 +70,63 @@ type ChatMessageReceivePayload struct {
 	AvatarURL  string `json:"avatar_url,omitempty"`
 	Content    string `json:"content"`
 	MimeType   string `json:"mime_type,omitempty"`
+
+	ReplyToMessageID string                 `json:"reply_to_message_id,omitempty"`
+	ReplyTo          *MessagePreviewPayload `json:"reply_to,omitempty"`
+
+	// Seq tăng liên tục theo phòng, dùng chung cho tin nhắn mới và các sự kiện MESSAGE_EDITED,
+	// MESSAGE_DELETED (thu hồi), REACTION_UPDATED, READ_RECEIPT. Nếu seq nhận được lớn hơn
+	// seq cuối đã thấy + 1, client đã lỡ sự kiện và nên gửi RESUME cho phòng đó.
+	Seq       int64 `json:"seq"`
+	IsDeleted bool  `json:"is_deleted,omitempty"` // Chỉ có khi replay tin nhắn đã bị thu hồi
+}
+
+// MessagePreviewPayload là preview rút gọn của tin nhắn gốc đi kèm một reply
+type MessagePreviewPayload struct {
+	MessageID  string `json:"message_id"`
+	SenderID   string `json:"sender_id"`
+	SenderName string `json:"sender_name"`
+	Type       string `json:"type"`
+	Snippet    string `json:"snippet"`
+	IsDeleted  bool   `json:"is_deleted,omitempty"`
+}
+
+type MessageEditedPayload struct {
+	ChatRoomID string `json:"chat_room_id,omitempty"`
+	MessageID  string `json:"message_id"`
+	Content    string `json:"content"`
+	EditedAt   int64  `json:"edited_at"`
+	Seq        int64  `json:"seq"`
+}
+
+type ReactPayload struct {
+	ChatRoomID string `json:"chat_room_id,omitempty"`
+	MessageID  string `json:"message_id"`
+	Emoji      string `json:"emoji"`
+}
+
+type ReactionCountPayload struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+type ReactionUpdatedPayload struct {
+	ChatRoomID string                 `json:"chat_room_id,omitempty"`
+	MessageID  string                 `json:"message_id"`
+	UserID     string                 `json:"user_id"`
+	Emoji      string                 `json:"emoji"`
+	Added      bool                   `json:"added"`     // false khi user gỡ reaction
+	Reactions  []ReactionCountPayload `json:"reactions"` // Tổng số reaction hiện tại theo emoji
+	Seq        int64                  `json:"seq"`
+}
+
+type MessageDeletedPayload struct {
+	ChatRoomID string `json:"chat_room_id,omitempty"`
+	MessageID  string `json:"message_id"`
+	Mode       string `json:"mode"`
+	DeletedBy  string `json:"deleted_by"`
+	DeletedAt  int64  `json:"deleted_at"`
+	Seq        int64  `json:"seq,omitempty"` // Không có với "xóa phía tôi" vì phòng không thay đổi
 }
 
 type UserEventPayload struct {
@@ -54,6 +136,40 @@ type UserEventPayload struct {
 	AvatarURL  string `json:"avatar_url,omitempty"`
 }
 
+// ConnectedPayload gửi đầu stream SSE để client biết ConnID của kết nối
+type ConnectedPayload struct {
+	ConnID    string `json:"conn_id"`
+	Transport string `json:"transport"`
+}
+
+// ReconnectPayload gửi trước khi server đóng kết nối để khởi động lại hoặc deploy
+type ReconnectPayload struct {
+	Reason  string `json:"reason"`
+	DelayMs int64  `json:"delay_ms"` // Thời gian client nên chờ trước khi kết nối lại
+}
+
+// ResyncRequiredPayload báo server có thể đã lỡ sự kiện của client (mất kết nối tới bus),
+// client gửi RESUME với seq cuối đã thấy của từng phòng để lấy lại
+type ResyncRequiredPayload struct {
+	Reason string `json:"reason"`
+}
+
+// PresencePayload báo trạng thái hiển thị của một user cho bạn bè và người chat riêng
+type PresencePayload struct {
+	UserID              string `json:"user_id"`
+	Status              string `json:"status"`              // online | away | dnd | offline
+	LastSeen            int64  `json:"last_seen,omitempty"` // Unix milliseconds
+	CustomText          string `json:"custom_text,omitempty"`
+	CustomTextExpiresAt int64  `json:"custom_text_expires_at,omitempty"` // Unix milliseconds
+}
+
+// SetStatusPayload là trạng thái user tự chọn gửi qua SET_STATUS
+type SetStatusPayload struct {
+	Status           string `json:"status"` // online | away | dnd | invisible
+	CustomText       string `json:"custom_text,omitempty"`
+	ExpiresInSeconds int    `json:"expires_in_seconds,omitempty"`
+}
+
 type ActiveUsersListPayload struct {
 	ChatRoomID string             `json:"chat_room_id,omitempty"`
 	Users      []UserEventPayload `json:"users"`
@@ -65,6 +181,33 @@ type JoinSuccessPayload struct {
 	InitialMessages []ChatMessageReceivePayload `json:"initial_messages,omitempty"`
 }
 
+// MessageAckPayload xác nhận với người gửi rằng tin nhắn đã được lưu,
+// kèm ID do server tạo để client đối chiếu với tin nhắn tạm
+type MessageAckPayload struct {
+	ChatRoomID    string `json:"chat_room_id,omitempty"`
+	TempMessageID string `json:"temp_message_id,omitempty"`
+	MessageID     string `json:"message_id"`
+	CreatedAt     int64  `json:"created_at"`
+	Seq           int64  `json:"seq"`
+}
+
+// ResumedPayload báo đã replay xong một phòng. HasMore = true nghĩa là khoảng trống quá lớn
+// để replay qua socket, client cần tải lại lịch sử qua REST rồi đặt seq cuối là LastSeq.
+type ResumedPayload struct {
+	ChatRoomID    string `json:"chat_room_id"`
+	ReplayedCount int    `json:"replayed_count"`
+	LastSeq       int64  `json:"last_seq"`
+	HasMore       bool   `json:"has_more"`
+}
+
+// MessageNackPayload báo cho người gửi rằng tin nhắn tạm không được lưu
+type MessageNackPayload struct {
+	ChatRoomID    string `json:"chat_room_id,omitempty"`
+	TempMessageID string `json:"temp_message_id,omitempty"`
+	Message       string `json:"message"`
+	Code          string `json:"code"`
+}
+
 type ErrorPayload struct {
 	ChatRoomID string `json:"chat_room_id,omitempty"`
 	Message    string `json:"message"`
@@ -4,20 +4,37 @@ type SocketMessageType string
 
 const (
 	// Tin nhắn từ client
-	SocketMessageTypeChat        SocketMessageType = "SEND_MESSAGE" // Gửi tin nhắn chat
-	SocketMessageTypeJoin        SocketMessageType = "JOIN_ROOM"    // Tham gia phòng chat
-	SocketMessageTypeLeave       SocketMessageType = "LEAVE_ROOM"   // Rời phòng chat
-	SocketMessageTypeTyping      SocketMessageType = "TYPING"       // Đang nhập
-	SocketMessageTypeReadReceipt SocketMessageType = "READ_RECEIPT" // Đánh dấu đã đọc
-	SocketMessageTypePing        SocketMessageType = "PING"         // Tin nhắn ping để kiểm tra kết nối
+	SocketMessageTypeChat          SocketMessageType = "SEND_MESSAGE"   // Gửi tin nhắn chat
+	SocketMessageTypeJoin          SocketMessageType = "JOIN_ROOM"      // Tham gia phòng chat
+	SocketMessageTypeLeave         SocketMessageType = "LEAVE_ROOM"     // Rời phòng chat
+	SocketMessageTypeTyping        SocketMessageType = "TYPING"         // Đang nhập
+	SocketMessageTypeReadReceipt   SocketMessageType = "READ_RECEIPT"   // Đánh dấu đã đọc
+	SocketMessageTypePing          SocketMessageType = "PING"           // Tin nhắn ping để kiểm tra kết nối
+	SocketMessageTypeEditMessage   SocketMessageType = "EDIT_MESSAGE"   // Sửa nội dung tin nhắn đã gửi
+	SocketMessageTypeDeleteMessage SocketMessageType = "DELETE_MESSAGE" // Xóa phía tôi hoặc thu hồi tin nhắn
+	SocketMessageTypeReact         SocketMessageType = "REACT"          // Thả reaction vào tin nhắn
+	SocketMessageTypeUnreact       SocketMessageType = "UNREACT"        // Gỡ reaction khỏi tin nhắn
+	SocketMessageTypeResume        SocketMessageType = "RESUME"         // Yêu cầu replay tin nhắn bị lỡ từ seq cuối đã thấy
+	SocketMessageTypeSetStatus     SocketMessageType = "SET_STATUS"     // Đặt trạng thái away/dnd/invisible và custom text
 
 	// Tin nhắn từ server
-	SocketMessageTypeNewMessage  SocketMessageType = "NEW_MESSAGE"  // Tin nhắn chat mới (có thể dùng CHAT, nhưng NEW_MESSAGE rõ hơn cho server -> client)
-	SocketMessageTypeUsers       SocketMessageType = "USERS"        // Danh sách người dùng
-	SocketMessageTypeJoinSuccess SocketMessageType = "JOIN_SUCCESS" // Tham gia phòng thành công
-	SocketMessageTypeJoinError   SocketMessageType = "JOIN_ERROR"   // Lỗi khi tham gia phòng
-	SocketMessageTypeUserJoined  SocketMessageType = "USER_JOINED"  // Thông báo người dùng khác tham gia
-	SocketMessageTypeUserLeft    SocketMessageType = "USER_LEFT"    // Thông báo người dùng khác rời đi
-	SocketMessageTypeError       SocketMessageType = "ERROR"        // Thông báo lỗi
-	SocketMessageTypePong        SocketMessageType = "PONG"         // Tin nhắn pong để phản hồi ping
+	SocketMessageTypeNewMessage      SocketMessageType = "NEW_MESSAGE"      // Tin nhắn chat mới (có thể dùng CHAT, nhưng NEW_MESSAGE rõ hơn cho server -> client)
+	SocketMessageTypeUsers           SocketMessageType = "USERS"            // Danh sách người dùng
+	SocketMessageTypeJoinSuccess     SocketMessageType = "JOIN_SUCCESS"     // Tham gia phòng thành công
+	SocketMessageTypeJoinError       SocketMessageType = "JOIN_ERROR"       // Lỗi khi tham gia phòng
+	SocketMessageTypeUserJoined      SocketMessageType = "USER_JOINED"      // Thông báo người dùng khác tham gia
+	SocketMessageTypeUserLeft        SocketMessageType = "USER_LEFT"        // Thông báo người dùng khác rời đi
+	SocketMessageTypeError           SocketMessageType = "ERROR"            // Thông báo lỗi
+	SocketMessageTypePong            SocketMessageType = "PONG"             // Tin nhắn pong để phản hồi ping
+	SocketMessageTypeMessageEdited   SocketMessageType = "MESSAGE_EDITED"   // Tin nhắn đã được sửa
+	SocketMessageTypeMessageDeleted  SocketMessageType = "MESSAGE_DELETED"  // Tin nhắn đã bị xóa/thu hồi
+	SocketMessageTypeReactionUpdated SocketMessageType = "REACTION_UPDATED" // Reaction của tin nhắn thay đổi
+	SocketMessageTypeMessageAck      SocketMessageType = "MESSAGE_ACK"      // Tin nhắn của người gửi đã được lưu
+	SocketMessageTypeMessageNack     SocketMessageType = "MESSAGE_NACK"     // Tin nhắn của người gửi bị từ chối
+	SocketMessageTypeResumed         SocketMessageType = "RESUMED"          // Đã replay xong một phòng
+	SocketMessageTypePresence        SocketMessageType = "PRESENCE"         // Trạng thái hiển thị của bạn bè thay đổi
+	SocketMessageTypeStatusUpdated   SocketMessageType = "STATUS_UPDATED"   // Trạng thái của chính user đã được cập nhật
+	SocketMessageTypeConnected       SocketMessageType = "CONNECTED"        // Stream SSE đã mở, kèm ConnID cho các REST endpoint
+	SocketMessageTypeReconnect       SocketMessageType = "RECONNECT"        // Server sắp đóng kết nối, client chờ delay_ms rồi kết nối lại
+	SocketMessageTypeResyncRequired  SocketMessageType = "RESYNC_REQUIRED"  // Server có thể đã lỡ sự kiện, client gửi RESUME cho các phòng đang theo dõi
 )
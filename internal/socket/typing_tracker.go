@@ -0,0 +1,203 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"gochat-backend/internal/infra/kafkainfra"
+	"log"
+	"sync"
+	"time"
+)
+
+// Lý do typing bị dừng tự động, gửi kèm trong TypingPayload.Reason
+const (
+	TypingStopReasonExpired      = "expired"
+	TypingStopReasonMessageSent  = "message_sent"
+	TypingStopReasonDisconnected = "disconnected"
+)
+
+const typingSweepInterval = time.Second
+
+type typingKey struct {
+	ChatRoomID string
+	UserID     string
+}
+
+type typingEntry struct {
+	expiresAt time.Time
+	connID    string // Kết nối gửi TYPING gần nhất, rỗng nếu trạng thái đến từ instance khác
+}
+
+// typingTracker lưu trạng thái typing theo (room, user) với TTL. Client phải gửi lại
+// TYPING is_typing=true định kỳ khi vẫn đang nhập, nếu không trạng thái sẽ hết hạn.
+//
+// Instance nhận TYPING từ client là chủ của trạng thái: khi hết hạn, instance đó publish
+// TypingStopped qua event bus cho mọi instance. Các instance khác cũng tự hết hạn trạng thái
+// đã thấy qua event bus (với thời gian dài hơn) để không kẹt "đang nhập" nếu instance chủ chết.
+type typingTracker struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	remoteTTL time.Duration
+	local     map[typingKey]*typingEntry
+	remote    map[typingKey]time.Time
+}
+
+func newTypingTracker(ttl time.Duration) *typingTracker {
+	return &typingTracker{
+		ttl:       ttl,
+		remoteTTL: 2 * ttl,
+		local:     make(map[typingKey]*typingEntry),
+		remote:    make(map[typingKey]time.Time),
+	}
+}
+
+// start ghi nhận user đang nhập từ một kết nối trên instance này, gia hạn TTL nếu đã có
+func (t *typingTracker) start(key typingKey, connID string, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.local[key] = &typingEntry{expiresAt: now.Add(t.ttl), connID: connID}
+}
+
+// stop xóa trạng thái typing cục bộ, trả về true nếu user đang nhập
+func (t *typingTracker) stop(key typingKey) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	_, existed := t.local[key]
+	delete(t.local, key)
+	return existed
+}
+
+// stopConnection xóa mọi trạng thái typing do kết nối connID tạo ra
+func (t *typingTracker) stopConnection(userID, connID string) []typingKey {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var stopped []typingKey
+	for key, entry := range t.local {
+		if key.UserID == userID && entry.connID == connID {
+			delete(t.local, key)
+			stopped = append(stopped, key)
+		}
+	}
+	return stopped
+}
+
+// observe ghi nhận sự kiện typing nhận từ event bus
+func (t *typingTracker) observe(key typingKey, isTyping bool, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !isTyping {
+		delete(t.remote, key)
+		return
+	}
+	// Trạng thái do chính instance này sở hữu thì đã có TTL cục bộ
+	if _, isLocal := t.local[key]; isLocal {
+		return
+	}
+	t.remote[key] = now.Add(t.remoteTTL)
+}
+
+// expire lấy ra các trạng thái đã hết hạn, tách theo cục bộ và từ instance khác
+func (t *typingTracker) expire(now time.Time) (local []typingKey, remote []typingKey) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for key, entry := range t.local {
+		if now.After(entry.expiresAt) {
+			delete(t.local, key)
+			local = append(local, key)
+		}
+	}
+	for key, expiresAt := range t.remote {
+		if now.After(expiresAt) {
+			delete(t.remote, key)
+			remote = append(remote, key)
+		}
+	}
+	return local, remote
+}
+
+// runTypingSweeper định kỳ dừng các trạng thái typing đã hết hạn
+func (h *Hub) runTypingSweeper() {
+	ticker := time.NewTicker(typingSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		local, remote := h.typing.expire(now)
+
+		for _, key := range local {
+			h.publishTypingEvent(context.Background(), key, false, TypingStopReasonExpired)
+		}
+
+		// Instance chủ không gửi TypingStopped (có thể đã chết): chỉ báo cho client trên instance này
+		for _, key := range remote {
+			log.Printf("Hub: Typing state of user %s in room %s expired without stop event", key.UserID, key.ChatRoomID)
+			h.broadcastToActiveView(key.ChatRoomID, newTypingMessage(key, false, TypingStopReasonExpired), key.UserID)
+		}
+	}
+}
+
+// stopTyping dừng typing của user trong phòng (ví dụ khi user vừa gửi tin nhắn)
+func (h *Hub) stopTyping(ctx context.Context, chatRoomID, userID, reason string) {
+	key := typingKey{ChatRoomID: chatRoomID, UserID: userID}
+	if h.typing.stop(key) {
+		h.publishTypingEvent(ctx, key, false, reason)
+	}
+}
+
+// stopTypingForConnection dừng mọi trạng thái typing của một kết nối khi nó đóng
+func (h *Hub) stopTypingForConnection(client *Client) {
+	for _, key := range h.typing.stopConnection(client.ID, client.ConnID) {
+		h.publishTypingEvent(context.Background(), key, false, TypingStopReasonDisconnected)
+	}
+}
+
+// publishTypingEvent publish TypingStarted/TypingStopped để mọi instance fan-out tới active view
+func (h *Hub) publishTypingEvent(ctx context.Context, key typingKey, isTyping bool, reason string) {
+	payloadBytes, err := json.Marshal(TypingPayload{
+		UserID:     key.UserID,
+		ChatRoomID: key.ChatRoomID,
+		IsTyping:   isTyping,
+		Reason:     reason,
+	})
+	if err != nil {
+		log.Printf("Hub: Failed to marshal typing payload: %v", err)
+		return
+	}
+
+	eventType := kafkainfra.TypingStarted
+	if !isTyping {
+		eventType = kafkainfra.TypingStopped
+	}
+
+	if h.eventBus == nil {
+		log.Printf("Hub: Event bus is nil, typing event %s for room %s not published", eventType, key.ChatRoomID)
+		return
+	}
+
+	kafkaEvent := &kafkainfra.MQEvent{
+		EventType:  eventType,
+		ChatRoomID: key.ChatRoomID,
+		SenderID:   key.UserID,
+		Timestamp:  time.Now().UTC(),
+		Metadata:   payloadBytes,
+	}
+	if err := h.eventBus.PublishChatEvent(ctx, kafkaEvent); err != nil {
+		log.Printf("Hub: Failed to publish typing event to event bus: %v", err)
+	}
+}
+
+func newTypingMessage(key typingKey, isTyping bool, reason string) SocketMessage {
+	return SocketMessage{
+		Type:      SocketMessageTypeTyping,
+		SenderID:  key.UserID,
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Data: mustMarshal(TypingPayload{
+			UserID:     key.UserID,
+			ChatRoomID: key.ChatRoomID,
+			IsTyping:   isTyping,
+			Reason:     reason,
+		}),
+	}
+}
@@ -17,6 +17,8 @@ type AuthUseCase interface {
 	Login(ctx context.Context, input LoginInput) (*LoginOutput, error)
 	VerifyToken(ctx context.Context, token string) (*LoginOutput, error)
 	RefreshToken(ctx context.Context, refreshToken string) (*LoginOutput, error)
+	IssueWebSocketTicket(ctx context.Context, userID string, clientIP string) (*WebSocketTicketOutput, error)
+	RedeemWebSocketTicket(ctx context.Context, ticket string, clientIP string) (string, error)
 }
 
 type authUseCase struct {
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	webSocketTicketPrefix = "ws_ticket:"
+	webSocketTicketTTL    = 30 * time.Second
+	webSocketTicketBytes  = 32
+)
+
+var ErrInvalidWebSocketTicket = errors.New("invalid or expired websocket ticket")
+
+type WebSocketTicketOutput struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"` // Số giây ticket còn hiệu lực
+}
+
+// webSocketTicket là dữ liệu lưu trong Redis, ticket chỉ hợp lệ với đúng user và IP đã xin
+type webSocketTicket struct {
+	UserID   string `json:"user_id"`
+	ClientIP string `json:"client_ip"`
+}
+
+// IssueWebSocketTicket cấp ticket dùng một lần để mở kết nối WebSocket thay cho access token
+// trên query string (token dài hạn bị ghi lại trong log của proxy)
+func (a *authUseCase) IssueWebSocketTicket(ctx context.Context, userID string, clientIP string) (*WebSocketTicketOutput, error) {
+	buf := make([]byte, webSocketTicketBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate websocket ticket: %w", err)
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+
+	err := a.redisService.Set(ctx, webSocketTicketPrefix+ticket, webSocketTicket{
+		UserID:   userID,
+		ClientIP: clientIP,
+	}, webSocketTicketTTL)
+	if err != nil {
+		log.Printf("Error storing websocket ticket in Redis: %v\n", err)
+		return nil, fmt.Errorf("failed to store websocket ticket: %w", err)
+	}
+
+	return &WebSocketTicketOutput{
+		Ticket:    ticket,
+		ExpiresIn: int(webSocketTicketTTL.Seconds()),
+	}, nil
+}
+
+// RedeemWebSocketTicket dùng ticket và trả về userID. Ticket bị xóa ngay khi đọc nên
+// không dùng lại được, kể cả khi IP không khớp.
+func (a *authUseCase) RedeemWebSocketTicket(ctx context.Context, ticket string, clientIP string) (string, error) {
+	if ticket == "" {
+		return "", ErrInvalidWebSocketTicket
+	}
+
+	var stored webSocketTicket
+	if err := a.redisService.GetDel(ctx, webSocketTicketPrefix+ticket, &stored); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrInvalidWebSocketTicket
+		}
+		return "", fmt.Errorf("failed to redeem websocket ticket: %w", err)
+	}
+
+	if stored.ClientIP != clientIP {
+		log.Printf("WebSocket ticket of user %s used from %s, issued to %s\n", stored.UserID, clientIP, stored.ClientIP)
+		return "", ErrInvalidWebSocketTicket
+	}
+
+	return stored.UserID, nil
+}
@@ -0,0 +1,125 @@
+//go:build unit
+// +build unit
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	redisMocks "gochat-backend/internal/infra/redisinfra/mocks"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthUseCase_IssueWebSocketTicket(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("successful_ticket_issue", func(t *testing.T) {
+		mockRedisService := new(redisMocks.MockRedisService)
+		mockRedisService.On("Set", ctx, mock.MatchedBy(func(key string) bool {
+			return len(key) > len(webSocketTicketPrefix) && key[:len(webSocketTicketPrefix)] == webSocketTicketPrefix
+		}), webSocketTicket{UserID: "user-123", ClientIP: "10.0.0.1"}, webSocketTicketTTL).Return(nil)
+
+		authUseCase := &authUseCase{redisService: mockRedisService}
+
+		result, err := authUseCase.IssueWebSocketTicket(ctx, "user-123", "10.0.0.1")
+
+		require.NoError(t, err)
+		assert.NotEmpty(t, result.Ticket)
+		assert.Equal(t, 30, result.ExpiresIn)
+		mockRedisService.AssertExpectations(t)
+	})
+
+	t.Run("redis_error", func(t *testing.T) {
+		mockRedisService := new(redisMocks.MockRedisService)
+		mockRedisService.On("Set", ctx, mock.Anything, mock.Anything, webSocketTicketTTL).Return(errors.New("redis down"))
+
+		authUseCase := &authUseCase{redisService: mockRedisService}
+
+		result, err := authUseCase.IssueWebSocketTicket(ctx, "user-123", "10.0.0.1")
+
+		require.Error(t, err)
+		assert.Nil(t, result)
+		mockRedisService.AssertExpectations(t)
+	})
+}
+
+func TestAuthUseCase_RedeemWebSocketTicket(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		ticket         string
+		clientIP       string
+		setupMocks     func(*redisMocks.MockRedisService)
+		expectedUserID string
+		expectedError  error
+	}{
+		{
+			name:     "successful_redeem",
+			ticket:   "ticket-abc",
+			clientIP: "10.0.0.1",
+			setupMocks: func(redisSvc *redisMocks.MockRedisService) {
+				redisSvc.On("GetDel", ctx, "ws_ticket:ticket-abc", mock.AnythingOfType("*auth.webSocketTicket")).
+					Run(func(args mock.Arguments) {
+						*args.Get(2).(*webSocketTicket) = webSocketTicket{UserID: "user-123", ClientIP: "10.0.0.1"}
+					}).Return(nil)
+			},
+			expectedUserID: "user-123",
+		},
+		{
+			name:     "ticket_bound_to_other_ip",
+			ticket:   "ticket-abc",
+			clientIP: "10.0.0.2",
+			setupMocks: func(redisSvc *redisMocks.MockRedisService) {
+				redisSvc.On("GetDel", ctx, "ws_ticket:ticket-abc", mock.AnythingOfType("*auth.webSocketTicket")).
+					Run(func(args mock.Arguments) {
+						*args.Get(2).(*webSocketTicket) = webSocketTicket{UserID: "user-123", ClientIP: "10.0.0.1"}
+					}).Return(nil)
+			},
+			expectedError: ErrInvalidWebSocketTicket,
+		},
+		{
+			name:     "ticket_already_used_or_expired",
+			ticket:   "ticket-abc",
+			clientIP: "10.0.0.1",
+			setupMocks: func(redisSvc *redisMocks.MockRedisService) {
+				redisSvc.On("GetDel", ctx, "ws_ticket:ticket-abc", mock.Anything).Return(redis.Nil)
+			},
+			expectedError: ErrInvalidWebSocketTicket,
+		},
+		{
+			name:          "empty_ticket",
+			ticket:        "",
+			clientIP:      "10.0.0.1",
+			setupMocks:    func(redisSvc *redisMocks.MockRedisService) {},
+			expectedError: ErrInvalidWebSocketTicket,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRedisService := new(redisMocks.MockRedisService)
+			tt.setupMocks(mockRedisService)
+
+			authUseCase := &authUseCase{redisService: mockRedisService}
+
+			userID, err := authUseCase.RedeemWebSocketTicket(ctx, tt.ticket, tt.clientIP)
+
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				assert.Empty(t, userID)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedUserID, userID)
+			}
+
+			mockRedisService.AssertExpectations(t)
+		})
+	}
+}
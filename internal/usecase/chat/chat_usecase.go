@@ -2,15 +2,41 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"gochat-backend/config"
 	domain "gochat-backend/internal/domain/chat"
 	"gochat-backend/internal/infra/cloudinaryinfra"
+	"gochat-backend/internal/infra/eventbus"
+	"gochat-backend/internal/infra/kafkainfra"
 	"gochat-backend/internal/repository"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	ErrChatRoomNotFound      = errors.New("chat room not found")
+	ErrNotChatRoomMember     = errors.New("user is not a member of this chat room")
+	ErrMessageNotFound       = errors.New("message not found")
+	ErrNotMessageSender      = errors.New("only the original sender can modify this message")
+	ErrMessageDeleted        = errors.New("message has been deleted")
+	ErrEmptyContent          = errors.New("message content cannot be empty")
+	ErrInvalidDeleteMode     = errors.New("invalid delete mode: must be for_me or for_everyone")
+	ErrInvalidReaction       = errors.New("reaction emoji must be between 1 and 32 bytes")
+	ErrInvalidReplyTo        = errors.New("reply target must be a message in the same chat room")
+	ErrMessageNotSaved       = errors.New("could not save message")
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must be at most 64 bytes")
+)
+
+// MessageDeleteMode xác định phạm vi xóa một tin nhắn
+type MessageDeleteMode string
+
+const (
+	DeleteForMe       MessageDeleteMode = "for_me"       // Chỉ ẩn với người gọi
+	DeleteForEveryone MessageDeleteMode = "for_everyone" // Thu hồi với mọi người, để lại tombstone
+)
+
 type ChatRoomCreateInput struct {
 	Name    string   `json:"name"`
 	Type    string   `json:"type"` // "GROUP" or "PRIVATE"
@@ -25,6 +51,10 @@ type ChatRoomOutput struct {
 	MemberCount int                `json:"member_count"`
 	Members     []ChatMemberOutput `json:"members,omitempty"`
 	LastMessage *MessageOutput     `json:"last_message,omitempty"`
+
+	// Chỉ được điền bởi GetChatRooms, theo góc nhìn của user đang gọi
+	UnreadCount       int    `json:"unread_count"`
+	LastReadMessageID string `json:"last_read_message_id,omitempty"`
 }
 
 type ChatRoomMembersInput struct {
@@ -44,6 +74,10 @@ type MessageInput struct {
 	Content  string             `json:"content"`
 }
 
+type MessageEditInput struct {
+	Content string `json:"content"`
+}
+
 type MessageOutput struct {
 	ID         string             `json:"id"`
 	SenderID   string             `json:"sender_id"`
@@ -53,7 +87,85 @@ type MessageOutput struct {
 	MimeType   string             `json:"mime_type,omitempty"`
 	Content    string             `json:"content"`
 	CreatedAt  time.Time          `json:"created_at"`
+	EditedAt   *time.Time         `json:"edited_at,omitempty"`
+	IsDeleted  bool               `json:"is_deleted,omitempty"`
+	DeletedAt  *time.Time         `json:"deleted_at,omitempty"`
+	Reactions  []ReactionOutput   `json:"reactions,omitempty"`
 	ChatRoomID string             `json:"chat_room_id"`
+
+	ReplyToMessageID string                `json:"reply_to_message_id,omitempty"`
+	ReplyTo          *MessagePreviewOutput `json:"reply_to,omitempty"`
+	ReplyCount       int                   `json:"reply_count"`
+	Seq              int64                 `json:"seq"`
+}
+
+// MessagePreviewOutput là bản rút gọn của tin nhắn gốc hiển thị trong reply/quote
+type MessagePreviewOutput struct {
+	ID         string             `json:"id"`
+	SenderID   string             `json:"sender_id"`
+	SenderName string             `json:"sender_name"`
+	Type       domain.MessageType `json:"type"`
+	Snippet    string             `json:"snippet"`
+	IsDeleted  bool               `json:"is_deleted,omitempty"`
+}
+
+type ReactionOutput struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// ReactionUpdatedOutput mô tả một thay đổi reaction và tổng số reaction mới của tin nhắn.
+// ReactedByMe trong Reactions luôn false vì payload này được gửi chung cho cả phòng.
+type ReactionUpdatedOutput struct {
+	MessageID  string           `json:"message_id"`
+	ChatRoomID string           `json:"chat_room_id"`
+	UserID     string           `json:"user_id"`
+	Emoji      string           `json:"emoji"`
+	Added      bool             `json:"added"`
+	Reactions  []ReactionOutput `json:"reactions"`
+}
+
+// RoomEventReplayOutput là các sự kiện client bị lỡ trong một phòng (tin nhắn mới, sửa, thu hồi,
+// reaction, đã đọc) theo thứ tự seq, ở dạng sự kiện bus để được dựng frame như khi gửi realtime.
+// HasMore = true nghĩa là khoảng trống lớn hơn giới hạn replay, client cần tải lại qua REST.
+type RoomEventReplayOutput struct {
+	ChatRoomID string                `json:"chat_room_id"`
+	Events     []*kafkainfra.MQEvent `json:"events"`
+	LastSeq    int64                 `json:"last_seq"`
+	HasMore    bool                  `json:"has_more"`
+}
+
+// ReadReceiptOutput là vị trí đã đọc mới của một thành viên trong phòng
+type ReadReceiptOutput struct {
+	ChatRoomID string    `json:"chat_room_id"`
+	UserID     string    `json:"user_id"`
+	MessageID  string    `json:"message_id"`
+	ReadAt     time.Time `json:"read_at"`
+}
+
+type MessageDeletedOutput struct {
+	MessageID  string            `json:"message_id"`
+	ChatRoomID string            `json:"chat_room_id"`
+	Mode       MessageDeleteMode `json:"mode"`
+	DeletedBy  string            `json:"deleted_by"`
+	DeletedAt  time.Time         `json:"deleted_at"`
+}
+
+// MembershipChangedOutput là payload của sự kiện membership_changed, phát khi thành viên
+// phòng thay đổi để các instance cập nhật danh sách thành viên đã cache
+type MembershipChangedOutput struct {
+	ChatRoomID     string    `json:"chat_room_id"`
+	AddedUserIDs   []string  `json:"added_user_ids,omitempty"`
+	RemovedUserIDs []string  `json:"removed_user_ids,omitempty"`
+	RoomDeleted    bool      `json:"room_deleted,omitempty"`
+	ChangedBy      string    `json:"changed_by"`
+	ChangedAt      time.Time `json:"changed_at"`
+}
+
+// OutboxNotifier được báo mỗi khi có sự kiện mới ghi vào outbox (eventbus.OutboxRelay)
+type OutboxNotifier interface {
+	Notify()
 }
 
 type ChatUseCase interface {
@@ -65,24 +177,50 @@ type ChatUseCase interface {
 	GetChatRoomMessages(ctx context.Context, userID, chatRoomID string, page, limit int) ([]*MessageOutput, error)
 	LeaveChatRoom(ctx context.Context, userID, chatRoomID string) error
 	FindOrCreatePrivateChatRoom(ctx context.Context, currentUserID, otherUserID string) (*ChatRoomOutput, error)
+	SendMessage(ctx context.Context, userID, chatRoomID string, input SendMessageInput) (*MessageOutput, error)
+	EditMessage(ctx context.Context, userID, chatRoomID, messageID, content string) (*MessageOutput, error)
+	DeleteMessage(ctx context.Context, userID, chatRoomID, messageID string, mode MessageDeleteMode) (*MessageDeletedOutput, error)
+	ReactToMessage(ctx context.Context, userID, chatRoomID, messageID, emoji string) (*ReactionUpdatedOutput, error)
+	UnreactToMessage(ctx context.Context, userID, chatRoomID, messageID, emoji string) (*ReactionUpdatedOutput, error)
+	GetMessageThread(ctx context.Context, userID, chatRoomID, messageID string, page, limit int) ([]*MessageOutput, error)
+	GetReplyPreview(ctx context.Context, chatRoomID, replyToMessageID string) (*MessagePreviewOutput, error)
+	MarkMessageRead(ctx context.Context, userID, chatRoomID, messageID string) (*ReadReceiptOutput, error)
+	GetRoomEventsAfterSeq(ctx context.Context, userID, chatRoomID string, afterSeq int64, limit int) (*RoomEventReplayOutput, error)
 }
 
 type chatUseCase struct {
 	chatRoomRepository repository.ChatRoomRepository
 	messageRepository  repository.MessageRepository
 	accountRepository  repository.AccountRepository
+	reactionRepository repository.MessageReactionRepository
 	cloudinaryinfra    cloudinaryinfra.CloudinaryService
+	eventBus           eventbus.EventBus
+	outboxNotifier     OutboxNotifier
+	idempotencyWindow  time.Duration
 }
 
 func NewChatUseCase(
 	chatRoomRepository repository.ChatRoomRepository,
 	messageRepository repository.MessageRepository,
 	accountRepository repository.AccountRepository,
+	reactionRepository repository.MessageReactionRepository,
+	eventBus eventbus.EventBus,
+	outboxNotifier OutboxNotifier,
+	cfg *config.Environment,
 ) ChatUseCase {
+	idempotencyWindow := time.Duration(cfg.MessageIdempotencyWindowHours) * time.Hour
+	if idempotencyWindow <= 0 {
+		idempotencyWindow = defaultIdempotencyWindow
+	}
+
 	return &chatUseCase{
 		chatRoomRepository: chatRoomRepository,
 		messageRepository:  messageRepository,
 		accountRepository:  accountRepository,
+		reactionRepository: reactionRepository,
+		eventBus:           eventBus,
+		outboxNotifier:     outboxNotifier,
+		idempotencyWindow:  idempotencyWindow,
 	}
 }
 
@@ -194,6 +332,17 @@ func (c *chatUseCase) GetChatRooms(ctx context.Context, userID string, page, lim
 		return nil, fmt.Errorf("error finding chat rooms: %w", err)
 	}
 
+	// Vị trí đã đọc không được cache cùng danh sách phòng nên lấy riêng cho cả trang
+	chatRoomIDs := make([]string, 0, len(chatRooms))
+	for _, chatRoom := range chatRooms {
+		chatRoomIDs = append(chatRoomIDs, chatRoom.ID)
+	}
+
+	readStates, err := c.chatRoomRepository.FindReadStates(ctx, userID, chatRoomIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error finding read states: %w", err)
+	}
+
 	// Convert to output format
 	output := make([]*ChatRoomOutput, 0, len(chatRooms))
 	for _, chatRoom := range chatRooms {
@@ -201,6 +350,10 @@ func (c *chatUseCase) GetChatRooms(ctx context.Context, userID string, page, lim
 		if err != nil {
 			return nil, err
 		}
+		if state, ok := readStates[chatRoom.ID]; ok {
+			chatRoomOutput.UnreadCount = state.UnreadCount
+			chatRoomOutput.LastReadMessageID = state.LastReadMessageId
+		}
 		output = append(output, chatRoomOutput)
 	}
 
@@ -262,6 +415,18 @@ func (c *chatUseCase) AddChatRoomMembers(ctx context.Context, userID, chatRoomID
 
 	// Add members
 	now := time.Now().UTC()
+
+	// Thông báo cả khi dừng giữa chừng vì lỗi: các thành viên đã thêm vẫn nằm trong DB
+	var addedIDs []string
+	defer func() {
+		if len(addedIDs) > 0 {
+			c.publishMembershipChanged(ctx, userID, &MembershipChangedOutput{
+				ChatRoomID:   chatRoomID,
+				AddedUserIDs: addedIDs,
+			})
+		}
+	}()
+
 	for _, memberID := range memberIDs {
 		// Check if the user exists
 		account, err := c.accountRepository.FindById(ctx, memberID)
@@ -292,6 +457,7 @@ func (c *chatUseCase) AddChatRoomMembers(ctx context.Context, userID, chatRoomID
 		if err != nil {
 			return fmt.Errorf("error adding member %s to chat room: %w", memberID, err)
 		}
+		addedIDs = append(addedIDs, memberID)
 	}
 
 	return nil
@@ -330,6 +496,10 @@ func (c *chatUseCase) RemoveChatRoomMember(ctx context.Context, userID, chatRoom
 		return fmt.Errorf("error removing member from chat room: %w", err)
 	}
 
+	c.publishMembershipChanged(ctx, userID, &MembershipChangedOutput{
+		ChatRoomID:     chatRoomID,
+		RemovedUserIDs: []string{memberID},
+	})
 	return nil
 }
 
@@ -364,38 +534,51 @@ func (c *chatUseCase) GetChatRoomMessages(ctx context.Context, userID, chatRoomI
 	}
 
 	offset := (page - 1) * limit
-	messages, err := c.messageRepository.FindMessagesByChatRoomID(ctx, chatRoomID, limit, offset)
+	messages, err := c.messageRepository.FindMessagesByChatRoomID(ctx, chatRoomID, userID, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("error finding messages: %w", err)
 	}
 
-	// Convert to output format
+	return c.convertMessagesToOutput(ctx, messages, userID)
+}
+
+// convertMessagesToOutput chuyển một trang tin nhắn sang output, nạp reaction và
+// preview tin nhắn gốc theo lô để tránh N+1 query
+func (c *chatUseCase) convertMessagesToOutput(ctx context.Context, messages []*domain.Message, viewerID string) ([]*MessageOutput, error) {
+	messageIDs := make([]string, 0, len(messages))
+	parentIDs := make([]string, 0)
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+		if message.ReplyToMessageId != "" {
+			parentIDs = append(parentIDs, message.ReplyToMessageId)
+		}
+	}
+
+	reactions, err := c.reactionRepository.FindReactionSummaries(ctx, messageIDs, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding reactions: %w", err)
+	}
+
+	parents, err := c.messageRepository.FindMessagesByIDs(ctx, parentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error finding replied messages: %w", err)
+	}
+
 	output := make([]*MessageOutput, 0, len(messages))
 	for _, message := range messages {
-		// Get sender information
-		sender, err := c.accountRepository.FindById(ctx, message.SenderId)
+		messageOutput, err := c.convertMessageToOutput(ctx, message)
 		if err != nil {
-			return nil, fmt.Errorf("error finding sender: %w", err)
+			return nil, err
 		}
+		messageOutput.Reactions = convertReactionsToOutput(reactions[message.ID])
 
-		senderName := "Unknown User"
-		avatarURL := ""
-		if sender != nil {
-			senderName = sender.Name
-			avatarURL = sender.AvatarURL
+		if parent, ok := parents[message.ReplyToMessageId]; ok {
+			messageOutput.ReplyTo, err = c.convertMessageToPreview(ctx, parent)
+			if err != nil {
+				return nil, err
+			}
 		}
-
-		output = append(output, &MessageOutput{
-			ID:         message.ID,
-			SenderID:   message.SenderId,
-			SenderName: senderName,
-			AvatarURL:  avatarURL,
-			Type:       message.Type,
-			MimeType:   message.MimeType,
-			Content:    message.Content,
-			CreatedAt:  message.CreatedAt,
-			ChatRoomID: message.ChatRoomId,
-		})
+		output = append(output, messageOutput)
 	}
 
 	return output, nil
@@ -443,11 +626,30 @@ func (c *chatUseCase) LeaveChatRoom(ctx context.Context, userID, chatRoomID stri
 			return fmt.Errorf("error deleting chat room: %w", err)
 		}
 
+		c.publishMembershipChanged(ctx, userID, &MembershipChangedOutput{
+			ChatRoomID:  chatRoomID,
+			RoomDeleted: true,
+		})
 		return nil
 	}
 
 	// For group chats, just remove the user
-	return c.chatRoomRepository.RemoveChatRoomMember(ctx, chatRoomID, userID)
+	if err := c.chatRoomRepository.RemoveChatRoomMember(ctx, chatRoomID, userID); err != nil {
+		return err
+	}
+
+	c.publishMembershipChanged(ctx, userID, &MembershipChangedOutput{
+		ChatRoomID:     chatRoomID,
+		RemovedUserIDs: []string{userID},
+	})
+	return nil
+}
+
+// publishMembershipChanged báo cho mọi instance thành viên phòng đã thay đổi
+func (c *chatUseCase) publishMembershipChanged(ctx context.Context, changedBy string, output *MembershipChangedOutput) {
+	output.ChangedBy = changedBy
+	output.ChangedAt = time.Now().UTC()
+	c.publishChatEvent(ctx, kafkainfra.MembershipChanged, output.ChatRoomID, changedBy, output.ChangedAt, output)
 }
 
 // Cài đặt phương thức này
@@ -521,29 +723,9 @@ func (c *chatUseCase) convertChatRoomToOutput(ctx context.Context, chatRoom *dom
 	// Convert last message if exists
 	var lastMessageOutput *MessageOutput
 	if chatRoom.LastMessage != nil {
-		// Get sender information
-		sender, err := c.accountRepository.FindById(ctx, chatRoom.LastMessage.SenderId)
+		lastMessageOutput, err = c.convertMessageToOutput(ctx, chatRoom.LastMessage)
 		if err != nil {
-			return nil, fmt.Errorf("error finding sender: %w", err)
-		}
-
-		senderName := "Unknown User"
-		avatarURL := ""
-		if sender != nil {
-			senderName = sender.Name
-			avatarURL = sender.AvatarURL
-		}
-
-		lastMessageOutput = &MessageOutput{
-			ID:         chatRoom.LastMessage.ID,
-			SenderID:   chatRoom.LastMessage.SenderId,
-			SenderName: senderName,
-			AvatarURL:  avatarURL,
-			Type:       chatRoom.LastMessage.Type,
-			MimeType:   chatRoom.LastMessage.MimeType,
-			Content:    chatRoom.LastMessage.Content,
-			CreatedAt:  chatRoom.LastMessage.CreatedAt,
-			ChatRoomID: chatRoom.LastMessage.ChatRoomId,
+			return nil, err
 		}
 	}
 
@@ -557,3 +739,46 @@ func (c *chatUseCase) convertChatRoomToOutput(ctx context.Context, chatRoom *dom
 		LastMessage: lastMessageOutput,
 	}, nil
 }
+
+// Helper function to convert domain.Message to MessageOutput
+func (c *chatUseCase) convertMessageToOutput(ctx context.Context, message *domain.Message) (*MessageOutput, error) {
+	// Get sender information
+	sender, err := c.accountRepository.FindById(ctx, message.SenderId)
+	if err != nil {
+		return nil, fmt.Errorf("error finding sender: %w", err)
+	}
+
+	senderName := "Unknown User"
+	avatarURL := ""
+	if sender != nil {
+		senderName = sender.Name
+		avatarURL = sender.AvatarURL
+	}
+
+	output := &MessageOutput{
+		ID:         message.ID,
+		SenderID:   message.SenderId,
+		SenderName: senderName,
+		AvatarURL:  avatarURL,
+		Type:       message.Type,
+		MimeType:   message.MimeType,
+		Content:    message.Content,
+		CreatedAt:  message.CreatedAt,
+		EditedAt:   message.EditedAt,
+		ChatRoomID: message.ChatRoomId,
+
+		ReplyToMessageID: message.ReplyToMessageId,
+		ReplyCount:       message.ReplyCount,
+		Seq:              message.Seq,
+	}
+
+	// Tin nhắn đã thu hồi chỉ trả về tombstone, không kèm nội dung
+	if message.DeletedAt != nil {
+		output.IsDeleted = true
+		output.DeletedAt = message.DeletedAt
+		output.Content = ""
+		output.MimeType = ""
+	}
+
+	return output, nil
+}
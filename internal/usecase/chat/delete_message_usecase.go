@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+	"time"
+)
+
+// DeleteMessage xóa một tin nhắn theo hai chế độ:
+//   - DeleteForMe: chỉ ẩn tin nhắn với người gọi, bất kỳ thành viên nào cũng dùng được
+//   - DeleteForEveryone: thu hồi tin nhắn, chỉ người gửi được phép, nội dung bị xóa và để lại tombstone
+//
+// Cả hai chế độ đều publish sự kiện MessageDeleted để các thiết bị liên quan cập nhật realtime;
+// chỉ thu hồi mới được cấp seq trong phòng.
+func (c *chatUseCase) DeleteMessage(ctx context.Context, userID, chatRoomID, messageID string, mode MessageDeleteMode) (*MessageDeletedOutput, error) {
+	if mode != DeleteForMe && mode != DeleteForEveryone {
+		return nil, ErrInvalidDeleteMode
+	}
+
+	if err := c.ensureChatRoomMember(ctx, userID, chatRoomID); err != nil {
+		return nil, err
+	}
+
+	message, err := c.messageRepository.FindMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding message: %w", err)
+	}
+
+	if message == nil || message.ChatRoomId != chatRoomID {
+		return nil, ErrMessageNotFound
+	}
+
+	deletedAt := time.Now().UTC()
+	var roomEvent *domain.RoomEvent
+
+	switch mode {
+	case DeleteForMe:
+		if err := c.messageRepository.HideMessageForUser(ctx, messageID, userID, deletedAt); err != nil {
+			return nil, fmt.Errorf("error hiding message: %w", err)
+		}
+	case DeleteForEveryone:
+		if message.SenderId != userID {
+			return nil, ErrNotMessageSender
+		}
+
+		if message.DeletedAt != nil {
+			return nil, ErrMessageDeleted
+		}
+
+		roomEvent = &domain.RoomEvent{
+			ChatRoomId: chatRoomID,
+			EventType:  domain.RoomEventMessageDeleted,
+			MessageId:  messageID,
+			ActorId:    userID,
+			CreatedAt:  deletedAt,
+		}
+		if err := c.messageRepository.SoftDeleteMessage(ctx, messageID, deletedAt, roomEvent); err != nil {
+			return nil, fmt.Errorf("error deleting message: %w", err)
+		}
+
+		c.chatRoomRepository.UpdateLastMessage(ctx, chatRoomID, message)
+	}
+
+	output := &MessageDeletedOutput{
+		MessageID:  messageID,
+		ChatRoomID: chatRoomID,
+		Mode:       mode,
+		DeletedBy:  userID,
+		DeletedAt:  deletedAt,
+	}
+
+	// "Xóa phía tôi" không thay đổi phòng nên không có seq
+	if roomEvent != nil {
+		c.publishRoomEvent(ctx, kafkainfra.MessageDeleted, roomEvent, output)
+	} else {
+		c.publishChatEvent(ctx, kafkainfra.MessageDeleted, chatRoomID, userID, deletedAt, output)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+	"log"
+	"strings"
+	"time"
+)
+
+// EditMessage cho phép người gửi sửa nội dung tin nhắn của mình.
+// Nội dung cũ được lưu vào lịch sử chỉnh sửa, lần sửa được cấp seq trong phòng và sự kiện
+// MessageEdited được publish để mọi hub instance đẩy bản cập nhật tới thành viên phòng.
+func (c *chatUseCase) EditMessage(ctx context.Context, userID, chatRoomID, messageID, content string) (*MessageOutput, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, ErrEmptyContent
+	}
+
+	if err := c.ensureChatRoomMember(ctx, userID, chatRoomID); err != nil {
+		return nil, err
+	}
+
+	message, err := c.messageRepository.FindMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding message: %w", err)
+	}
+
+	if message == nil || message.ChatRoomId != chatRoomID {
+		return nil, ErrMessageNotFound
+	}
+
+	if message.SenderId != userID {
+		return nil, ErrNotMessageSender
+	}
+
+	if message.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	editedAt := time.Now().UTC()
+	roomEvent := &domain.RoomEvent{
+		ChatRoomId: chatRoomID,
+		EventType:  domain.RoomEventMessageEdited,
+		MessageId:  messageID,
+		ActorId:    userID,
+		CreatedAt:  editedAt,
+	}
+	if err := c.messageRepository.UpdateMessageContent(ctx, messageID, userID, content, editedAt, roomEvent); err != nil {
+		return nil, fmt.Errorf("error updating message: %w", err)
+	}
+
+	message.Content = content
+	message.EditedAt = &editedAt
+
+	output, err := c.convertMessageToOutput(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	c.publishRoomEvent(ctx, kafkainfra.MessageEdited, roomEvent, output)
+
+	return output, nil
+}
+
+// ensureChatRoomMember kiểm tra phòng tồn tại và user là thành viên của phòng
+func (c *chatUseCase) ensureChatRoomMember(ctx context.Context, userID, chatRoomID string) error {
+	chatRoom, err := c.chatRoomRepository.FindChatRoomByID(ctx, chatRoomID)
+	if err != nil {
+		return fmt.Errorf("error finding chat room: %w", err)
+	}
+
+	if chatRoom == nil {
+		return ErrChatRoomNotFound
+	}
+
+	isMember, err := c.chatRoomRepository.IsUserMemberOfChatRoom(ctx, userID, chatRoomID)
+	if err != nil {
+		return fmt.Errorf("error checking chat room membership: %w", err)
+	}
+
+	if !isMember {
+		return ErrNotChatRoomMember
+	}
+
+	return nil
+}
+
+// publishChatEvent publish payload lên event bus dưới dạng Metadata của MQEvent.
+// Lỗi publish chỉ được log vì dữ liệu đã được lưu vào DB.
+func (c *chatUseCase) publishChatEvent(ctx context.Context, eventType kafkainfra.MQEventType, chatRoomID, senderID string, timestamp time.Time, payload any) {
+	c.publishEvent(ctx, eventType, chatRoomID, senderID, timestamp, 0, payload)
+}
+
+// publishRoomEvent publish sự kiện đã được ghi vào nhật ký của phòng, kèm seq của nó để
+// client phát hiện sự kiện bị lỡ
+func (c *chatUseCase) publishRoomEvent(ctx context.Context, eventType kafkainfra.MQEventType, roomEvent *domain.RoomEvent, payload any) {
+	c.publishEvent(ctx, eventType, roomEvent.ChatRoomId, roomEvent.ActorId, roomEvent.CreatedAt, roomEvent.Seq, payload)
+}
+
+func (c *chatUseCase) publishEvent(ctx context.Context, eventType kafkainfra.MQEventType, chatRoomID, senderID string, timestamp time.Time, seq int64, payload any) {
+	if c.eventBus == nil {
+		return
+	}
+
+	event, err := newChatEvent(eventType, chatRoomID, senderID, timestamp, payload)
+	if err != nil {
+		log.Printf("ChatUseCase: %v", err)
+		return
+	}
+	event.Seq = seq
+
+	if err := c.eventBus.PublishChatEvent(ctx, event); err != nil {
+		log.Printf("ChatUseCase: Failed to publish %s event: %v", eventType, err)
+	}
+}
+
+// newChatEvent đóng gói payload thành Metadata của MQEvent
+func newChatEvent(eventType kafkainfra.MQEventType, chatRoomID, senderID string, timestamp time.Time, payload any) (*kafkainfra.MQEvent, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", eventType, err)
+	}
+
+	return &kafkainfra.MQEvent{
+		EventType:  eventType,
+		ChatRoomID: chatRoomID,
+		SenderID:   senderID,
+		Timestamp:  timestamp,
+		Metadata:   payloadBytes,
+	}, nil
+}
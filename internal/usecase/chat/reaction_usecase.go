@@ -0,0 +1,129 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+	"strings"
+	"time"
+)
+
+const maxReactionEmojiLength = 32
+
+// ReactToMessage thêm reaction của user vào tin nhắn và publish số lượng reaction mới cho cả phòng
+func (c *chatUseCase) ReactToMessage(ctx context.Context, userID, chatRoomID, messageID, emoji string) (*ReactionUpdatedOutput, error) {
+	emoji, err := c.validateReaction(ctx, userID, chatRoomID, messageID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	reaction := &domain.MessageReaction{
+		MessageId: messageID,
+		UserId:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	roomEvent := newReactionRoomEvent(domain.RoomEventReactionAdded, userID, chatRoomID, messageID, emoji)
+	if err := c.reactionRepository.AddReaction(ctx, reaction, roomEvent); err != nil {
+		return nil, fmt.Errorf("error adding reaction: %w", err)
+	}
+
+	return c.publishReactionUpdate(ctx, kafkainfra.ReactionAdded, roomEvent)
+}
+
+// UnreactToMessage gỡ reaction của user khỏi tin nhắn và publish số lượng reaction mới cho cả phòng
+func (c *chatUseCase) UnreactToMessage(ctx context.Context, userID, chatRoomID, messageID, emoji string) (*ReactionUpdatedOutput, error) {
+	emoji, err := c.validateReaction(ctx, userID, chatRoomID, messageID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	roomEvent := newReactionRoomEvent(domain.RoomEventReactionRemoved, userID, chatRoomID, messageID, emoji)
+	if err := c.reactionRepository.RemoveReaction(ctx, messageID, userID, emoji, roomEvent); err != nil {
+		return nil, fmt.Errorf("error removing reaction: %w", err)
+	}
+
+	return c.publishReactionUpdate(ctx, kafkainfra.ReactionRemoved, roomEvent)
+}
+
+// validateReaction kiểm tra emoji, quyền thành viên và tin nhắn còn tồn tại, trả về emoji đã chuẩn hóa
+func (c *chatUseCase) validateReaction(ctx context.Context, userID, chatRoomID, messageID, emoji string) (string, error) {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" || len(emoji) > maxReactionEmojiLength {
+		return "", ErrInvalidReaction
+	}
+
+	if err := c.ensureChatRoomMember(ctx, userID, chatRoomID); err != nil {
+		return "", err
+	}
+
+	message, err := c.messageRepository.FindMessageByID(ctx, messageID)
+	if err != nil {
+		return "", fmt.Errorf("error finding message: %w", err)
+	}
+
+	if message == nil || message.ChatRoomId != chatRoomID {
+		return "", ErrMessageNotFound
+	}
+
+	if message.DeletedAt != nil {
+		return "", ErrMessageDeleted
+	}
+
+	return emoji, nil
+}
+
+func newReactionRoomEvent(eventType domain.RoomEventType, userID, chatRoomID, messageID, emoji string) *domain.RoomEvent {
+	return &domain.RoomEvent{
+		ChatRoomId: chatRoomID,
+		EventType:  eventType,
+		MessageId:  messageID,
+		ActorId:    userID,
+		Emoji:      emoji,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+func (c *chatUseCase) publishReactionUpdate(ctx context.Context, eventType kafkainfra.MQEventType, roomEvent *domain.RoomEvent) (*ReactionUpdatedOutput, error) {
+	// Không truyền viewer vì payload được gửi chung cho mọi thành viên
+	summaries, err := c.reactionRepository.FindReactionSummaries(ctx, []string{roomEvent.MessageId}, "")
+	if err != nil {
+		return nil, fmt.Errorf("error counting reactions: %w", err)
+	}
+
+	output := reactionUpdatedOutput(roomEvent, summaries[roomEvent.MessageId])
+
+	c.publishRoomEvent(ctx, eventType, roomEvent, output)
+
+	return output, nil
+}
+
+// reactionUpdatedOutput dựng thay đổi reaction của roomEvent kèm tổng số reaction summaries
+func reactionUpdatedOutput(roomEvent *domain.RoomEvent, summaries []*domain.ReactionSummary) *ReactionUpdatedOutput {
+	return &ReactionUpdatedOutput{
+		MessageID:  roomEvent.MessageId,
+		ChatRoomID: roomEvent.ChatRoomId,
+		UserID:     roomEvent.ActorId,
+		Emoji:      roomEvent.Emoji,
+		Added:      roomEvent.EventType == domain.RoomEventReactionAdded,
+		Reactions:  convertReactionsToOutput(summaries),
+	}
+}
+
+func convertReactionsToOutput(summaries []*domain.ReactionSummary) []ReactionOutput {
+	if len(summaries) == 0 {
+		return nil
+	}
+
+	output := make([]ReactionOutput, 0, len(summaries))
+	for _, summary := range summaries {
+		output = append(output, ReactionOutput{
+			Emoji:       summary.Emoji,
+			Count:       summary.Count,
+			ReactedByMe: summary.ReactedByMe,
+		})
+	}
+	return output
+}
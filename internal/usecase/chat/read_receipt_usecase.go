@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+	"time"
+)
+
+// MarkMessageRead lưu vị trí đã đọc của user trong phòng tới messageID.
+// Chỉ khi vị trí thực sự tiến lên thì sự kiện MessageRead mới được cấp seq và publish để đồng bộ
+// các thiết bị khác của user và các thành viên còn lại.
+func (c *chatUseCase) MarkMessageRead(ctx context.Context, userID, chatRoomID, messageID string) (*ReadReceiptOutput, error) {
+	if err := c.ensureChatRoomMember(ctx, userID, chatRoomID); err != nil {
+		return nil, err
+	}
+
+	message, err := c.messageRepository.FindMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding message: %w", err)
+	}
+
+	if message == nil || message.ChatRoomId != chatRoomID {
+		return nil, ErrMessageNotFound
+	}
+
+	roomEvent := &domain.RoomEvent{
+		ChatRoomId: chatRoomID,
+		EventType:  domain.RoomEventMessageRead,
+		MessageId:  messageID,
+		ActorId:    userID,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	advanced, err := c.chatRoomRepository.UpdateLastReadMessage(ctx, chatRoomID, userID, messageID, message.CreatedAt, roomEvent)
+	if err != nil {
+		return nil, fmt.Errorf("error updating read position: %w", err)
+	}
+
+	output := readReceiptOutput(roomEvent)
+
+	if advanced {
+		c.publishRoomEvent(ctx, kafkainfra.MessageRead, roomEvent, output)
+	}
+
+	return output, nil
+}
+
+// readReceiptOutput dựng vị trí đã đọc từ sự kiện message_read của phòng
+func readReceiptOutput(roomEvent *domain.RoomEvent) *ReadReceiptOutput {
+	return &ReadReceiptOutput{
+		ChatRoomID: roomEvent.ChatRoomId,
+		UserID:     roomEvent.ActorId,
+		MessageID:  roomEvent.MessageId,
+		ReadAt:     roomEvent.CreatedAt,
+	}
+}
@@ -0,0 +1,200 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+)
+
+// roomEventTypes ánh xạ loại sự kiện trong nhật ký phòng sang loại sự kiện publish realtime
+var roomEventTypes = map[domain.RoomEventType]kafkainfra.MQEventType{
+	domain.RoomEventMessageEdited:   kafkainfra.MessageEdited,
+	domain.RoomEventMessageDeleted:  kafkainfra.MessageDeleted,
+	domain.RoomEventReactionAdded:   kafkainfra.ReactionAdded,
+	domain.RoomEventReactionRemoved: kafkainfra.ReactionRemoved,
+	domain.RoomEventMessageRead:     kafkainfra.MessageRead,
+}
+
+// replayEntry là một mục trong khoảng seq cần replay: tin nhắn mới hoặc sự kiện trong nhật ký phòng
+type replayEntry struct {
+	message *domain.Message
+	event   *domain.RoomEvent
+}
+
+// GetRoomEventsAfterSeq trả về tối đa limit sự kiện có seq lớn hơn afterSeq: tin nhắn mới cùng
+// các lần sửa, thu hồi, reaction và đã đọc, ở dạng sự kiện giống hệt khi publish realtime.
+// Nội dung được dựng từ trạng thái hiện tại trong DB nên lần sửa của tin nhắn đã bị thu hồi
+// không được replay (sự kiện thu hồi phía sau đã thay nó).
+func (c *chatUseCase) GetRoomEventsAfterSeq(ctx context.Context, userID, chatRoomID string, afterSeq int64, limit int) (*RoomEventReplayOutput, error) {
+	if err := c.ensureChatRoomMember(ctx, userID, chatRoomID); err != nil {
+		return nil, err
+	}
+
+	if limit < 1 {
+		limit = 100 // default limit
+	}
+
+	lastSeq, err := c.chatRoomRepository.FindLastSeq(ctx, chatRoomID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding last sequence: %w", err)
+	}
+
+	// Lấy thừa một bản ghi ở mỗi nguồn để biết còn sự kiện sau giới hạn hay không
+	messages, err := c.messageRepository.FindMessagesAfterSeq(ctx, chatRoomID, userID, afterSeq, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error finding messages after sequence: %w", err)
+	}
+
+	roomEvents, err := c.messageRepository.FindRoomEventsAfterSeq(ctx, chatRoomID, afterSeq, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("error finding room events after sequence: %w", err)
+	}
+
+	entries := mergeReplayEntries(messages, roomEvents, limit+1)
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	events, err := c.buildReplayEvents(ctx, userID, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RoomEventReplayOutput{
+		ChatRoomID: chatRoomID,
+		Events:     events,
+		LastSeq:    lastSeq,
+		HasMore:    hasMore,
+	}, nil
+}
+
+// mergeReplayEntries trộn tin nhắn và sự kiện phòng (cả hai đã theo thứ tự seq), lấy tối đa limit mục
+func mergeReplayEntries(messages []*domain.Message, roomEvents []*domain.RoomEvent, limit int) []replayEntry {
+	entries := make([]replayEntry, 0, min(len(messages)+len(roomEvents), limit))
+	i, j := 0, 0
+	for len(entries) < limit && (i < len(messages) || j < len(roomEvents)) {
+		if j >= len(roomEvents) || (i < len(messages) && messages[i].Seq < roomEvents[j].Seq) {
+			entries = append(entries, replayEntry{message: messages[i]})
+			i++
+		} else {
+			entries = append(entries, replayEntry{event: roomEvents[j]})
+			j++
+		}
+	}
+	return entries
+}
+
+// buildReplayEvents dựng sự kiện bus cho từng mục theo góc nhìn của userID
+func (c *chatUseCase) buildReplayEvents(ctx context.Context, userID string, entries []replayEntry) ([]*kafkainfra.MQEvent, error) {
+	var newMessages []*domain.Message
+	var editedIDs, reactedIDs []string
+	for _, entry := range entries {
+		switch {
+		case entry.message != nil:
+			newMessages = append(newMessages, entry.message)
+		case entry.event.EventType == domain.RoomEventMessageEdited:
+			editedIDs = append(editedIDs, entry.event.MessageId)
+		case entry.event.EventType == domain.RoomEventReactionAdded, entry.event.EventType == domain.RoomEventReactionRemoved:
+			reactedIDs = append(reactedIDs, entry.event.MessageId)
+		}
+	}
+
+	messageOutputs, err := c.convertMessagesToOutput(ctx, newMessages, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	editedOutputs, err := c.findEditedMessageOutputs(ctx, userID, editedIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Không truyền viewer giống payload realtime gửi chung cho cả phòng
+	reactionSummaries, err := c.reactionRepository.FindReactionSummaries(ctx, reactedIDs, "")
+	if err != nil {
+		return nil, fmt.Errorf("error counting reactions: %w", err)
+	}
+
+	events := make([]*kafkainfra.MQEvent, 0, len(entries))
+	nextMessage := 0
+	for _, entry := range entries {
+		if entry.message != nil {
+			output := messageOutputs[nextMessage]
+			nextMessage++
+
+			event, err := newChatEvent(kafkainfra.MessageSent, output.ChatRoomID, output.SenderID, output.CreatedAt, output)
+			if err != nil {
+				return nil, err
+			}
+			event.Seq = output.Seq
+			events = append(events, event)
+			continue
+		}
+
+		roomEvent := entry.event
+		var payload any
+		switch roomEvent.EventType {
+		case domain.RoomEventMessageEdited:
+			output, ok := editedOutputs[roomEvent.MessageId]
+			if !ok {
+				continue
+			}
+			payload = output
+		case domain.RoomEventMessageDeleted:
+			payload = &MessageDeletedOutput{
+				MessageID:  roomEvent.MessageId,
+				ChatRoomID: roomEvent.ChatRoomId,
+				Mode:       DeleteForEveryone,
+				DeletedBy:  roomEvent.ActorId,
+				DeletedAt:  roomEvent.CreatedAt,
+			}
+		case domain.RoomEventReactionAdded, domain.RoomEventReactionRemoved:
+			payload = reactionUpdatedOutput(roomEvent, reactionSummaries[roomEvent.MessageId])
+		case domain.RoomEventMessageRead:
+			payload = readReceiptOutput(roomEvent)
+		default:
+			continue
+		}
+
+		event, err := newChatEvent(roomEventTypes[roomEvent.EventType], roomEvent.ChatRoomId, roomEvent.ActorId, roomEvent.CreatedAt, payload)
+		if err != nil {
+			return nil, err
+		}
+		event.Seq = roomEvent.Seq
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// findEditedMessageOutputs lấy nội dung hiện tại của các tin nhắn đã sửa, bỏ qua tin nhắn đã
+// bị xóa hoặc thu hồi để nội dung cũ không bị gửi lại
+func (c *chatUseCase) findEditedMessageOutputs(ctx context.Context, userID string, messageIDs []string) (map[string]*MessageOutput, error) {
+	result := make(map[string]*MessageOutput, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	found, err := c.messageRepository.FindMessagesByIDs(ctx, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error finding edited messages: %w", err)
+	}
+
+	edited := make([]*domain.Message, 0, len(found))
+	for _, message := range found {
+		if message.DeletedAt == nil {
+			edited = append(edited, message)
+		}
+	}
+
+	outputs, err := c.convertMessagesToOutput(ctx, edited, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, output := range outputs {
+		result[output.ID] = output
+	}
+	return result, nil
+}
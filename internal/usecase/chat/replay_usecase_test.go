@@ -0,0 +1,252 @@
+//go:build unit
+// +build unit
+
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// appendRoomEvent cấp seq từ cùng bộ đếm với tin nhắn rồi ghi event vào nhật ký phòng
+func (r *fakeMessageRepo) appendRoomEvent(event *domain.RoomEvent) {
+	if event == nil {
+		return
+	}
+	r.lastSeq[event.ChatRoomId]++
+	event.Seq = r.lastSeq[event.ChatRoomId]
+	stored := *event
+	r.roomEvents = append(r.roomEvents, &stored)
+}
+
+func (r *fakeMessageRepo) FindMessagesAfterSeq(ctx context.Context, chatRoomID, viewerID string, afterSeq int64, limit int) ([]*domain.Message, error) {
+	var messages []*domain.Message
+	for _, message := range r.messages {
+		if message.ChatRoomId == chatRoomID && message.Seq > afterSeq {
+			copied := *message
+			messages = append(messages, &copied)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Seq < messages[j].Seq })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (r *fakeMessageRepo) FindRoomEventsAfterSeq(ctx context.Context, chatRoomID string, afterSeq int64, limit int) ([]*domain.RoomEvent, error) {
+	var events []*domain.RoomEvent
+	for _, event := range r.roomEvents {
+		if event.ChatRoomId == chatRoomID && event.Seq > afterSeq && len(events) < limit {
+			copied := *event
+			events = append(events, &copied)
+		}
+	}
+	return events, nil
+}
+
+func (r *fakeMessageRepo) FindMessagesByIDs(ctx context.Context, messageIDs []string) (map[string]*domain.Message, error) {
+	result := make(map[string]*domain.Message, len(messageIDs))
+	for _, id := range messageIDs {
+		if message, ok := r.messages[id]; ok {
+			copied := *message
+			result[id] = &copied
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeMessageRepo) UpdateMessageContent(ctx context.Context, messageID, editorID, content string, editedAt time.Time, event *domain.RoomEvent) error {
+	r.messages[messageID].Content = content
+	r.messages[messageID].EditedAt = &editedAt
+	r.appendRoomEvent(event)
+	return nil
+}
+
+func (r *fakeMessageRepo) SoftDeleteMessage(ctx context.Context, messageID string, deletedAt time.Time, event *domain.RoomEvent) error {
+	r.messages[messageID].Content = ""
+	r.messages[messageID].DeletedAt = &deletedAt
+	r.appendRoomEvent(event)
+	return nil
+}
+
+func (r *fakeChatRoomRepo) FindLastSeq(ctx context.Context, chatRoomID string) (int64, error) {
+	return r.messageRepo.lastSeq[chatRoomID], nil
+}
+
+func (r *fakeChatRoomRepo) UpdateLastReadMessage(ctx context.Context, chatRoomID, userID, messageID string, messageCreatedAt time.Time, event *domain.RoomEvent) (bool, error) {
+	r.messageRepo.appendRoomEvent(event)
+	return true, nil
+}
+
+func (r *fakeChatRoomRepo) UpdateLastMessage(ctx context.Context, chatRoomID string, message *domain.Message) error {
+	return nil
+}
+
+// fakeReactionRepo lưu reaction trong bộ nhớ, ghi sự kiện vào nhật ký phòng của messageRepo
+type fakeReactionRepo struct {
+	repository.MessageReactionRepository
+	messageRepo *fakeMessageRepo
+	reactions   map[string]map[string]int // message ID -> emoji -> số lượng
+}
+
+func newFakeReactionRepo(messageRepo *fakeMessageRepo) *fakeReactionRepo {
+	return &fakeReactionRepo{messageRepo: messageRepo, reactions: make(map[string]map[string]int)}
+}
+
+func (r *fakeReactionRepo) AddReaction(ctx context.Context, reaction *domain.MessageReaction, event *domain.RoomEvent) error {
+	if r.reactions[reaction.MessageId] == nil {
+		r.reactions[reaction.MessageId] = make(map[string]int)
+	}
+	r.reactions[reaction.MessageId][reaction.Emoji]++
+	r.messageRepo.appendRoomEvent(event)
+	return nil
+}
+
+func (r *fakeReactionRepo) FindReactionSummaries(ctx context.Context, messageIDs []string, viewerID string) (map[string][]*domain.ReactionSummary, error) {
+	summaries := make(map[string][]*domain.ReactionSummary, len(messageIDs))
+	for _, id := range messageIDs {
+		for emoji, count := range r.reactions[id] {
+			summaries[id] = append(summaries[id], &domain.ReactionSummary{Emoji: emoji, Count: count})
+		}
+	}
+	return summaries, nil
+}
+
+func replaySeqs(events []*kafkainfra.MQEvent) []int64 {
+	seqs := make([]int64, 0, len(events))
+	for _, event := range events {
+		seqs = append(seqs, event.Seq)
+	}
+	return seqs
+}
+
+func replayTypes(events []*kafkainfra.MQEvent) []kafkainfra.MQEventType {
+	types := make([]kafkainfra.MQEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.EventType)
+	}
+	return types
+}
+
+func TestRoomEventsShareSeqWithMessages(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	bus := &countingBus{}
+	uc := newTestChatUseCase(messageRepo, bus, &countingNotifier{})
+	ctx := context.Background()
+
+	first, err := uc.SendMessage(ctx, "user-1", "room-1", SendMessageInput{Content: "hello"})
+	require.NoError(t, err)
+	second, err := uc.SendMessage(ctx, "user-2", "room-1", SendMessageInput{Content: "hi"})
+	require.NoError(t, err)
+
+	_, err = uc.EditMessage(ctx, "user-1", "room-1", first.ID, "hello there")
+	require.NoError(t, err)
+	_, err = uc.ReactToMessage(ctx, "user-1", "room-1", second.ID, "👍")
+	require.NoError(t, err)
+	_, err = uc.MarkMessageRead(ctx, "user-1", "room-1", second.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int64{1, 2}, []int64{first.Seq, second.Seq})
+	assert.Equal(t, int64(5), messageRepo.lastSeq["room-1"])
+
+	// Sự kiện realtime mang seq đã được cấp trong transaction
+	assert.Equal(t, []int64{3, 4, 5}, replaySeqs(bus.published))
+	assert.Equal(t, []kafkainfra.MQEventType{kafkainfra.MessageEdited, kafkainfra.ReactionAdded, kafkainfra.MessageRead}, replayTypes(bus.published))
+}
+
+func TestGetRoomEventsAfterSeqReplaysEveryEventInSeqOrder(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	uc := newTestChatUseCase(messageRepo, &countingBus{}, &countingNotifier{})
+	ctx := context.Background()
+
+	first, err := uc.SendMessage(ctx, "user-1", "room-1", SendMessageInput{Content: "hello"})
+	require.NoError(t, err)
+	second, err := uc.SendMessage(ctx, "user-2", "room-1", SendMessageInput{Content: "hi"})
+	require.NoError(t, err)
+	_, err = uc.EditMessage(ctx, "user-1", "room-1", first.ID, "hello there")
+	require.NoError(t, err)
+	_, err = uc.ReactToMessage(ctx, "user-1", "room-1", second.ID, "👍")
+	require.NoError(t, err)
+	_, err = uc.MarkMessageRead(ctx, "user-1", "room-1", second.ID)
+	require.NoError(t, err)
+
+	replay, err := uc.GetRoomEventsAfterSeq(ctx, "user-2", "room-1", 1, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), replay.LastSeq)
+	assert.False(t, replay.HasMore)
+	assert.Equal(t, []int64{2, 3, 4, 5}, replaySeqs(replay.Events))
+	assert.Equal(t, []kafkainfra.MQEventType{
+		kafkainfra.MessageSent,
+		kafkainfra.MessageEdited,
+		kafkainfra.ReactionAdded,
+		kafkainfra.MessageRead,
+	}, replayTypes(replay.Events))
+
+	var edited MessageOutput
+	require.NoError(t, json.Unmarshal(replay.Events[1].Metadata, &edited))
+	assert.Equal(t, first.ID, edited.ID)
+	assert.Equal(t, "hello there", edited.Content)
+
+	var reaction ReactionUpdatedOutput
+	require.NoError(t, json.Unmarshal(replay.Events[2].Metadata, &reaction))
+	assert.Equal(t, second.ID, reaction.MessageID)
+	assert.True(t, reaction.Added)
+	assert.Equal(t, []ReactionOutput{{Emoji: "👍", Count: 1}}, reaction.Reactions)
+
+	var receipt ReadReceiptOutput
+	require.NoError(t, json.Unmarshal(replay.Events[3].Metadata, &receipt))
+	assert.Equal(t, "user-1", receipt.UserID)
+	assert.Equal(t, second.ID, receipt.MessageID)
+}
+
+func TestGetRoomEventsAfterSeqDoesNotReplayEditsOfUnsentMessages(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	uc := newTestChatUseCase(messageRepo, &countingBus{}, &countingNotifier{})
+	ctx := context.Background()
+
+	message, err := uc.SendMessage(ctx, "user-1", "room-1", SendMessageInput{Content: "hello"})
+	require.NoError(t, err)
+	_, err = uc.EditMessage(ctx, "user-1", "room-1", message.ID, "secret")
+	require.NoError(t, err)
+	_, err = uc.DeleteMessage(ctx, "user-1", "room-1", message.ID, DeleteForEveryone)
+	require.NoError(t, err)
+
+	replay, err := uc.GetRoomEventsAfterSeq(ctx, "user-2", "room-1", 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 3}, replaySeqs(replay.Events))
+	assert.Equal(t, []kafkainfra.MQEventType{kafkainfra.MessageSent, kafkainfra.MessageDeleted}, replayTypes(replay.Events))
+
+	for _, event := range replay.Events {
+		assert.NotContains(t, string(event.Metadata), "secret")
+	}
+}
+
+func TestGetRoomEventsAfterSeqReportsHasMore(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	uc := newTestChatUseCase(messageRepo, &countingBus{}, &countingNotifier{})
+	ctx := context.Background()
+
+	message, err := uc.SendMessage(ctx, "user-1", "room-1", SendMessageInput{Content: "hello"})
+	require.NoError(t, err)
+	_, err = uc.ReactToMessage(ctx, "user-2", "room-1", message.ID, "👍")
+	require.NoError(t, err)
+	_, err = uc.SendMessage(ctx, "user-2", "room-1", SendMessageInput{Content: "hi"})
+	require.NoError(t, err)
+
+	replay, err := uc.GetRoomEventsAfterSeq(ctx, "user-1", "room-1", 0, 2)
+	require.NoError(t, err)
+	assert.True(t, replay.HasMore)
+	assert.Equal(t, int64(3), replay.LastSeq)
+	assert.Equal(t, []int64{1, 2}, replaySeqs(replay.Events))
+}
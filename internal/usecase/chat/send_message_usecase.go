@@ -0,0 +1,156 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/kafkainfra"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxIdempotencyKeyLength  = 64
+	defaultIdempotencyWindow = 24 * time.Hour
+)
+
+// SendMessageInput là tin nhắn mới gửi qua WebSocket, SSE hoặc REST
+type SendMessageInput struct {
+	Content  string `json:"content"`
+	MimeType string `json:"mime_type,omitempty"`
+	// ReplyToMessageID là tin nhắn được trích dẫn, phải cùng phòng
+	ReplyToMessageID string `json:"reply_to_message_id,omitempty"`
+	// IdempotencyKey do client tạo cho mỗi tin nhắn. Gửi lại cùng khóa vào cùng phòng trong
+	// thời gian hiệu lực sẽ nhận lại tin nhắn gốc thay vì tạo bản trùng
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// SendMessage lưu tin nhắn mới của user vào phòng, trả về tin nhắn đã lưu (kèm seq và
+// preview tin nhắn gốc nếu là reply). Sự kiện MessageSent được ghi vào outbox cùng transaction
+// với tin nhắn rồi outbox relay publish để mọi hub instance đẩy NEW_MESSAGE tới thành viên phòng.
+// Mọi transport gửi tin nhắn đều đi qua hàm này.
+// Nếu IdempotencyKey đã được dùng, trả về tin nhắn gốc và không publish lại.
+func (c *chatUseCase) SendMessage(ctx context.Context, userID, chatRoomID string, input SendMessageInput) (*MessageOutput, error) {
+	if strings.TrimSpace(input.Content) == "" {
+		return nil, ErrEmptyContent
+	}
+	if len(input.IdempotencyKey) > maxIdempotencyKeyLength {
+		return nil, ErrInvalidIdempotencyKey
+	}
+
+	if err := c.ensureChatRoomMember(ctx, userID, chatRoomID); err != nil {
+		return nil, err
+	}
+
+	// Nếu là reply, tin nhắn gốc phải nằm cùng phòng
+	var replyTo *MessagePreviewOutput
+	if input.ReplyToMessageID != "" {
+		preview, err := c.GetReplyPreview(ctx, chatRoomID, input.ReplyToMessageID)
+		if err != nil {
+			return nil, err
+		}
+		replyTo = preview
+	}
+
+	message := &domain.Message{
+		ID:               uuid.New().String(), // Server tạo ID cho message
+		SenderId:         userID,
+		ChatRoomId:       chatRoomID,
+		Type:             messageTypeFromMimeType(input.MimeType),
+		MimeType:         input.MimeType,
+		Content:          input.Content,
+		CreatedAt:        time.Now().UTC(),
+		ReplyToMessageId: input.ReplyToMessageID,
+	}
+
+	// Output được dựng trước khi lưu để sự kiện nằm trong transaction ghi tin nhắn,
+	// seq chỉ có khi tin nhắn được cấp seq trong transaction đó
+	output, err := c.convertMessageToOutput(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	output.ReplyTo = replyTo
+
+	buildEvent := func(saved *domain.Message) (*domain.OutboxEvent, error) {
+		output.Seq = saved.Seq
+		event, err := newChatEvent(kafkainfra.MessageSent, chatRoomID, userID, saved.CreatedAt, output)
+		if err != nil {
+			return nil, err
+		}
+		event.Seq = saved.Seq
+		return newOutboxEvent(event)
+	}
+
+	if input.IdempotencyKey != "" {
+		saved, created, err := c.messageRepository.CreateMessageWithIdempotencyKey(
+			ctx, message, input.IdempotencyKey, message.CreatedAt.Add(c.idempotencyWindow), buildEvent,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMessageNotSaved, err)
+		}
+		if !created {
+			// Client gửi lại tin nhắn đã lưu (retry khi mất ACK): trả về bản gốc
+			return c.existingMessageOutput(ctx, saved)
+		}
+	} else if err := c.messageRepository.CreateMessage(ctx, message, buildEvent); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMessageNotSaved, err)
+	}
+
+	if c.outboxNotifier != nil {
+		c.outboxNotifier.Notify()
+	}
+
+	return output, nil
+}
+
+// newOutboxEvent đóng gói MQEvent thành sự kiện outbox chờ relay publish
+func newOutboxEvent(event *kafkainfra.MQEvent) (*domain.OutboxEvent, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s event: %w", event.EventType, err)
+	}
+
+	return &domain.OutboxEvent{
+		EventType:  string(event.EventType),
+		ChatRoomId: event.ChatRoomID,
+		Payload:    payload,
+		CreatedAt:  event.Timestamp,
+	}, nil
+}
+
+// existingMessageOutput dựng output cho tin nhắn đã lưu từ lần gửi trước, kèm preview tin nhắn gốc nếu là reply
+func (c *chatUseCase) existingMessageOutput(ctx context.Context, message *domain.Message) (*MessageOutput, error) {
+	output, err := c.convertMessageToOutput(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.ReplyToMessageId != "" {
+		replyTo, err := c.GetReplyPreview(ctx, message.ChatRoomId, message.ReplyToMessageId)
+		if err != nil {
+			return nil, err
+		}
+		output.ReplyTo = replyTo
+	}
+
+	return output, nil
+}
+
+// messageTypeFromMimeType xác định loại tin nhắn theo MIME type, không có MIME type là TEXT
+func messageTypeFromMimeType(mimeType string) domain.MessageType {
+	switch {
+	case mimeType == "" || mimeType == "text/plain":
+		return domain.TextMessageType
+	case strings.HasPrefix(mimeType, "image/"):
+		return domain.ImageMessageType
+	case strings.HasPrefix(mimeType, "video/"):
+		return domain.VideoMessageType
+	case strings.HasPrefix(mimeType, "audio/"):
+		return domain.AudioMessageType
+	default:
+		return domain.FileMessageType
+	}
+}
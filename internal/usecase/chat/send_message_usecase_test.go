@@ -0,0 +1,315 @@
+//go:build unit
+// +build unit
+
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gochat-backend/config"
+	domainAuth "gochat-backend/internal/domain/auth"
+	domain "gochat-backend/internal/domain/chat"
+	"gochat-backend/internal/infra/eventbus"
+	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageTypeFromMimeType(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		expected domain.MessageType
+	}{
+		{name: "empty_mime_type", mimeType: "", expected: domain.TextMessageType},
+		{name: "plain_text", mimeType: "text/plain", expected: domain.TextMessageType},
+		{name: "image", mimeType: "image/png", expected: domain.ImageMessageType},
+		{name: "video", mimeType: "video/mp4", expected: domain.VideoMessageType},
+		{name: "audio", mimeType: "audio/mpeg", expected: domain.AudioMessageType},
+		{name: "document", mimeType: "application/pdf", expected: domain.FileMessageType},
+		{name: "other_text", mimeType: "text/html", expected: domain.FileMessageType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, messageTypeFromMimeType(tt.mimeType))
+		})
+	}
+}
+
+func TestNewOutboxEventRoundTrip(t *testing.T) {
+	sentAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	event, err := newChatEvent(kafkainfra.MessageSent, "room-1", "user-1", sentAt, &MessageOutput{
+		ID:         "message-1",
+		ChatRoomID: "room-1",
+		Content:    "hello",
+		Seq:        42,
+	})
+	require.NoError(t, err)
+
+	outboxEvent, err := newOutboxEvent(event)
+	require.NoError(t, err)
+	assert.Equal(t, string(kafkainfra.MessageSent), outboxEvent.EventType)
+	assert.Equal(t, "room-1", outboxEvent.ChatRoomId)
+	assert.Equal(t, sentAt, outboxEvent.CreatedAt)
+
+	// Relay giải mã payload thành MQEvent và publish nguyên vẹn
+	var decoded kafkainfra.MQEvent
+	require.NoError(t, json.Unmarshal(outboxEvent.Payload, &decoded))
+	assert.Equal(t, kafkainfra.MessageSent, decoded.EventType)
+	assert.Equal(t, "user-1", decoded.SenderID)
+	assert.True(t, sentAt.Equal(decoded.Timestamp))
+
+	var message MessageOutput
+	require.NoError(t, json.Unmarshal(decoded.Metadata, &message))
+	assert.Equal(t, "message-1", message.ID)
+	assert.Equal(t, int64(42), message.Seq)
+}
+
+// fakeChatRoomRepo coi mọi phòng là tồn tại và mọi user là thành viên, seq của phòng lấy từ messageRepo
+type fakeChatRoomRepo struct {
+	repository.ChatRoomRepository
+	messageRepo *fakeMessageRepo
+}
+
+func (r *fakeChatRoomRepo) FindChatRoomByID(ctx context.Context, chatRoomID string) (*domain.ChatRoom, error) {
+	return &domain.ChatRoom{ID: chatRoomID, Type: "GROUP"}, nil
+}
+
+func (r *fakeChatRoomRepo) IsUserMemberOfChatRoom(ctx context.Context, userID, chatRoomID string) (bool, error) {
+	return true, nil
+}
+
+type fakeAccountRepo struct {
+	repository.AccountRepository
+}
+
+func (r *fakeAccountRepo) FindById(ctx context.Context, id string) (*domainAuth.Account, error) {
+	return &domainAuth.Account{Id: id, Name: "User " + id}, nil
+}
+
+type idempotencyRecord struct {
+	messageID string
+	expiresAt time.Time
+}
+
+// fakeMessageRepo giả lập transaction của messageRepo: seq, message và sự kiện outbox chỉ
+// được lưu khi mọi bước trong "transaction" thành công
+type fakeMessageRepo struct {
+	repository.MessageRepository
+	messages     map[string]*domain.Message
+	roomEvents   []*domain.RoomEvent
+	outbox       []*domain.OutboxEvent
+	lastSeq      map[string]int64
+	keys         map[string]*idempotencyRecord
+	outboxErr    error // Lỗi khi ghi sự kiện outbox, transaction bị rollback
+	createdCount int
+}
+
+func newFakeMessageRepo() *fakeMessageRepo {
+	return &fakeMessageRepo{
+		messages: make(map[string]*domain.Message),
+		lastSeq:  make(map[string]int64),
+		keys:     make(map[string]*idempotencyRecord),
+	}
+}
+
+func (r *fakeMessageRepo) CreateMessage(ctx context.Context, message *domain.Message, buildEvent repository.OutboxEventBuilder) error {
+	return r.createInTransaction(message, buildEvent)
+}
+
+func (r *fakeMessageRepo) CreateMessageWithIdempotencyKey(
+	ctx context.Context,
+	message *domain.Message,
+	idempotencyKey string,
+	expiresAt time.Time,
+	buildEvent repository.OutboxEventBuilder,
+) (*domain.Message, bool, error) {
+	key := message.SenderId + "|" + message.ChatRoomId + "|" + idempotencyKey
+	if record, ok := r.keys[key]; ok && record.expiresAt.After(message.CreatedAt) {
+		original := *r.messages[record.messageID]
+		return &original, false, nil
+	}
+
+	if err := r.createInTransaction(message, buildEvent); err != nil {
+		return nil, false, err
+	}
+	r.keys[key] = &idempotencyRecord{messageID: message.ID, expiresAt: expiresAt}
+	return message, true, nil
+}
+
+func (r *fakeMessageRepo) FindMessageByID(ctx context.Context, messageID string) (*domain.Message, error) {
+	message, ok := r.messages[messageID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *message
+	return &copied, nil
+}
+
+func (r *fakeMessageRepo) createInTransaction(message *domain.Message, buildEvent repository.OutboxEventBuilder) error {
+	message.Seq = r.lastSeq[message.ChatRoomId] + 1
+
+	var event *domain.OutboxEvent
+	if buildEvent != nil {
+		var err error
+		if event, err = buildEvent(message); err != nil {
+			return err
+		}
+		if r.outboxErr != nil {
+			return r.outboxErr
+		}
+	}
+
+	// Commit
+	r.lastSeq[message.ChatRoomId] = message.Seq
+	stored := *message
+	r.messages[message.ID] = &stored
+	if event != nil {
+		r.outbox = append(r.outbox, event)
+	}
+	r.createdCount++
+	return nil
+}
+
+// countingBus đếm sự kiện được publish thẳng lên bus, không qua outbox
+type countingBus struct {
+	eventbus.EventBus
+	published []*kafkainfra.MQEvent
+}
+
+func (b *countingBus) PublishChatEvent(ctx context.Context, event *kafkainfra.MQEvent) error {
+	b.published = append(b.published, event)
+	return nil
+}
+
+type countingNotifier struct {
+	notified int
+}
+
+func (n *countingNotifier) Notify() {
+	n.notified++
+}
+
+func newTestChatUseCase(messageRepo *fakeMessageRepo, bus *countingBus, notifier *countingNotifier) ChatUseCase {
+	return NewChatUseCase(
+		&fakeChatRoomRepo{messageRepo: messageRepo},
+		messageRepo,
+		&fakeAccountRepo{},
+		newFakeReactionRepo(messageRepo),
+		bus,
+		notifier,
+		&config.Environment{MessageIdempotencyWindowHours: 24},
+	)
+}
+
+// decodeOutboxMessage giải mã sự kiện outbox như relay rồi lấy MessageOutput trong Metadata
+func decodeOutboxMessage(t *testing.T, event *domain.OutboxEvent) (*kafkainfra.MQEvent, *MessageOutput) {
+	var mqEvent kafkainfra.MQEvent
+	require.NoError(t, json.Unmarshal(event.Payload, &mqEvent))
+
+	var message MessageOutput
+	require.NoError(t, json.Unmarshal(mqEvent.Metadata, &message))
+	return &mqEvent, &message
+}
+
+func TestSendMessageWritesOutboxEventInMessageTransaction(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	bus := &countingBus{}
+	notifier := &countingNotifier{}
+	uc := newTestChatUseCase(messageRepo, bus, notifier)
+
+	output, err := uc.SendMessage(context.Background(), "user-1", "room-1", SendMessageInput{Content: "hello"})
+	require.NoError(t, err)
+
+	require.Len(t, messageRepo.messages, 1)
+	stored := messageRepo.messages[output.ID]
+	require.NotNil(t, stored)
+	assert.Equal(t, int64(1), stored.Seq)
+	assert.Equal(t, stored.Seq, output.Seq)
+
+	// Sự kiện chỉ đi qua outbox, relay được đánh thức để publish
+	require.Len(t, messageRepo.outbox, 1)
+	assert.Empty(t, bus.published)
+	assert.Equal(t, 1, notifier.notified)
+
+	outboxEvent := messageRepo.outbox[0]
+	assert.Equal(t, string(kafkainfra.MessageSent), outboxEvent.EventType)
+	assert.Equal(t, "room-1", outboxEvent.ChatRoomId)
+
+	mqEvent, message := decodeOutboxMessage(t, outboxEvent)
+	assert.Equal(t, kafkainfra.MessageSent, mqEvent.EventType)
+	assert.Equal(t, "user-1", mqEvent.SenderID)
+	assert.Equal(t, output.ID, message.ID)
+	assert.Equal(t, stored.Seq, message.Seq, "outbox payload must carry the seq assigned inside the transaction")
+	assert.Equal(t, "hello", message.Content)
+}
+
+func TestSendMessageRollsBackWhenOutboxEventFails(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	messageRepo.outboxErr = errors.New("outbox insert failed")
+	bus := &countingBus{}
+	notifier := &countingNotifier{}
+	uc := newTestChatUseCase(messageRepo, bus, notifier)
+
+	output, err := uc.SendMessage(context.Background(), "user-1", "room-1", SendMessageInput{Content: "hello"})
+	require.ErrorIs(t, err, ErrMessageNotSaved)
+	assert.Nil(t, output)
+
+	assert.Empty(t, messageRepo.messages)
+	assert.Empty(t, messageRepo.outbox)
+	assert.Equal(t, int64(0), messageRepo.lastSeq["room-1"])
+	assert.Empty(t, bus.published)
+	assert.Zero(t, notifier.notified)
+}
+
+func TestSendMessageWithSameIdempotencyKeyDoesNotRepublish(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	bus := &countingBus{}
+	notifier := &countingNotifier{}
+	uc := newTestChatUseCase(messageRepo, bus, notifier)
+	input := SendMessageInput{Content: "hello", IdempotencyKey: "key-1"}
+
+	first, err := uc.SendMessage(context.Background(), "user-1", "room-1", input)
+	require.NoError(t, err)
+	retry, err := uc.SendMessage(context.Background(), "user-1", "room-1", input)
+	require.NoError(t, err)
+
+	assert.Equal(t, first.ID, retry.ID)
+	assert.Equal(t, first.Seq, retry.Seq)
+	assert.Equal(t, "hello", retry.Content)
+
+	// Lần gửi lại trả về bản gốc, không ghi thêm tin nhắn hay sự kiện outbox
+	assert.Len(t, messageRepo.messages, 1)
+	assert.Len(t, messageRepo.outbox, 1)
+	assert.Empty(t, bus.published)
+	assert.Equal(t, 1, notifier.notified)
+}
+
+func TestSendMessageWithExpiredIdempotencyKeyCreatesNewMessage(t *testing.T) {
+	messageRepo := newFakeMessageRepo()
+	notifier := &countingNotifier{}
+	uc := newTestChatUseCase(messageRepo, &countingBus{}, notifier)
+	input := SendMessageInput{Content: "hello", IdempotencyKey: "key-1"}
+
+	first, err := uc.SendMessage(context.Background(), "user-1", "room-1", input)
+	require.NoError(t, err)
+
+	// Cho khóa hết hạn
+	messageRepo.keys["user-1|room-1|key-1"].expiresAt = time.Now().UTC().Add(-time.Minute)
+
+	second, err := uc.SendMessage(context.Background(), "user-1", "room-1", input)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, int64(2), second.Seq)
+	assert.Len(t, messageRepo.messages, 2)
+	assert.Len(t, messageRepo.outbox, 2)
+	assert.Equal(t, 2, notifier.notified)
+}
@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	domain "gochat-backend/internal/domain/chat"
+)
+
+// maxReplySnippetLength là số ký tự tối đa của nội dung tin nhắn gốc trong preview
+const maxReplySnippetLength = 100
+
+// GetMessageThread liệt kê các reply của một tin nhắn theo thứ tự thời gian
+func (c *chatUseCase) GetMessageThread(ctx context.Context, userID, chatRoomID, messageID string, page, limit int) ([]*MessageOutput, error) {
+	if err := c.ensureChatRoomMember(ctx, userID, chatRoomID); err != nil {
+		return nil, err
+	}
+
+	parent, err := c.messageRepository.FindMessageByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding message: %w", err)
+	}
+
+	if parent == nil || parent.ChatRoomId != chatRoomID {
+		return nil, ErrMessageNotFound
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20 // default limit
+	}
+
+	offset := (page - 1) * limit
+	replies, err := c.messageRepository.FindRepliesByMessageID(ctx, messageID, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error finding replies: %w", err)
+	}
+
+	return c.convertMessagesToOutput(ctx, replies, userID)
+}
+
+// GetReplyPreview kiểm tra tin nhắn được reply nằm cùng phòng và trả về preview của nó
+func (c *chatUseCase) GetReplyPreview(ctx context.Context, chatRoomID, replyToMessageID string) (*MessagePreviewOutput, error) {
+	parent, err := c.messageRepository.FindMessageByID(ctx, replyToMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("error finding replied message: %w", err)
+	}
+
+	if parent == nil || parent.ChatRoomId != chatRoomID {
+		return nil, ErrInvalidReplyTo
+	}
+
+	return c.convertMessageToPreview(ctx, parent)
+}
+
+// convertMessageToPreview rút gọn tin nhắn gốc; tin nhắn đã thu hồi không lộ nội dung
+func (c *chatUseCase) convertMessageToPreview(ctx context.Context, message *domain.Message) (*MessagePreviewOutput, error) {
+	sender, err := c.accountRepository.FindById(ctx, message.SenderId)
+	if err != nil {
+		return nil, fmt.Errorf("error finding sender: %w", err)
+	}
+
+	senderName := "Unknown User"
+	if sender != nil {
+		senderName = sender.Name
+	}
+
+	preview := &MessagePreviewOutput{
+		ID:         message.ID,
+		SenderID:   message.SenderId,
+		SenderName: senderName,
+		Type:       message.Type,
+	}
+
+	switch {
+	case message.DeletedAt != nil:
+		preview.IsDeleted = true
+	case message.Type == domain.TextMessageType:
+		preview.Snippet = truncateRunes(message.Content, maxReplySnippetLength)
+	}
+
+	return preview, nil
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "…"
+}
@@ -0,0 +1,95 @@
+package status
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxBatchStatusUserIDs giới hạn số user trong một lần tra cứu trạng thái
+const maxBatchStatusUserIDs = 500
+
+func (uc *statusUseCase) GetUserStatusForViewer(ctx context.Context, viewerID, userID string) (*UserStatusOutput, error) {
+	outputs, err := uc.GetUserStatusesForViewer(ctx, viewerID, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	// ID rỗng bị bỏ qua khi tra cứu nên không có kết quả nào
+	if len(outputs) == 0 {
+		return nil, ErrUserIDRequired
+	}
+	return outputs[0], nil
+}
+
+// GetUserStatusesForViewer đọc trạng thái của nhiều user bằng một MGET, giữ thứ tự và bỏ ID trùng
+func (uc *statusUseCase) GetUserStatusesForViewer(ctx context.Context, viewerID string, userIDs []string) ([]*UserStatusOutput, error) {
+	uniqueIDs := make([]string, 0, len(userIDs))
+	seen := make(map[string]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := seen[id]; ok || id == "" {
+			continue
+		}
+		seen[id] = struct{}{}
+		uniqueIDs = append(uniqueIDs, id)
+	}
+
+	if len(uniqueIDs) > maxBatchStatusUserIDs {
+		return nil, ErrTooManyUserIDs
+	}
+	if len(uniqueIDs) == 0 {
+		return []*UserStatusOutput{}, nil
+	}
+
+	statuses, presences, err := uc.statusRepo.FindUserStatuses(ctx, uniqueIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := uc.lastSeenVisibleTo(ctx, viewerID, uniqueIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]*UserStatusOutput, 0, len(uniqueIDs))
+	for _, userID := range uniqueIDs {
+		output := displayStatus(userID, statuses[userID], presences[userID])
+		if userID == viewerID && output.CustomText == "" {
+			// Custom text chỉ bị ẩn với người khác, user vẫn thấy text của chính mình
+			applyCustomText(output, presences[userID])
+		}
+		if _, ok := allowed[userID]; !ok {
+			output.RawLastSeen = 0
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// lastSeenVisibleTo trả về các user mà viewer được xem last-seen: chính viewer,
+// bạn bè của viewer và những người cùng ít nhất một phòng chat
+func (uc *statusUseCase) lastSeenVisibleTo(ctx context.Context, viewerID string, userIDs []string) (map[string]struct{}, error) {
+	allowed := map[string]struct{}{viewerID: {}}
+
+	friendIDs, err := uc.friendShipRepo.FindFriendIdsAmong(ctx, viewerID, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check friendships: %w", err)
+	}
+	for _, id := range friendIDs {
+		allowed[id] = struct{}{}
+	}
+
+	remaining := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := allowed[id]; !ok {
+			remaining = append(remaining, id)
+		}
+	}
+
+	coMemberIDs, err := uc.chatRoomRepo.FindUserIDsSharingRoom(ctx, viewerID, remaining)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check room membership: %w", err)
+	}
+	for _, id := range coMemberIDs {
+		allowed[id] = struct{}{}
+	}
+	return allowed, nil
+}
@@ -0,0 +1,123 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gochat-backend/internal/domain/status"
+	"gochat-backend/internal/infra/kafkainfra"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxCustomTextLength = 100
+
+// SetUserPresence lưu trạng thái user tự chọn và báo cho bạn bè
+func (uc *statusUseCase) SetUserPresence(ctx context.Context, userID string, input SetStatusInput) (*UserStatusOutput, error) {
+	switch input.Status {
+	case status.Online, status.Away, status.DoNotDisturb, status.Invisible:
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	customText := strings.TrimSpace(input.CustomText)
+	if utf8.RuneCountInString(customText) > maxCustomTextLength {
+		return nil, ErrCustomTextTooLong
+	}
+	if input.ExpiresInSeconds < 0 {
+		return nil, ErrInvalidStatusExpiry
+	}
+
+	now := time.Now().UTC()
+	if input.Status == status.Online && customText == "" {
+		// Không còn gì tự chọn: hiển thị theo kết nối thực tế
+		if err := uc.statusRepo.DeleteUserPresence(ctx, userID); err != nil {
+			return nil, err
+		}
+	} else {
+		presence := &status.UserPresence{
+			UserID:     userID,
+			Status:     input.Status,
+			CustomText: customText,
+			UpdatedAt:  now,
+		}
+		if customText != "" && input.ExpiresInSeconds > 0 {
+			expiresAt := now.Add(time.Duration(input.ExpiresInSeconds) * time.Second)
+			presence.CustomTextExpiresAt = &expiresAt
+		}
+		if err := uc.statusRepo.SetUserPresence(ctx, userID, presence); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := uc.PublishPresence(ctx, userID); err != nil {
+		return nil, err
+	}
+	return uc.GetOwnStatus(ctx, userID)
+}
+
+// PublishPresence publish trạng thái hiển thị hiện tại của user tới bạn bè và
+// thành viên các phòng chat riêng qua event bus
+func (uc *statusUseCase) PublishPresence(ctx context.Context, userID string) error {
+	if uc.eventBus == nil {
+		return nil
+	}
+
+	recipients, err := uc.presenceAudience(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	display, err := uc.GetUserDisplayStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := json.Marshal(PresenceChangedOutput{UserStatusOutput: *display, Recipients: recipients})
+	if err != nil {
+		return fmt.Errorf("failed to marshal presence payload: %w", err)
+	}
+
+	eventType := kafkainfra.UserStatusChanged
+	switch display.Status {
+	case status.Online:
+		eventType = kafkainfra.UserOnline
+	case status.Offline:
+		eventType = kafkainfra.UserOffline
+	}
+
+	return uc.eventBus.PublishChatEvent(ctx, &kafkainfra.MQEvent{
+		EventType: eventType,
+		SenderID:  userID,
+		Timestamp: time.Now().UTC(),
+		Metadata:  metadata,
+	})
+}
+
+// presenceAudience trả về bạn bè và thành viên các phòng chat riêng của user, không trùng lặp
+func (uc *statusUseCase) presenceAudience(ctx context.Context, userID string) ([]string, error) {
+	friendIDs, err := uc.friendShipRepo.FindFriendIdsByUserId(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find friends: %w", err)
+	}
+
+	partnerIDs, err := uc.chatRoomRepo.FindPrivateChatPartnerIDs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find private chat partners: %w", err)
+	}
+
+	seen := make(map[string]struct{}, len(friendIDs)+len(partnerIDs))
+	audience := make([]string, 0, len(friendIDs)+len(partnerIDs))
+	for _, id := range append(friendIDs, partnerIDs...) {
+		if _, ok := seen[id]; ok || id == userID {
+			continue
+		}
+		seen[id] = struct{}{}
+		audience = append(audience, id)
+	}
+	return audience, nil
+}
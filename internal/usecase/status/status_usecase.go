@@ -2,17 +2,56 @@ package status
 
 import (
 	"context"
+	"errors"
 	"gochat-backend/internal/domain/status"
 )
 
+var (
+	ErrInvalidStatus       = errors.New("invalid status")
+	ErrCustomTextTooLong   = errors.New("custom status text is too long")
+	ErrInvalidStatusExpiry = errors.New("invalid custom status expiry")
+	ErrTooManyUserIDs      = errors.New("too many user ids")
+	ErrUserIDRequired      = errors.New("user id is required")
+)
+
 type UserStatusOutput struct {
-	UserID      string                `json:"user_id"`
-	Status      status.UserStatusType `json:"status"`
-	RawLastSeen int64                 `json:"raw_last_seen_unix"` // Timestamp Unix để client tự tính toán nếu cần
+	UserID              string                `json:"user_id"`
+	Status              status.UserStatusType `json:"status"`
+	RawLastSeen         int64                 `json:"raw_last_seen_unix,omitempty"` // Timestamp Unix để client tự tính toán nếu cần, ẩn với người không quen
+	CustomText          string                `json:"custom_text,omitempty"`
+	CustomTextExpiresAt int64                 `json:"custom_text_expires_at_unix,omitempty"`
+}
+
+type BatchStatusInput struct {
+	UserIDs []string `json:"user_ids" binding:"required"`
+}
+
+// SetStatusInput là trạng thái user tự chọn. Status "online" nghĩa là bỏ trạng thái
+// tự chọn và hiển thị theo kết nối thực tế.
+type SetStatusInput struct {
+	Status           status.UserStatusType `json:"status" binding:"required" example:"dnd"`
+	CustomText       string                `json:"custom_text" example:"In a meeting"`
+	ExpiresInSeconds int                   `json:"expires_in_seconds" example:"3600"` // Custom text hết hạn sau N giây, 0 là không hết hạn
+}
+
+// PresenceChangedOutput là metadata của sự kiện presence trên event bus, kèm danh sách
+// người cần nhận để các instance không phải truy vấn lại DB
+type PresenceChangedOutput struct {
+	UserStatusOutput
+	Recipients []string `json:"recipients"`
 }
 
 type StatusUseCase interface {
 	SetUserOnline(ctx context.Context, userID string) error
 	SetUserOffline(ctx context.Context, userID string) error
+	SetUserIdle(ctx context.Context, userID string, idle bool) error
 	GetUserDisplayStatus(ctx context.Context, userID string) (*UserStatusOutput, error)
+	// GetUserStatusForViewer/GetUserStatusesForViewer chỉ trả last-seen nếu viewer là bạn
+	// hoặc cùng phòng chat với user
+	GetUserStatusForViewer(ctx context.Context, viewerID, userID string) (*UserStatusOutput, error)
+	GetUserStatusesForViewer(ctx context.Context, viewerID string, userIDs []string) ([]*UserStatusOutput, error)
+
+	SetUserPresence(ctx context.Context, userID string, input SetStatusInput) (*UserStatusOutput, error)
+	GetOwnStatus(ctx context.Context, userID string) (*UserStatusOutput, error)
+	PublishPresence(ctx context.Context, userID string) error
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"gochat-backend/config"
 	"gochat-backend/internal/domain/status"
+	"gochat-backend/internal/infra/eventbus"
 	"gochat-backend/internal/repository"
+	"log"
 	"time"
 )
 
@@ -13,14 +15,26 @@ const (
 )
 
 type statusUseCase struct {
-	statusRepo repository.StatusRepository
-	cfg        *config.Environment
+	statusRepo     repository.StatusRepository
+	friendShipRepo repository.FriendShipRepository
+	chatRoomRepo   repository.ChatRoomRepository
+	eventBus       eventbus.EventBus
+	cfg            *config.Environment
 }
 
-func NewStatusUseCase(repo repository.StatusRepository, cfg *config.Environment) StatusUseCase {
+func NewStatusUseCase(
+	repo repository.StatusRepository,
+	friendShipRepo repository.FriendShipRepository,
+	chatRoomRepo repository.ChatRoomRepository,
+	eventBus eventbus.EventBus,
+	cfg *config.Environment,
+) StatusUseCase {
 	return &statusUseCase{
-		statusRepo: repo,
-		cfg:        cfg,
+		statusRepo:     repo,
+		friendShipRepo: friendShipRepo,
+		chatRoomRepo:   chatRoomRepo,
+		eventBus:       eventBus,
+		cfg:            cfg,
 	}
 }
 
@@ -42,39 +56,109 @@ func (uc *statusUseCase) SetUserOffline(ctx context.Context, userID string) erro
 	return uc.statusRepo.SetUserStatus(ctx, userID, userStatus)
 }
 
+// SetUserIdle chuyển trạng thái kết nối giữa online và away khi mọi kết nối của user idle.
+// User đang offline thì giữ nguyên.
+func (uc *statusUseCase) SetUserIdle(ctx context.Context, userID string, idle bool) error {
+	userStatus, err := uc.statusRepo.GetUserStatus(ctx, userID)
+	if err != nil || userStatus.Status == status.Offline {
+		return nil
+	}
+
+	userStatus.Status = status.Online
+	if idle {
+		userStatus.Status = status.Away
+	}
+	userStatus.LastSeen = time.Now().UTC()
+	return uc.statusRepo.SetUserStatus(ctx, userID, userStatus)
+}
+
 func (uc *statusUseCase) GetUserDisplayStatus(ctx context.Context, userID string) (*UserStatusOutput, error) {
+	presence, err := uc.statusRepo.GetUserPresence(ctx, userID)
+	if err != nil {
+		log.Printf("StatusUseCase: Failed to get presence of user %s: %v", userID, err)
+		presence = nil
+	}
+
 	userStatus, err := uc.statusRepo.GetUserStatus(ctx, userID)
 	if err != nil {
-		// Coi như offline > 1 giờ
-		return &UserStatusOutput{
-			UserID:      userID,
-			Status:      status.Offline,
-			RawLastSeen: time.Now().UTC().Add(-(maxOfflineDisplayDuration + time.Minute)).Unix(), // Thời gian cũ
-		}, nil
+		userStatus = nil
+	}
+	return displayStatus(userID, userStatus, presence), nil
+}
+
+// GetOwnStatus trả về trạng thái user tự thấy, kể cả invisible
+func (uc *statusUseCase) GetOwnStatus(ctx context.Context, userID string) (*UserStatusOutput, error) {
+	presence, err := uc.statusRepo.GetUserPresence(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
-	if userStatus.Status == status.Online {
-		return &UserStatusOutput{
-			UserID:      userID,
-			Status:      status.Online,
-			RawLastSeen: userStatus.LastSeen.Unix(),
-		}, nil
+	userStatus, err := uc.statusRepo.GetUserStatus(ctx, userID)
+	if err != nil {
+		userStatus = nil
+	}
+
+	output := connectionStatus(userID, userStatus)
+	applyCustomText(output, presence)
+	if presence != nil && presence.Status != status.Online {
+		output.Status = presence.Status
 	}
+	return output, nil
+}
 
-	// User is Offline
-	timeOffline := time.Since(userStatus.LastSeen)
+// displayStatus tính trạng thái người khác nhìn thấy từ trạng thái kết nối và trạng thái tự chọn
+func displayStatus(userID string, userStatus *status.UserStatus, presence *status.UserPresence) *UserStatusOutput {
+	output := connectionStatus(userID, userStatus)
+	if presence == nil {
+		return output
+	}
 
-	if timeOffline > maxOfflineDisplayDuration {
+	// Invisible hiện offline với người khác, last seen là lúc user chuyển sang invisible.
+	// Custom text cũng bị ẩn vì nó cho thấy tài khoản vẫn đang được dùng.
+	if presence.Status == status.Invisible {
+		if output.Status != status.Offline {
+			output.Status = status.Offline
+			output.RawLastSeen = presence.UpdatedAt.Unix()
+		}
+		return output
+	}
+
+	applyCustomText(output, presence)
+	if output.Status == status.Offline {
+		return output
+	}
+
+	if presence.Status == status.Away || presence.Status == status.DoNotDisturb {
+		output.Status = presence.Status
+	}
+	return output
+}
+
+// connectionStatus chuyển trạng thái kết nối (online, away do idle, offline) thành output
+func connectionStatus(userID string, userStatus *status.UserStatus) *UserStatusOutput {
+	if userStatus == nil {
+		// Coi như offline > 1 giờ
 		return &UserStatusOutput{
 			UserID:      userID,
 			Status:      status.Offline,
-			RawLastSeen: userStatus.LastSeen.Unix(),
-		}, nil
+			RawLastSeen: time.Now().UTC().Add(-(maxOfflineDisplayDuration + time.Minute)).Unix(), // Thời gian cũ
+		}
 	}
 
 	return &UserStatusOutput{
 		UserID:      userID,
-		Status:      status.Offline,
+		Status:      userStatus.Status,
 		RawLastSeen: userStatus.LastSeen.Unix(),
-	}, nil
+	}
+}
+
+func applyCustomText(output *UserStatusOutput, presence *status.UserPresence) {
+	if presence == nil {
+		return
+	}
+
+	output.CustomText = presence.ActiveCustomText(time.Now().UTC())
+	if output.CustomText != "" && presence.CustomTextExpiresAt != nil {
+		output.CustomTextExpiresAt = presence.CustomTextExpiresAt.Unix()
+	}
 }
@@ -0,0 +1,120 @@
+//go:build unit
+// +build unit
+
+package status
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gochat-backend/internal/domain/status"
+	"gochat-backend/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStatusRepo trả về trạng thái kết nối và trạng thái tự chọn lưu sẵn trong bộ nhớ
+type fakeStatusRepo struct {
+	repository.StatusRepository
+	statuses  map[string]*status.UserStatus
+	presences map[string]*status.UserPresence
+}
+
+func (r *fakeStatusRepo) FindUserStatuses(ctx context.Context, userIDs []string) (map[string]*status.UserStatus, map[string]*status.UserPresence, error) {
+	return r.statuses, r.presences, nil
+}
+
+type fakeFriendShipRepo struct {
+	repository.FriendShipRepository
+}
+
+func (r *fakeFriendShipRepo) FindFriendIdsAmong(ctx context.Context, userID string, candidateIDs []string) ([]string, error) {
+	return candidateIDs, nil
+}
+
+type fakeChatRoomRepo struct {
+	repository.ChatRoomRepository
+}
+
+func (r *fakeChatRoomRepo) FindUserIDsSharingRoom(ctx context.Context, userID string, candidateIDs []string) ([]string, error) {
+	return nil, nil
+}
+
+func TestDisplayStatus(t *testing.T) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Hour)
+	online := &status.UserStatus{UserID: "user-1", Status: status.Online, LastSeen: now}
+	offline := &status.UserStatus{UserID: "user-1", Status: status.Offline, LastSeen: now.Add(-time.Minute)}
+
+	tests := []struct {
+		name           string
+		userStatus     *status.UserStatus
+		presence       *status.UserPresence
+		wantStatus     status.UserStatusType
+		wantCustomText string
+		wantExpiresAt  int64
+		wantLastSeen   int64
+	}{
+		{
+			name:           "dnd_keeps_custom_text",
+			userStatus:     online,
+			presence:       &status.UserPresence{Status: status.DoNotDisturb, CustomText: "Focusing", CustomTextExpiresAt: &expiresAt, UpdatedAt: now},
+			wantStatus:     status.DoNotDisturb,
+			wantCustomText: "Focusing",
+			wantExpiresAt:  expiresAt.Unix(),
+			wantLastSeen:   now.Unix(),
+		},
+		{
+			name:         "invisible_online_hides_custom_text",
+			userStatus:   online,
+			presence:     &status.UserPresence{Status: status.Invisible, CustomText: "On holiday", CustomTextExpiresAt: &expiresAt, UpdatedAt: now.Add(-time.Hour)},
+			wantStatus:   status.Offline,
+			wantLastSeen: now.Add(-time.Hour).Unix(),
+		},
+		{
+			name:         "invisible_offline_hides_custom_text",
+			userStatus:   offline,
+			presence:     &status.UserPresence{Status: status.Invisible, CustomText: "On holiday", UpdatedAt: now.Add(-time.Hour)},
+			wantStatus:   status.Offline,
+			wantLastSeen: now.Add(-time.Minute).Unix(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := displayStatus("user-1", tt.userStatus, tt.presence)
+			assert.Equal(t, tt.wantStatus, output.Status)
+			assert.Equal(t, tt.wantCustomText, output.CustomText)
+			assert.Equal(t, tt.wantExpiresAt, output.CustomTextExpiresAt)
+			assert.Equal(t, tt.wantLastSeen, output.RawLastSeen)
+		})
+	}
+}
+
+func TestGetUserStatusesForViewerHidesCustomTextOfInvisibleUsers(t *testing.T) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(time.Hour)
+	repo := &fakeStatusRepo{
+		statuses: map[string]*status.UserStatus{
+			"user-1": {UserID: "user-1", Status: status.Online, LastSeen: now},
+		},
+		presences: map[string]*status.UserPresence{
+			"user-1": {UserID: "user-1", Status: status.Invisible, CustomText: "On holiday", CustomTextExpiresAt: &expiresAt, UpdatedAt: now},
+		},
+	}
+	uc := NewStatusUseCase(repo, &fakeFriendShipRepo{}, &fakeChatRoomRepo{}, nil, nil)
+
+	others, err := uc.GetUserStatusForViewer(context.Background(), "user-2", "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, status.Offline, others.Status)
+	assert.Empty(t, others.CustomText)
+	assert.Zero(t, others.CustomTextExpiresAt)
+
+	// User vẫn thấy custom text của chính mình
+	own, err := uc.GetUserStatusForViewer(context.Background(), "user-1", "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "On holiday", own.CustomText)
+	assert.Equal(t, expiresAt.Unix(), own.CustomTextExpiresAt)
+}
@@ -3,7 +3,7 @@ package usecase
 import (
 	"gochat-backend/config"
 	"gochat-backend/internal/infra/cloudinaryinfra"
-	"gochat-backend/internal/infra/kafkainfra"
+	"gochat-backend/internal/infra/eventbus"
 	"gochat-backend/internal/infra/redisinfra"
 	"gochat-backend/internal/repository"
 	"gochat-backend/internal/usecase/auth"
@@ -24,7 +24,12 @@ type SharedDependencies struct {
 	JwtService          jwt.JwtService
 	EmailService        email.EmailService
 	VerificationService verification.VerificationService
-	KafkaService        *kafkainfra.KafkaService
+	EventBus            eventbus.EventBus     // Kafka, Redis Pub/Sub hoặc trong bộ nhớ theo EVENT_BUS_DRIVER
+	OutboxRelay         *eventbus.OutboxRelay // Được đánh thức khi có sự kiện outbox mới, nil thì sự kiện chờ tới lần poll sau
+
+	// Định danh của instance này và registry instance giữ kết nối của user (nil khi không dùng)
+	InstanceID         string
+	ConnectionRegistry repository.ConnectionRegistry
 
 	//Repositories
 	AccountRepo              repository.AccountRepository
@@ -33,6 +38,7 @@ type SharedDependencies struct {
 	FriendRequestRepo        repository.FriendRequestRepository
 	ChatRoomRepo             repository.ChatRoomRepository
 	MessageRepo              repository.MessageRepository
+	MessageReactionRepo      repository.MessageReactionRepository
 	StatusRepo               repository.StatusRepository
 
 	// Cloud Storage
@@ -74,12 +80,19 @@ func NewUseCaseContainer(deps *SharedDependencies) *UseCaseContainer {
 			deps.ChatRoomRepo,
 			deps.MessageRepo,
 			deps.AccountRepo,
+			deps.MessageReactionRepo,
+			deps.EventBus,
+			deps.OutboxRelay,
+			deps.Config,
 		),
 		Uploader: uploader.NewUploaderUseCase(
 			deps.CloudinaryStorage,
 		),
 		UserStatus: status.NewStatusUseCase(
 			deps.StatusRepo,
+			deps.FriendShipRepo,
+			deps.ChatRoomRepo,
+			deps.EventBus,
 			deps.Config,
 		),
 	}
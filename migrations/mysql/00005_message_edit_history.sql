@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages
+ADD COLUMN edited_at DATETIME NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE message_edit_history (
+    id VARCHAR(36) PRIMARY KEY,
+    message_id VARCHAR(36) NOT NULL,
+    editor_id VARCHAR(36) NOT NULL,
+    previous_content TEXT NOT NULL,
+    edited_at DATETIME NOT NULL,
+
+    INDEX idx_message_edit_history_message (message_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_edit_history;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE messages
+DROP COLUMN edited_at;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages
+ADD COLUMN deleted_at DATETIME NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE message_hidden_for_users (
+    message_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    hidden_at DATETIME NOT NULL,
+
+    PRIMARY KEY (message_id, user_id),
+    INDEX idx_message_hidden_user (user_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_hidden_for_users;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE messages
+DROP COLUMN deleted_at;
+-- +goose StatementEnd
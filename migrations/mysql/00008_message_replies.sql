@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE messages
+ADD COLUMN reply_to_message_id VARCHAR(36) NULL,
+ADD COLUMN reply_count INT NOT NULL DEFAULT 0,
+ADD INDEX idx_messages_reply_to (reply_to_message_id, created_at),
+ADD CONSTRAINT fk_messages_reply_to FOREIGN KEY (reply_to_message_id) REFERENCES messages(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages
+DROP FOREIGN KEY fk_messages_reply_to,
+DROP INDEX idx_messages_reply_to,
+DROP COLUMN reply_count,
+DROP COLUMN reply_to_message_id;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chat_room_members
+ADD COLUMN last_read_message_id VARCHAR(36) NULL,
+ADD COLUMN last_read_at DATETIME NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE chat_room_members
+DROP COLUMN last_read_at,
+DROP COLUMN last_read_message_id;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chat_rooms
+ADD COLUMN last_seq BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE messages
+ADD COLUMN seq BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE messages m
+JOIN (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY chat_room_id ORDER BY created_at, id) AS rn
+    FROM messages
+) ordered ON m.id = ordered.id
+SET m.seq = ordered.rn;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE chat_rooms cr
+SET cr.last_seq = (SELECT COALESCE(MAX(m.seq), 0) FROM messages m WHERE m.chat_room_id = cr.id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE messages
+ADD UNIQUE INDEX idx_messages_room_seq (chat_room_id, seq);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages
+DROP INDEX idx_messages_room_seq,
+DROP COLUMN seq;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE chat_rooms
+DROP COLUMN last_seq;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE message_idempotency_keys (
+    sender_id VARCHAR(36) NOT NULL,
+    chat_room_id VARCHAR(36) NOT NULL,
+    idempotency_key VARCHAR(64) NOT NULL,
+    message_id VARCHAR(36) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+
+    PRIMARY KEY (sender_id, chat_room_id, idempotency_key),
+    INDEX idx_message_idempotency_keys_expires (expires_at),
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (chat_room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_idempotency_keys;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE chat_room_events (
+    chat_room_id VARCHAR(36) NOT NULL,
+    seq BIGINT NOT NULL,
+    event_type VARCHAR(32) NOT NULL,
+    message_id VARCHAR(36) NOT NULL,
+    actor_id VARCHAR(36) NOT NULL,
+    emoji VARCHAR(32) NULL,
+    created_at DATETIME NOT NULL,
+
+    PRIMARY KEY (chat_room_id, seq),
+    FOREIGN KEY (chat_room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS chat_room_events;
+-- +goose StatementEnd